@@ -0,0 +1,122 @@
+package abi
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/reserve-protocol/solstice/solc"
+)
+
+// A single function, event, error or constructor description from a
+// contract's ABI.
+type Entry struct {
+	Type      string
+	Name      string
+	Inputs    []Param
+	Outputs   []Param
+	Anonymous bool
+}
+
+type Param struct {
+	Name       string
+	Type       string
+	Indexed    bool
+	Components []Param
+}
+
+// Maps a contract name, as given by solc, to its ABI entries.
+func Get(ctx context.Context, compiler solc.Compiler) (map[string][]Entry, error) {
+	files, err := compiler.Contracts()
+	if err != nil {
+		return nil, err
+	}
+
+	abiJSON, err := compiler.CombinedJSON(ctx, "abi", files)
+	if err != nil {
+		return nil, err
+	}
+
+	abis := make(map[string][]Entry)
+	for contractName, artifacts := range abiJSON.Contracts {
+		abis[contractName], err = Parse(artifacts.ABI)
+		if err != nil {
+			return abis, err
+		}
+	}
+	return abis, nil
+}
+
+// Older versions of solc give the ABI in the combined JSON as a string
+// containing JSON, newer ones embed it directly. This accepts both.
+func Parse(raw json.RawMessage) ([]Entry, error) {
+	var entries []Entry
+	if len(raw) == 0 {
+		return entries, nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = json.RawMessage(encoded)
+	}
+
+	err := json.Unmarshal(raw, &entries)
+	return entries, err
+}
+
+// The canonical type of a parameter, as used in signatures. Tuples are
+// expanded into their components.
+func (param Param) CanonicalType() string {
+	if !strings.HasPrefix(param.Type, "tuple") {
+		return param.Type
+	}
+	return "(" + joinTypes(param.Components) + ")" + strings.TrimPrefix(param.Type, "tuple")
+}
+
+func joinTypes(params []Param) string {
+	var types []string
+	for _, param := range params {
+		types = append(types, param.CanonicalType())
+	}
+	return strings.Join(types, ",")
+}
+
+// e.g. "transfer(address,uint256)"
+func (entry Entry) Signature() string {
+	return entry.Name + "(" + joinTypes(entry.Inputs) + ")"
+}
+
+// The first four bytes of the signature's hash, which prefix the calldata of
+// function calls and the revert data of custom errors.
+func (entry Entry) Selector() string {
+	return hex.EncodeToString(crypto.Keccak256([]byte(entry.Signature()))[:4])
+}
+
+// Maps hex-encoded selectors, without the 0x prefix, to the entries of the
+// given types that they identify.
+func Selectors(entries []Entry, entryType string) map[string]Entry {
+	selectors := make(map[string]Entry)
+	for _, entry := range entries {
+		if entry.Type == entryType {
+			selectors[entry.Selector()] = entry
+		}
+	}
+	return selectors
+}
+
+// Names the function that calldata is calling, falling back to the raw
+// selector if it isn't in the ABI.
+func FunctionName(entries []Entry, calldata []byte) string {
+	if len(calldata) < 4 {
+		return "fallback"
+	}
+
+	selector := hex.EncodeToString(calldata[:4])
+	if entry, ok := Selectors(entries, "function")[selector]; ok {
+		return entry.Signature()
+	}
+	return "0x" + selector
+}
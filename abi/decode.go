@@ -0,0 +1,202 @@
+package abi
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decodes ABI-encoded data into a readable string for each param.
+func DecodeValues(params []Param, data []byte) ([]string, error) {
+	var values []string
+	headOffset := 0
+	for _, param := range params {
+		value, err := decodeParam(param, data, headOffset)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+		headOffset += headSize(param)
+	}
+	return values, nil
+}
+
+// Formats decoded values as "name=value" pairs, or just values for unnamed
+// params, e.g. "(to=0xab..., 100)".
+func FormatValues(params []Param, values []string) string {
+	var formatted []string
+	for i, value := range values {
+		if params[i].Name != "" {
+			value = params[i].Name + "=" + value
+		}
+		formatted = append(formatted, value)
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
+
+// The element type of an array type, and its length, which is -1 for
+// dynamic arrays. ok is false if the type isn't an array.
+func arrayElement(param Param) (element Param, length int, ok bool) {
+	if !strings.HasSuffix(param.Type, "]") {
+		return param, 0, false
+	}
+
+	openIndex := strings.LastIndex(param.Type, "[")
+	element = param
+	element.Type = param.Type[:openIndex]
+
+	lengthString := param.Type[openIndex+1 : len(param.Type)-1]
+	if lengthString == "" {
+		return element, -1, true
+	}
+	length, err := strconv.Atoi(lengthString)
+	if err != nil {
+		return element, -1, true
+	}
+	return element, length, true
+}
+
+func isDynamic(param Param) bool {
+	if param.Type == "bytes" || param.Type == "string" {
+		return true
+	}
+	if element, length, ok := arrayElement(param); ok {
+		return length == -1 || isDynamic(element)
+	}
+	if param.Type == "tuple" {
+		for _, component := range param.Components {
+			if isDynamic(component) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The number of bytes the param takes up in the head of its enclosing tuple.
+func headSize(param Param) int {
+	if isDynamic(param) {
+		return 32
+	}
+	if element, length, ok := arrayElement(param); ok {
+		return length * headSize(element)
+	}
+	if param.Type == "tuple" {
+		size := 0
+		for _, component := range param.Components {
+			size += headSize(component)
+		}
+		return size
+	}
+	return 32
+}
+
+func word(data []byte, offset int) ([]byte, error) {
+	if offset < 0 || len(data) < offset+32 {
+		return nil, errors.New("ABI data too short.")
+	}
+	return data[offset : offset+32], nil
+}
+
+func wordInt(data []byte, offset int) (int, error) {
+	value, err := word(data, offset)
+	if err != nil {
+		return 0, err
+	}
+	number := new(big.Int).SetBytes(value)
+	if !number.IsInt64() || number.Int64() > int64(len(data)) {
+		return 0, errors.New("ABI offset or length out of range.")
+	}
+	return int(number.Int64()), nil
+}
+
+// Decodes the param whose head is at headOffset within data, which is the
+// encoding of the param's enclosing tuple.
+func decodeParam(param Param, data []byte, headOffset int) (string, error) {
+	if isDynamic(param) {
+		tailOffset, err := wordInt(data, headOffset)
+		if err != nil {
+			return "", err
+		}
+		return decodeTail(param, data[tailOffset:])
+	}
+	return decodeTail(param, data[headOffset:])
+}
+
+// Decodes the param from the start of data.
+func decodeTail(param Param, data []byte) (string, error) {
+	if element, length, ok := arrayElement(param); ok {
+		if length == -1 {
+			var err error
+			length, err = wordInt(data, 0)
+			if err != nil {
+				return "", err
+			}
+			data = data[32:]
+		}
+
+		var values []string
+		for i := 0; i < length; i++ {
+			value, err := decodeParam(element, data, i*headSize(element))
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	}
+
+	if param.Type == "tuple" {
+		values, err := DecodeValues(param.Components, data)
+		if err != nil {
+			return "", err
+		}
+		return FormatValues(param.Components, values), nil
+	}
+
+	if param.Type == "bytes" || param.Type == "string" {
+		length, err := wordInt(data, 0)
+		if err != nil {
+			return "", err
+		}
+		if len(data) < 32+length {
+			return "", errors.New("ABI data too short.")
+		}
+		if param.Type == "string" {
+			return strconv.Quote(string(data[32 : 32+length])), nil
+		}
+		return "0x" + hex.EncodeToString(data[32:32+length]), nil
+	}
+
+	value, err := word(data, 0)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case param.Type == "address":
+		return "0x" + hex.EncodeToString(value[12:]), nil
+	case param.Type == "bool":
+		return strconv.FormatBool(value[31] != 0), nil
+	case strings.HasPrefix(param.Type, "uint"):
+		return new(big.Int).SetBytes(value).String(), nil
+	case strings.HasPrefix(param.Type, "int"):
+		number := new(big.Int).SetBytes(value)
+		if value[0]&0x80 != 0 {
+			number.Sub(number, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return number.String(), nil
+	case strings.HasPrefix(param.Type, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(param.Type, "bytes"))
+		if err != nil || size > 32 {
+			return "", fmt.Errorf("Unsupported ABI type %s.", param.Type)
+		}
+		return "0x" + hex.EncodeToString(value[:size]), nil
+	}
+	// Function pointers, fixed point numbers and enums as seen in libraries
+	// are shown raw.
+	return "0x" + hex.EncodeToString(value), nil
+}
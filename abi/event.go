@@ -0,0 +1,109 @@
+package abi
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The first topic of a log emitted by a non-anonymous event: the full hash of
+// its signature, hex-encoded without the 0x prefix.
+func (entry Entry) Topic() string {
+	return hex.EncodeToString(crypto.Keccak256([]byte(entry.Signature())))
+}
+
+// An event declared by a contract. The same event can be declared by several
+// contracts, e.g. through inheritance, so it is identified by its signature.
+type DeclaredEvent struct {
+	Contracts []string
+	Entry     Entry
+}
+
+// Gathers the events declared in any of the contracts, keyed by topic, since
+// a transaction can emit events from contracts other than the one called.
+// Anonymous events have no topic to be recognized by, so they are left out.
+func Events(abis map[string][]Entry) map[string]DeclaredEvent {
+	var contractNames []string
+	for contractName := range abis {
+		contractNames = append(contractNames, contractName)
+	}
+	sort.Strings(contractNames)
+
+	events := make(map[string]DeclaredEvent)
+	for _, contractName := range contractNames {
+		for _, entry := range abis[contractName] {
+			if entry.Type != "event" || entry.Anonymous {
+				continue
+			}
+			topic := entry.Topic()
+			event, ok := events[topic]
+			if !ok {
+				event.Entry = entry
+			}
+			event.Contracts = append(event.Contracts, contractName)
+			events[topic] = event
+		}
+	}
+	return events
+}
+
+// Turns the topics and data of a log into e.g. "Transfer(from=0x..., to=0x...,
+// value=100)". Indexed arguments of reference types are stored only as their
+// hash, so that is what's shown for them. Logs from unknown events are shown
+// raw.
+func DecodeLog(topics [][]byte, data []byte, events map[string]DeclaredEvent) string {
+	if len(topics) != 0 {
+		if event, ok := events[hex.EncodeToString(topics[0])]; ok {
+			if decoded, ok := decodeEvent(event.Entry, topics[1:], data); ok {
+				return decoded
+			}
+		}
+	}
+
+	var rawTopics []string
+	for _, topic := range topics {
+		rawTopics = append(rawTopics, "0x"+hex.EncodeToString(topic))
+	}
+	return "unknown event (topics=[" + strings.Join(rawTopics, ", ") + "], data=0x" + hex.EncodeToString(data) + ")"
+}
+
+func decodeEvent(entry Entry, topics [][]byte, data []byte) (string, bool) {
+	var unindexed []Param
+	for _, param := range entry.Inputs {
+		if !param.Indexed {
+			unindexed = append(unindexed, param)
+		}
+	}
+	unindexedValues, err := DecodeValues(unindexed, data)
+	if err != nil {
+		return "", false
+	}
+
+	var values []string
+	for _, param := range entry.Inputs {
+		if !param.Indexed {
+			values = append(values, unindexedValues[0])
+			unindexedValues = unindexedValues[1:]
+			continue
+		}
+
+		if len(topics) == 0 {
+			return "", false
+		}
+		topic := topics[0]
+		topics = topics[1:]
+
+		if isDynamic(param) || strings.HasSuffix(param.Type, "]") || strings.HasPrefix(param.Type, "tuple") {
+			values = append(values, "hash 0x"+hex.EncodeToString(topic))
+			continue
+		}
+		value, err := DecodeValues([]Param{param}, topic)
+		if err != nil {
+			return "", false
+		}
+		values = append(values, value[0])
+	}
+	return entry.Name + FormatValues(entry.Inputs, values), true
+}
@@ -0,0 +1,75 @@
+package abi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+const errorStringSelector = "08c379a0"
+const panicSelector = "4e487b71"
+
+// Documented here;
+// https://docs.soliditylang.org/en/latest/control-structures.html#panic-via-assert-and-error-via-require
+var panicCodes = map[int64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "conversion to an invalid enum value",
+	0x22: "incorrectly encoded storage byte array",
+	0x31: "pop on an empty array",
+	0x32: "array index out of bounds",
+	0x41: "too much memory allocated",
+	0x51: "call to a zero-initialized internal function",
+}
+
+// Gathers the custom errors declared in any of the contracts, since a revert
+// can bubble up from a contract other than the one called.
+func Errors(abis map[string][]Entry) map[string]Entry {
+	customErrors := make(map[string]Entry)
+	for _, entries := range abis {
+		for selector, entry := range Selectors(entries, "error") {
+			customErrors[selector] = entry
+		}
+	}
+	return customErrors
+}
+
+// Turns the data a transaction reverted with into a readable reason. It
+// handles require messages, panics, and the given custom errors.
+func DecodeRevert(data []byte, customErrors map[string]Entry) string {
+	if len(data) == 0 {
+		return "reverted without a reason"
+	}
+	if len(data) < 4 {
+		return "unrecognized revert data 0x" + hex.EncodeToString(data)
+	}
+
+	selector := hex.EncodeToString(data[:4])
+	switch selector {
+	case errorStringSelector:
+		values, err := DecodeValues([]Param{{Type: "string"}}, data[4:])
+		if err == nil {
+			return "Error(" + values[0] + ")"
+		}
+	case panicSelector:
+		codeWord, err := word(data[4:], 0)
+		if err == nil {
+			code := new(big.Int).SetBytes(codeWord)
+			reason, ok := panicCodes[code.Int64()]
+			if !ok || !code.IsInt64() {
+				reason = "unknown panic code"
+			}
+			return fmt.Sprintf("Panic(0x%02x): %s", code, reason)
+		}
+	default:
+		if entry, ok := customErrors[selector]; ok {
+			values, err := DecodeValues(entry.Inputs, data[4:])
+			if err == nil {
+				return entry.Name + FormatValues(entry.Inputs, values)
+			}
+		}
+	}
+	return "unrecognized revert data 0x" + hex.EncodeToString(data)
+}
@@ -1,27 +1,30 @@
 package ast
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
-	"github.com/reserve-protocol/solstice/common"
 	"github.com/reserve-protocol/solstice/solc"
 	"github.com/reserve-protocol/solstice/srclocation"
 	"github.com/reserve-protocol/solstice/srcmap"
 )
 
-// The Abstract Syntax Tree of a contract.
+// The Abstract Syntax Tree of a contract. Trees built from source maps only
+// have byte ranges, not the node kinds or declared names.
 type AST struct {
-	ID       uint
-	SrcLoc   srclocation.SourceLocation
-	Children []*AST
+	ID         uint
+	SrcLoc     srclocation.SourceLocation
+	NodeType   string
+	Attributes solc.JSONASTAttributes
+	Children   []*AST
 }
 
-func Get(contractName string) (AST, error) {
-	srcMapJSON, err := solc.GetCombinedJSON("ast", []string{contractName})
+func Get(ctx context.Context, compiler solc.Compiler, contractName string) (AST, error) {
+	srcMapJSON, err := compiler.CombinedJSON(ctx, "ast", []string{contractName})
 	if err != nil {
 		return AST{}, err
 	}
@@ -32,10 +35,35 @@ func Get(contractName string) (AST, error) {
 	)
 }
 
+// Maps each source file name to its AST.
+func GetAll(ctx context.Context, compiler solc.Compiler) (map[string]AST, error) {
+	trees := make(map[string]AST)
+
+	contracts, err := compiler.Contracts()
+	if err != nil {
+		return trees, err
+	}
+
+	astJSON, err := compiler.CombinedJSON(ctx, "ast", contracts)
+	if err != nil {
+		return trees, err
+	}
+
+	for sourceFileName, source := range astJSON.Sources {
+		trees[sourceFileName], err = processASTNode(source.AST, astJSON.SourceList)
+		if err != nil {
+			return trees, err
+		}
+	}
+	return trees, nil
+}
+
 // Convert tree from solc's raw string & int representation to our SourceLocation type
 func processASTNode(node solc.JSONAST, sourceList []string) (AST, error) {
 	var newTree AST
 	newTree.ID = node.ID
+	newTree.NodeType = node.Name
+	newTree.Attributes = node.Attributes
 
 	srcLocParts := strings.Split(node.Src, ":")
 
@@ -55,10 +83,9 @@ func processASTNode(node solc.JSONAST, sourceList []string) (AST, error) {
 	}
 
 	newTree.SrcLoc = srclocation.SourceLocation{
-		byteOffset,
-		byteLength,
-		sourceList[sourceFileIndex],
-		rune(0),
+		ByteOffset:     byteOffset,
+		ByteLength:     byteLength,
+		SourceFileName: sourceList[sourceFileIndex],
 	}
 
 	for _, childNode := range node.Children {
@@ -72,17 +99,63 @@ func processASTNode(node solc.JSONAST, sourceList []string) (AST, error) {
 	return newTree, nil
 }
 
+// The innermost nodes of the given kinds that contain the location, outermost
+// first.
+func (tree AST) Enclosing(location srclocation.SourceLocation, nodeTypes ...string) []*AST {
+	var enclosing []*AST
+	for _, child := range tree.Children {
+		if child.SrcLoc.SourceFileName != location.SourceFileName || !child.SrcLoc.Overlaps(location) {
+			continue
+		}
+		for _, nodeType := range nodeTypes {
+			if child.NodeType == nodeType {
+				enclosing = append(enclosing, child)
+				break
+			}
+		}
+		enclosing = append(enclosing, child.Enclosing(location, nodeTypes...)...)
+	}
+	return enclosing
+}
+
+// Names the function or modifier containing the location as
+// "Contract.function", or just the contract if it's outside of any function.
+func FunctionName(trees map[string]AST, location srclocation.SourceLocation) string {
+	tree, ok := trees[location.SourceFileName]
+	if !ok {
+		return "<unknown>"
+	}
+
+	var name string
+	for _, node := range tree.Enclosing(location, "ContractDefinition", "FunctionDefinition", "ModifierDefinition") {
+		switch {
+		case node.NodeType == "ContractDefinition":
+			name = node.Attributes.Name
+		case node.Attributes.IsConstructor || node.Attributes.Kind == "constructor":
+			name += ".constructor"
+		case node.Attributes.Name == "":
+			name += ".fallback"
+		default:
+			name += "." + node.Attributes.Name
+		}
+	}
+	if name == "" {
+		return "<unknown>"
+	}
+	return name
+}
+
 // The AST from a source map will contain only those byte ranges that are
 // represented in the bytecode, since the source map comes from the bytecode.
-func FromSrcmaps() (map[string]AST, error) {
+func FromSrcmaps(ctx context.Context, compiler solc.Compiler) (map[string]AST, error) {
 	treesFromSrcmaps := make(map[string]AST)
 
-	srcMaps, _, err := srcmap.Get()
+	srcMaps, _, err := srcmap.Get(ctx, compiler)
 	if err != nil {
 		return treesFromSrcmaps, err
 	}
 
-	contracts, err := common.AllContracts()
+	contracts, err := compiler.Contracts()
 	if err != nil {
 		return treesFromSrcmaps, err
 	}
@@ -150,7 +223,7 @@ func (tree *AST) insertSrcLoc(srcLoc srclocation.SourceLocation) error {
 				// The child should remain a child of tree, and we should continue to check the rest of the children.
 				treeChildrenUpdated = append(treeChildrenUpdated, child)
 			} else {
-				panic("This is logically impossible.")
+				return fmt.Errorf("SourceLocation range %v neither overlaps nor is disjoint with %v.", srcLoc, child.SrcLoc)
 			}
 		}
 		// If we've made it here without returning, then srcLoc does not
@@ -0,0 +1,158 @@
+package calltree
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+// The ops that start a sub-call, by op code.
+var callTypes = map[string]string{
+	"f0": "CREATE",
+	"f1": "CALL",
+	"f2": "CALLCODE",
+	"f4": "DELEGATECALL",
+	"f5": "CREATE2",
+	"fa": "STATICCALL",
+}
+
+// An external call, or contract creation, and the calls it made in turn.
+// Address is the called account, or the created one for creations. Contract
+// is the name of the code that ran, so for delegate calls it isn't the
+// contract at Address. For creations, Input is the init code.
+type Call struct {
+	Type     string
+	Contract string
+	Address  string
+	Input    []byte
+	Value    *big.Int
+	Output   []byte
+	Reverted bool
+	GasUsed  int
+	Calls    []*Call
+
+	depth int
+}
+
+// Builds the tree of calls from a flattened trace. The transaction itself is
+// the root, but its input, value, address and gas aren't in the steps, so
+// they have to be filled in by the caller.
+func Build(steps []trace.Step) *Call {
+	root := &Call{Type: "CALL", Value: new(big.Int)}
+	if len(steps) != 0 {
+		root.Contract = steps[0].Frame.Contract
+	}
+
+	open := []*Call{root}
+	machine := trace.NewMachine()
+	for _, step := range steps {
+		for len(open) > 1 && open[len(open)-1].depth > step.Depth {
+			open = open[:len(open)-1]
+		}
+		current := open[len(open)-1]
+		if current.Contract == "" && step.Depth == current.depth {
+			current.Contract = step.Frame.Contract
+		}
+
+		// Only the ops that start or end a call need the stack and memory,
+		// so they're read just for those.
+		switch step.OpCode {
+		case "f3", "fd": // RETURN, REVERT
+			current.Output = readMemory(machine, step, machine.Stack(step), 0, 1)
+			current.Reverted = step.OpCode == "fd"
+		case "fe": // INVALID
+			current.Reverted = true
+		}
+
+		if callType, ok := callTypes[step.OpCode]; ok && step.Op.Sub != nil {
+			call := newCall(callType, step, machine)
+			call.depth = step.Depth + 1
+			current.Calls = append(current.Calls, call)
+			open = append(open, call)
+		}
+
+		machine.Apply(step)
+	}
+	return root
+}
+
+// Reads the arguments of a call op off the stack, before the op.
+func newCall(callType string, step trace.Step, machine *trace.Machine) *Call {
+	stack := machine.Stack(step)
+	call := &Call{
+		Type:    callType,
+		Value:   new(big.Int),
+		GasUsed: step.Op.Sub.GasUsed(),
+	}
+
+	// The result of the call op is 0 if the call failed, and the address of
+	// the new contract for creations that succeeded.
+	if len(step.Op.Ex.Push) == 1 {
+		result, ok := stackItem(step.Op.Ex.Push, 0)
+		call.Reverted = ok && result.Sign() == 0
+		if ok && strings.HasPrefix(callType, "CREATE") {
+			call.Address = formatAddress(result)
+		}
+	}
+
+	switch callType {
+	case "CALL", "CALLCODE":
+		call.Address = stackAddress(stack, 1)
+		if value, ok := stackItem(stack, 2); ok {
+			call.Value = value
+		}
+		call.Input = readMemory(machine, step, stack, 3, 4)
+	case "DELEGATECALL", "STATICCALL":
+		call.Address = stackAddress(stack, 1)
+		call.Input = readMemory(machine, step, stack, 2, 3)
+	case "CREATE", "CREATE2":
+		if value, ok := stackItem(stack, 0); ok {
+			call.Value = value
+		}
+		call.Input = readMemory(machine, step, stack, 1, 2)
+	}
+	return call
+}
+
+// Calldata and return data are far smaller than this in practice, so larger
+// sizes are treated as unreadable.
+const maxDataSize = 1 << 20
+
+// The stack item at the given position from the top.
+func stackItem(stack []string, fromTop int) (*big.Int, bool) {
+	if fromTop >= len(stack) {
+		return nil, false
+	}
+	return new(big.Int).SetString(strings.TrimPrefix(stack[len(stack)-1-fromTop], "0x"), 16)
+}
+
+func stackAddress(stack []string, fromTop int) string {
+	address, ok := stackItem(stack, fromTop)
+	if !ok {
+		return ""
+	}
+	return formatAddress(address)
+}
+
+func formatAddress(address *big.Int) string {
+	// Addresses are the low 20 bytes of the word.
+	address = new(big.Int).And(address, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1)))
+	return fmt.Sprintf("0x%040x", address)
+}
+
+// Reads the memory range given by an offset and a size on the stack. Memory
+// past what has been written reads as zeros.
+func readMemory(machine *trace.Machine, step trace.Step, stack []string, offsetFromTop int, sizeFromTop int) []byte {
+	offset, okOffset := stackItem(stack, offsetFromTop)
+	size, okSize := stackItem(stack, sizeFromTop)
+	if !okOffset || !okSize || !size.IsInt64() || size.Int64() > maxDataSize {
+		return nil
+	}
+	if !offset.IsInt64() || offset.Int64() > math.MaxInt32 {
+		return make([]byte, size.Int64())
+	}
+	return machine.Memory(step, int(offset.Int64()), int(size.Int64()))
+}
@@ -0,0 +1,104 @@
+package calltree
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/abi"
+)
+
+// Prints the tree, one call per line, e.g.
+//
+//	CALL Token.transfer(to=0x..., amount=5) -> (true) [0x..., gas 29650]
+//	└─ STATICCALL Oracle.price() -> (100) [0x..., gas 2400]
+//
+// Calls are decoded against the ABI of the contract whose code ran, and
+// reverts against the custom errors of all of them.
+func Print(out io.Writer, root *Call, abis map[string][]abi.Entry) error {
+	printer := printer{out: out, abis: abis, customErrors: abi.Errors(abis)}
+	printer.print(root, "", "")
+	return printer.err
+}
+
+type printer struct {
+	out          io.Writer
+	abis         map[string][]abi.Entry
+	customErrors map[string]abi.Entry
+	err          error
+}
+
+func (printer *printer) print(call *Call, firstPrefix string, prefix string) {
+	if printer.err != nil {
+		return
+	}
+	_, printer.err = fmt.Fprintf(printer.out, "%s%s\n", firstPrefix, printer.describe(call))
+
+	for i, child := range call.Calls {
+		if i == len(call.Calls)-1 {
+			printer.print(child, prefix+"└─ ", prefix+"   ")
+		} else {
+			printer.print(child, prefix+"├─ ", prefix+"│  ")
+		}
+	}
+}
+
+func (printer *printer) describe(call *Call) string {
+	name := call.Address
+	if call.Contract != "" {
+		name = call.Contract[strings.LastIndex(call.Contract, ":")+1:]
+	}
+
+	description := call.Type + " " + name
+	var function *abi.Entry
+	if !strings.HasPrefix(call.Type, "CREATE") {
+		var functionCall string
+		functionCall, function = printer.functionCall(call)
+		description += "." + functionCall
+	}
+
+	switch {
+	case call.Reverted:
+		description += " reverted: " + abi.DecodeRevert(call.Output, printer.customErrors)
+	case function != nil && len(function.Outputs) != 0:
+		values, err := abi.DecodeValues(function.Outputs, call.Output)
+		if err == nil {
+			description += " -> " + abi.FormatValues(function.Outputs, values)
+		} else {
+			description += " -> 0x" + hex.EncodeToString(call.Output)
+		}
+	}
+
+	details := []string{call.Address, fmt.Sprintf("gas %d", call.GasUsed)}
+	if call.Value != nil && call.Value.Sign() != 0 {
+		details = append(details, fmt.Sprintf("value %s wei", call.Value))
+	}
+	if call.Address == "" {
+		details = details[1:]
+	}
+	return description + " [" + strings.Join(details, ", ") + "]"
+}
+
+// Decodes the function called and its arguments. The ABI entry of the
+// function is nil if it isn't known.
+func (printer *printer) functionCall(call *Call) (string, *abi.Entry) {
+	if len(call.Input) < 4 {
+		if len(call.Input) == 0 {
+			return "receive()", nil
+		}
+		return "fallback()", nil
+	}
+
+	selector := hex.EncodeToString(call.Input[:4])
+	entry, ok := abi.Selectors(printer.abis[call.Contract], "function")[selector]
+	if !ok {
+		return "0x" + selector + "(0x" + hex.EncodeToString(call.Input[4:]) + ")", nil
+	}
+
+	values, err := abi.DecodeValues(entry.Inputs, call.Input[4:])
+	if err != nil {
+		return entry.Signature(), &entry
+	}
+	return entry.Name + abi.FormatValues(entry.Inputs, values), &entry
+}
@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Saves the state of a development chain with evm_snapshot, as supported by
+// Ganache and Hardhat, and returns the ID to revert to it with.
+func Snapshot(ctx context.Context, url string) (string, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	var id string
+	err = client.CallContext(ctx, &id, "evm_snapshot")
+	return id, err
+}
+
+// Reverts the chain to a snapshot. A snapshot can only be reverted to once,
+// so take a new one to revert to it again.
+func Revert(ctx context.Context, url string, id string) error {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var reverted bool
+	if err := client.CallContext(ctx, &reverted, "evm_revert", id); err != nil {
+		return err
+	}
+	if !reverted {
+		return errors.New("The chain did not revert to snapshot " + id + ".")
+	}
+	return nil
+}
+
+// Whether the node at url has a JSON-RPC method. The params needn't make
+// sense: only an error saying that the method doesn't exist or isn't
+// supported counts against it. Not reaching the node is an error.
+func Supports(ctx context.Context, url string, method string, params ...interface{}) (bool, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	var result json.RawMessage
+	err = client.CallContext(ctx, &result, method, params...)
+	if err == nil {
+		return true, nil
+	}
+	rpcErr, ok := err.(interface{ ErrorCode() int })
+	if !ok {
+		return false, err
+	}
+	// -32601 is JSON-RPC's "method not found", and -32004 EIP-1474's
+	// "method not supported". Nodes word the same thing many ways too.
+	if code := rpcErr.ErrorCode(); code == -32601 || code == -32004 {
+		return false, nil
+	}
+	message := strings.ToLower(err.Error())
+	for _, unsupported := range []string{"not supported", "does not exist", "not available"} {
+		if strings.Contains(message, unsupported) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,118 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// How long a node has to exit after being interrupted before it's killed.
+const stopTimeout = 5 * time.Second
+
+// A node started for a run of the tests, such as `ganache` or
+// `anvil`, to be stopped once the run is over.
+type Node struct {
+	command *exec.Cmd
+	output  *lockedBuffer
+	exited  chan struct{}
+	err     error
+}
+
+// Output is only kept to say why a node that wouldn't start failed.
+type lockedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *lockedBuffer) Write(data []byte) (int, error) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return buffer.buffer.Write(data)
+}
+
+func (buffer *lockedBuffer) String() string {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return buffer.buffer.String()
+}
+
+// Runs a node with the command, and waits for it to answer JSON-RPC requests
+// on url. Something else already answering there is an error, since the
+// tests would run against it instead. The node is stopped if ctx is done
+// before it's ready; after that, stopping it is up to the caller.
+func StartNode(ctx context.Context, args []string, url string, timeout time.Duration) (*Node, error) {
+	if len(args) == 0 {
+		return nil, errors.New("The node command is empty.")
+	}
+	if Ready(url) {
+		return nil, fmt.Errorf("A node is already running on %s; stop it, or leave node_command unset to use it.", url)
+	}
+
+	node := &Node{
+		command: exec.Command(args[0], args[1:]...),
+		output:  &lockedBuffer{},
+		exited:  make(chan struct{}),
+	}
+	node.command.Stdout = node.output
+	node.command.Stderr = node.output
+	startProcessGroup(node.command)
+	if err := node.command.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		node.err = node.command.Wait()
+		close(node.exited)
+	}()
+
+	deadline := time.After(timeout)
+	for !Ready(url) {
+		select {
+		case <-node.exited:
+			return nil, fmt.Errorf("The node exited before it was ready (%v):\n%s", node.err, node.output)
+		case <-deadline:
+			node.Stop()
+			return nil, fmt.Errorf("The node wasn't answering on %s after %v:\n%s", url, timeout, node.output)
+		case <-ctx.Done():
+			node.Stop()
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return node, nil
+}
+
+// Interrupts the node and the processes it started, and kills them if they
+// haven't exited after a few seconds.
+func (node *Node) Stop() {
+	select {
+	case <-node.exited:
+		return
+	default:
+	}
+
+	interruptProcessGroup(node.command)
+	select {
+	case <-node.exited:
+	case <-time.After(stopTimeout):
+		killProcessGroup(node.command)
+		<-node.exited
+	}
+}
+
+// Whether a node answers JSON-RPC requests on url.
+func Ready(url string) bool {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+
+	var blockNumber string
+	return client.Call(&blockNumber, "eth_blockNumber") == nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package chain
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Nodes are often run through wrappers like npx, which don't always pass
+// signals on, so the whole process group is signalled.
+func startProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptProcessGroup(command *exec.Cmd) {
+	syscall.Kill(-command.Process.Pid, syscall.SIGINT)
+}
+
+func killProcessGroup(command *exec.Cmd) {
+	syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package chain
+
+import (
+	"os/exec"
+)
+
+func startProcessGroup(command *exec.Cmd) {}
+
+// Windows can't interrupt another process, so the node is killed outright.
+func interruptProcessGroup(command *exec.Cmd) {
+	command.Process.Kill()
+}
+
+func killProcessGroup(command *exec.Cmd) {
+	command.Process.Kill()
+}
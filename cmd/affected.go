@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/gitdiff"
+	"github.com/reserve-protocol/solstice/testcov"
+)
+
+var sinceRev string
+var testCoverageFile string
+
+func init() {
+	affectedCmd.Flags().StringVar(&sinceRev, "since", "", "the git revision to find the changes since")
+	affectedCmd.Flags().StringVar(&testCoverageFile, "coverage", "", "the per-test coverage written by cover (default is test_coverage.json in the coverage_report_dir)")
+	affectedCmd.MarkFlagRequired("since")
+	rootCmd.AddCommand(affectedCmd)
+}
+
+var affectedCmd = &cobra.Command{
+	Use:   "affected",
+	Short: "Lists the tests that run code changed since a git revision",
+	Long: `Finds the lines of the .sol files that changed since a git revision,
+including uncommitted changes, and prints the names of the tests that ran any
+of them, one per line. It uses the per-test coverage saved by cover, which
+should have been recorded at that revision.`,
+	Run: Affected,
+}
+
+func Affected(cmd *cobra.Command, args []string) {
+	if testCoverageFile == "" {
+		testCoverageFile = filepath.Join(viper.GetString("coverage_report_dir"), "test_coverage.json")
+	}
+	coverage, err := testcov.ReadJSON(testCoverageFile)
+	common.Check(err)
+
+	files, err := gitdiff.Changes(sinceRev, "*.sol")
+	common.Check(err)
+
+	// New files weren't around when the coverage was recorded, so the tests
+	// that will run them can't be known.
+	for _, file := range files {
+		if file.OldName == "" {
+			fmt.Fprintf(os.Stderr, "%s is new, so no tests are known to run it.\n", file.NewName)
+		}
+	}
+
+	tests := coverage.Affected(files)
+	if len(tests) == 0 {
+		fmt.Fprintln(os.Stderr, "No tests run the changed code.")
+	}
+	for _, test := range tests {
+		fmt.Println(test)
+	}
+}
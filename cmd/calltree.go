@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/calltree"
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+func init() {
+	calltreeCmd.Flags().StringVar(&txnHash, "txn", "", "the hash of a transaction to print the calls of")
+	calltreeCmd.MarkFlagRequired("txn")
+	rootCmd.AddCommand(calltreeCmd)
+}
+
+var calltreeCmd = &cobra.Command{
+	Use:   "calltree",
+	Short: "Prints the tree of external calls a transaction made",
+	Long: `Prints the external calls and contract creations a transaction made, as a
+tree. Each call shows the contract and function called, its arguments, what
+it returned or why it reverted, and the gas it used.`,
+	Run: Calltree,
+}
+
+func Calltree(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	execTrace, err := parity.GetExecTrace(ctx, traceConfig(), txnHash, "trace")
+	common.Check(err)
+
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
+	common.Check(err)
+
+	abis, err := abi.Get(ctx, compiler())
+	common.Check(err)
+
+	root := calltree.Build(trace.Flatten(execTrace.VMTrace, sourceMaps, bytecodeToFilename))
+	root.GasUsed = execTrace.GasUsed()
+	if len(execTrace.Trace) != 0 {
+		// The first call in Parity's trace is the transaction itself.
+		transaction := execTrace.Trace[0]
+		input := transaction.Action.Input
+		if transaction.Type == "create" {
+			root.Type = "CREATE"
+			input = transaction.Action.Init
+			if transaction.Result != nil {
+				root.Address = transaction.Result.Address
+			}
+		} else {
+			root.Type = strings.ToUpper(transaction.Action.CallType)
+			root.Address = transaction.Action.To
+		}
+
+		root.Input, err = hex.DecodeString(strings.TrimPrefix(input, "0x"))
+		common.Check(err)
+		if value, ok := new(big.Int).SetString(strings.TrimPrefix(transaction.Action.Value, "0x"), 16); ok {
+			root.Value = value
+		}
+	}
+
+	common.Check(calltree.Print(os.Stdout, root, abis))
+}
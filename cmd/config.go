@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/viper"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+// How the contracts are compiled, from contracts_dir and solc_args.
+func compiler() solc.Compiler {
+	return solc.Compiler{
+		ContractsDir: viper.GetString("contracts_dir"),
+		Args:         viper.GetStringSlice("solc_args"),
+	}
+}
+
+// Where traces are fetched from and cached, from blockchain_client, offline,
+// trace_cache_dir and chain_id.
+func traceConfig() tracecache.Config {
+	return coverageConfig().TraceConfig(viper.GetString("blockchain_client"))
+}
+
+// A fetcher for blockchain_client, set up from the rpc_* config options, that
+// caches the traces it fetches.
+func newFetcher(ctx context.Context) *fetch.Fetcher {
+	cfg := coverageConfig()
+	cache, err := cfg.TraceCache(ctx, cfg.BlockchainClient)
+	common.Check(err)
+	return cfg.NewFetcher(cfg.BlockchainClient, cache)
+}
+
+// The settings of the coverage engine, from the config options.
+func coverageConfig() coverage.Config {
+	return coverage.Config{
+		Compiler:  compiler(),
+		ReportDir: viper.GetString("coverage_report_dir"),
+
+		BlockchainClient: viper.GetString("blockchain_client"),
+		TestCommand:      viper.GetStringSlice("test_command"),
+		TestHookAddress:  viper.GetString("test_hook_address"),
+
+		Backend:            viper.GetString("backend"),
+		EmbeddedAddress:    viper.GetString("embedded_address"),
+		EmbeddedAccounts:   viper.GetInt("embedded_accounts"),
+		NodeCommand:        viper.GetStringSlice("node_command"),
+		NodeStartupTimeout: viper.GetDuration("node_startup_timeout"),
+		SnapshotChain:      viper.GetBool("snapshot_chain"),
+
+		RPCConcurrency: viper.GetInt("rpc_concurrency"),
+		RPCBatchSize:   viper.GetInt("rpc_batch_size"),
+		RPCRetries:     viper.GetInt("rpc_retries"),
+		StreamTraces:   viper.GetBool("stream_traces"),
+		TraceCacheDir:  viper.GetString("trace_cache_dir"),
+		ChainID:        viper.GetString("chain_id"),
+		Offline:        viper.GetBool("offline"),
+
+		Out: os.Stdout,
+		Log: os.Stderr,
+	}
+}
@@ -1,14 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
     "github.com/spf13/cobra"
 
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/ast"
 	"github.com/reserve-protocol/solstice/common"
 	"github.com/reserve-protocol/solstice/evmbytecode"
 	"github.com/reserve-protocol/solstice/parity"
 	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/trace"
+	"github.com/reserve-protocol/solstice/variables"
 )
 
 func init() {
@@ -22,29 +29,71 @@ var debugCmd = &cobra.Command{
     Short: "Tells you where a txn reverted",
     Long: `Tells you the last line of code that a particular transaction ended 
 on. This is especially useful for reverts, since the EVM does not currently 
-provide any kind of error messages or stack traces.`,
+provide any kind of error messages or stack traces. If the transaction 
+reverted, the revert reason is decoded too, including panic codes and custom 
+errors declared by the contracts, and a stack trace is printed from where the 
+revert started, along with the values of the arguments and local variables of 
+each function in it. The events emitted along the way are decoded as well.`,
     Run: Debug,
 }
 
 func Debug(cmd *cobra.Command, args []string) {
-	execTrace, err := parity.GetExecTrace(txnHash)
+	ctx := context.Background()
+	execTrace, err := parity.GetExecTrace(ctx, traceConfig(), txnHash)
 	common.Check(err)
 	if execTrace.Code == "0x" {
 		fmt.Println("Transaction was not sent to a contract.")
 		return
 	}
 
+	abis, err := abi.Get(ctx, compiler())
+	common.Check(err)
+
 	pcToOpIndex := evmbytecode.GetPcToOpIndex(execTrace.Code)
 
 	lastProgramCounter := execTrace.Ops[len(execTrace.Ops)-1].PC
 	fmt.Printf("Last program counter: %v\n", lastProgramCounter)
 	fmt.Printf("Final op index: %v\n", pcToOpIndex[lastProgramCounter])
 
+	reverted := false
+	switch evmbytecode.OpCodeAt(execTrace.Code, lastProgramCounter) {
+	case "fd": // REVERT
+		reverted = true
+		revertData, err := hex.DecodeString(strings.TrimPrefix(execTrace.Output, "0x"))
+		common.Check(err)
+
+		fmt.Printf("Reverted: %s\n", abi.DecodeRevert(revertData, abi.Errors(abis)))
+	case "fe": // INVALID
+		reverted = true
+		fmt.Println("Reverted: invalid opcode, as used by assert before solidity 0.8")
+	}
+
 	// Now you have pcToOpIndex[lastProgramCounter] with which to pick an operation from the source map
 
-	sourceMaps, bytecodeToFilename, err := srcmap.Get()
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
+	common.Check(err)
+
+	asts, err := ast.GetAll(ctx, compiler())
 	common.Check(err)
 
+	steps := trace.Flatten(execTrace.VMTrace, sourceMaps, bytecodeToFilename)
+	origin := trace.Origin(steps)
+
+	if logs := trace.Logs(steps); len(logs) != 0 {
+		fmt.Println("Events:")
+		declaredEvents := abi.Events(abis)
+		for _, log := range logs {
+			fmt.Printf("    %s\n", abi.DecodeLog(log.Topics, log.Data, declaredEvents))
+		}
+	}
+
+	// The stack trace is of where it reverted, so there's none for a
+	// transaction that succeeded.
+	if reverted {
+		fmt.Println("Stack trace:")
+		printStackTrace(origin.Stack(), variables.AtStep(asts, steps, origin), asts)
+	}
+
 	filename := bytecodeToFilename[evmbytecode.RemoveMetaData(execTrace.Code)]
 	sourceMap := sourceMaps[filename]
 	if len(sourceMap) == 0 {
@@ -52,11 +101,8 @@ func Debug(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	if _, ok := pcToOpIndex[lastProgramCounter]; !ok {
-		fmt.Println("Something has gone wrong")
-		return
-	}
-	lastLocation := sourceMap[pcToOpIndex[lastProgramCounter]]
+	lastLocation, err := srcmap.Location(sourceMap, pcToOpIndex, lastProgramCounter)
+	common.Check(err)
 
 	if lastLocation.SourceFileName == "" {
 		fmt.Printf("File name:\n%s\nhas no source map.", filename)
@@ -69,3 +115,37 @@ func Debug(cmd *cobra.Command, args []string) {
 	fmt.Printf("%s %d:%d\n", lastLocation.SourceFileName, lineNumber, columnNumber)
 	fmt.Printf("... %s ...\n", codeSnippet)
 }
+
+// Each frame is followed by its variables, if any are known.
+func printStackTrace(stack []trace.Location, stackVariables [][]variables.Variable, asts map[string]ast.AST) {
+	for i, location := range stack {
+		if location.SrcLoc.SourceFileName == "" {
+			if location.Contract == "" {
+				fmt.Println("    at <unknown contract>")
+			} else {
+				fmt.Printf("    at %s (no source location)\n", location.Contract)
+			}
+			continue
+		}
+
+		lineNumber, columnNumber, _, err := location.SrcLoc.ByteLocToSnippet()
+		common.Check(err)
+
+		fmt.Printf(
+			"    at %s (%s:%d:%d)\n",
+			ast.FunctionName(asts, location.SrcLoc),
+			location.SrcLoc.SourceFileName,
+			lineNumber,
+			columnNumber,
+		)
+		if i < len(stackVariables) {
+			printVariables(stackVariables[i], "        ")
+		}
+	}
+}
+
+func printVariables(frameVariables []variables.Variable, indent string) {
+	for _, variable := range frameVariables {
+		fmt.Printf("%s%s %s = %s\n", indent, variable.Type, variable.Name, variable.Value)
+	}
+}
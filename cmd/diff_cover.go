@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/gitdiff"
+	"github.com/reserve-protocol/solstice/linecov"
+)
+
+var baseRev string
+var lineCoverageFile string
+var diffCoverThreshold float64
+
+func init() {
+	diffCoverCmd.Flags().StringVar(&baseRev, "base", "", "the git revision to compare against")
+	diffCoverCmd.Flags().StringVar(&lineCoverageFile, "coverage", "", "the line coverage written by cover (default is line_coverage.json in the coverage_report_dir)")
+	diffCoverCmd.Flags().Float64Var(&diffCoverThreshold, "threshold", 0, "the percentage of changed lines that must be covered, below which it exits with a non-zero status")
+	diffCoverCmd.MarkFlagRequired("base")
+	rootCmd.AddCommand(diffCoverCmd)
+}
+
+var diffCoverCmd = &cobra.Command{
+	Use:   "diff-cover",
+	Short: "Reports the coverage of the lines changed since a git revision",
+	Long: `Finds the lines of the .sol files that were added or changed since a git
+revision, including uncommitted changes, and reports how many of them the
+tests ran, listing the ones they didn't. It uses the line coverage saved by
+the last run of cover, so the tests aren't run again.`,
+	Run: DiffCover,
+}
+
+func DiffCover(cmd *cobra.Command, args []string) {
+	if lineCoverageFile == "" {
+		lineCoverageFile = filepath.Join(viper.GetString("coverage_report_dir"), "line_coverage.json")
+	}
+	coverage, err := linecov.ReadJSON(lineCoverageFile)
+	common.Check(err)
+
+	files, err := gitdiff.Changes(baseRev, "*.sol")
+	common.Check(err)
+
+	diff, err := coverage.Diff(files)
+	common.Check(err)
+
+	uncovered := diff.Uncovered()
+	fmt.Printf(
+		"Diff coverage: %d of %d changed lines covered (%.1f%%)\n",
+		len(diff.Lines)-len(uncovered),
+		len(diff.Lines),
+		diff.Percent(),
+	)
+
+	workingDir, err := os.Getwd()
+	common.Check(err)
+	if len(uncovered) != 0 {
+		fmt.Println("Changed lines that the tests didn't run:")
+	}
+	for _, line := range uncovered {
+		file, err := filepath.Rel(workingDir, line.File)
+		if err != nil {
+			file = line.File
+		}
+		fmt.Printf("    %s:%d: %s\n", file, line.Line, line.Source)
+	}
+
+	if diff.Percent() < diffCoverThreshold {
+		fmt.Printf("Diff coverage is below the threshold of %.1f%%.\n", diffCoverThreshold)
+		os.Exit(1)
+	}
+}
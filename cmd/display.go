@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -8,12 +9,15 @@ import (
     "github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/reserve-protocol/solstice/abi"
 	"github.com/reserve-protocol/solstice/ast"
 	"github.com/reserve-protocol/solstice/common"
 	"github.com/reserve-protocol/solstice/evmbytecode"
 	"github.com/reserve-protocol/solstice/parity"
 	"github.com/reserve-protocol/solstice/srclocation"
 	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/trace"
+	"github.com/reserve-protocol/solstice/viewer"
 )
 
 var contractName string
@@ -27,8 +31,9 @@ func init() {
 var displayCmd = &cobra.Command{
     Use:   "display",
     Short: "Prints marked up source code of the requested info",
-    Long: `If a transaction ID is given, it delivers marked up source code for 
-each step in the transaction, similar to a stack trace. If given a contract 
+    Long: `If a transaction ID is given, it delivers a single HTML page for stepping 
+through the transaction, highlighting the source code of each step, similar 
+to a stack trace, along with the events emitted so far. If given a contract 
 file name, it delivers marked up source code for each node in the abstract 
 syntax tree (AST) of that file.`,
     Run: Display,
@@ -37,70 +42,58 @@ syntax tree (AST) of that file.`,
 var dirName string
 
 func Display(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
 	workingDir, err := os.Getwd()
 	common.Check(err)
 
 	if txnHash != "" {
-		dirName = workingDir + "/" + txnHash
-	} else {
-		dirName = workingDir + "/" + contractName
-	}
-
-	if _, err := os.Stat(dirName); os.IsNotExist(err) {
-		os.MkdirAll(dirName, 0711)
-	} else {
+		execTrace, err := parity.GetExecTrace(ctx, traceConfig(), txnHash)
 		common.Check(err)
-	}
 
-	if txnHash != "" {
-		execTrace, err := parity.GetExecTrace(txnHash)
+		sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
 		common.Check(err)
 
-		sourceMaps, bytecodeToFilename, err := srcmap.Get()
-		common.Check(err)
-
-		filename := bytecodeToFilename[evmbytecode.RemoveMetaData(execTrace.Code)]
-		sourceMap := sourceMaps[filename]
-		if len(sourceMap) == 0 {
+		if len(sourceMaps[bytecodeToFilename[evmbytecode.RemoveMetaData(execTrace.Code)]]) == 0 {
 			fmt.Println("Contract code not in contracts dir.")
 			return
 		}
 
-		pcToOpIndex := evmbytecode.GetPcToOpIndex(execTrace.Code)
-
-		var prevLoc srclocation.SourceLocation
-		for i, _ := range execTrace.Ops {
-			pc := execTrace.Ops[i].PC
-
-			if _, ok := pcToOpIndex[pc]; !ok {
-				fmt.Println("Something has gone wrong")
-				continue
-			}
+		asts, err := ast.GetAll(ctx, compiler())
+		common.Check(err)
 
-			nextLoc := sourceMap[pcToOpIndex[pc]]
+		abis, err := abi.Get(ctx, compiler())
+		common.Check(err)
 
-			if nextLoc.SourceFileName == "" {
-				continue
-			}
+		steps := trace.Flatten(execTrace.VMTrace, sourceMaps, bytecodeToFilename)
+		declaredEvents := abi.Events(abis)
+		events := make(map[int]string)
+		for _, log := range trace.Logs(steps) {
+			events[log.Step.Index] = abi.DecodeLog(log.Topics, log.Data, declaredEvents)
+		}
 
-			// It's not currently useful to display duplicate execution steps
-			if nextLoc.ByteOffset == prevLoc.ByteOffset &&
-				nextLoc.ByteLength == prevLoc.ByteLength &&
-				nextLoc.SourceFileName == prevLoc.SourceFileName {
-				continue
-			} else {
-				prevLoc = nextLoc
-			}
+		page, err := viewer.TraceHTML(
+			txnHash,
+			steps,
+			func(location srclocation.SourceLocation) string {
+				return ast.FunctionName(asts, location)
+			},
+			events,
+		)
+		common.Check(err)
 
-			markedUpSource, err := nextLoc.LocationMarkup()
-			if err != nil {
-				continue
-			}
+		pageFileName := workingDir + "/" + txnHash + ".html"
+		common.Check(ioutil.WriteFile(pageFileName, page, 0644))
+		fmt.Printf("Wrote %s\n", pageFileName)
+	} else {
+		dirName = workingDir + "/" + contractName
 
-			writeLocFile(markedUpSource, uint(i))
+		if _, err := os.Stat(dirName); os.IsNotExist(err) {
+			os.MkdirAll(dirName, 0711)
+		} else {
+			common.Check(err)
 		}
-	} else {
-		ast, err := ast.Get(viper.GetString("contracts_dir") + "/" + contractName)
+
+		ast, err := ast.Get(ctx, compiler(), viper.GetString("contracts_dir") + "/" + contractName)
 		common.Check(err)
 		displayTree(ast)
 	}
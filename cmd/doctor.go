@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/setup"
+)
+
+func init() {
+	doctorCmd.Flags().StringVar(&txnHash, "txn", "", "a transaction the tests sent, to compare the code it called with the compiled contracts (default is the latest one)")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the config",
+	Long: `Checks that contracts_dir has contracts that solc compiles with solc_args,
+that the chain the tests run against answers the trace methods solstice uses,
+and that the code a transaction on it called is one of the compiled contracts.
+Each failed check says what to do about it.`,
+	Run: Doctor,
+}
+
+func Doctor(cmd *cobra.Command, args []string) {
+	results := setup.Doctor(context.Background(), coverageConfig(), txnHash)
+
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("[%-4s] %s\n", result.Status, result.Check)
+		for _, line := range strings.Split(result.Detail, "\n") {
+			fmt.Printf("       %s\n", line)
+		}
+		if result.Status == setup.Failed {
+			failed++
+		}
+	}
+	if failed != 0 {
+		common.Check(fmt.Errorf("%d of the %d checks failed.", failed, len(results)))
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srcmap"
+)
+
+// Exit codes, so that scripts can tell why solstice failed. exitFailure is
+// for any other error, and for checks like diff-cover's threshold failing.
+const (
+	exitFailure           = 1
+	exitUsage             = 2
+	exitTxNotFound        = 3
+	exitNoBytecode        = 4
+	exitSourceMapMismatch = 5
+	exitCompileFailed     = 6
+	exitTestsFailed       = 7
+	exitNodeUnreachable   = 8
+)
+
+// The exit code of each kind of error, and a hint at what to do about it.
+var knownErrors = []struct {
+	err  error
+	code int
+	hint string
+}{
+	{parity.ErrTxNotFound, exitTxNotFound, "Check the transaction hash, and that blockchain_client is the node that mined it."},
+	{parity.ErrNoBytecode, exitNoBytecode, "The transaction didn't call a contract, so there's nothing to trace."},
+	{parity.ErrNoTraceSteps, exitNoBytecode, "The transaction didn't run any code."},
+	{srcmap.ErrSourceMapMismatch, exitSourceMapMismatch, "Check that solc_args and the version of solc match the ones the deployed contracts were compiled with."},
+	{solc.ErrCompileFailed, exitCompileFailed, "Check that solc is installed, and that contracts_dir and solc_args are right."},
+	{coverage.ErrTestsFailed, exitTestsFailed, ""},
+	{coverage.ErrInvalidConfig, exitUsage, "Run 'solstice doctor' to check the config, or 'solstice init' to write one."},
+	{syscall.ECONNREFUSED, exitNodeUnreachable, "Check that the node is running and that blockchain_client is its URL, or set backend to embedded."},
+}
+
+// Prints an error and a hint at what to do about it, if there is one, and
+// exits with its code.
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			if known.hint != "" {
+				fmt.Fprintln(os.Stderr, known.hint)
+			}
+			os.Exit(known.code)
+		}
+	}
+	os.Exit(exitFailure)
+}
+
+// Turns the panics of common.Check into friendly errors. Any other panic is
+// a bug, so it's left to print its stack trace.
+func recoverFailure() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	failure, ok := recovered.(common.Failure)
+	if !ok {
+		panic(recovered)
+	}
+	exitWithError(failure.Err)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/gas"
+)
+
+var gasThreshold float64
+var failOnRegression bool
+
+func init() {
+	gasDiffCmd.Flags().Float64Var(&gasThreshold, "threshold", 0, "the percentage increase in gas above which a change counts as a regression")
+	gasDiffCmd.Flags().BoolVar(&failOnRegression, "fail", false, "exit with a non-zero status if there are any regressions")
+	rootCmd.AddCommand(gasDiffCmd)
+}
+
+var gasDiffCmd = &cobra.Command{
+	Use:   "gas-diff base.json head.json",
+	Short: "Compares the gas reports of two runs",
+	Long: `Compares the per-function and per-line gas reports written by two runs of
+'solstice cover', and prints the differences as Markdown suitable for a pull
+request comment. Increases over the threshold are highlighted as regressions.`,
+	Args: cobra.ExactArgs(2),
+	Run:  GasDiff,
+}
+
+func GasDiff(cmd *cobra.Command, args []string) {
+	baseReport, err := gas.ReadJSON(args[0])
+	common.Check(err)
+
+	headReport, err := gas.ReadJSON(args[1])
+	common.Check(err)
+
+	comparison := gas.Compare(baseReport, headReport, gasThreshold)
+	fmt.Print(comparison.Markdown())
+
+	if failOnRegression && comparison.Regressions() != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/setup"
+)
+
+var initFramework string
+var initContractsDir string
+var initTestCommand string
+var initBlockchainClient string
+var initYes bool
+var initForce bool
+
+func init() {
+	initCmd.Flags().StringVar(&initFramework, "framework", "", "hardhat, foundry or truffle (default is the one detected)")
+	initCmd.Flags().StringVar(&initContractsDir, "contracts-dir", "", "the directory of the .sol files (default is the framework's)")
+	initCmd.Flags().StringVar(&initTestCommand, "test-command", "", "the command that runs the tests (default is the framework's)")
+	initCmd.Flags().StringVar(&initBlockchainClient, "blockchain-client", "", "the URL of a node to run the tests against instead of the embedded chain")
+	initCmd.Flags().BoolVar(&initYes, "yes", false, "write the config without asking about each setting")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "overwrite an existing config file")
+	rootCmd.AddCommand(initCmd)
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Writes a config file for the project",
+	Long: `Writes config.yml, or the file given by --config, for the project in the
+working directory. It detects a Hardhat, Foundry or Truffle layout, solc on
+the PATH and a node running locally, and asks about each setting with what it
+found as the default. The flags set the defaults; with --yes, or when not
+run in a terminal, they're written without asking.`,
+	Run: Init,
+}
+
+func Init(cmd *cobra.Command, args []string) {
+	path := cfgFile
+	if path == "" {
+		path = "config.yml"
+	}
+	if _, err := os.Stat(path); err == nil && !initForce {
+		check(fmt.Errorf("%s already exists; pass --force to overwrite it", path), "not writing the config")
+	}
+
+	ctx := context.Background()
+	workingDir, err := os.Getwd()
+	common.Check(err)
+	detection, err := setup.Detect(ctx, workingDir)
+	common.Check(err)
+
+	if initFramework != "" {
+		detection.Framework = nil
+		for i, framework := range setup.Frameworks {
+			if framework.Name == initFramework {
+				detection.Framework = &setup.Frameworks[i]
+			}
+		}
+		if detection.Framework == nil {
+			check(fmt.Errorf("%q isn't hardhat, foundry or truffle", initFramework), "bad --framework")
+		}
+	}
+	printDetection(detection)
+
+	config := detection.Config()
+	if initContractsDir != "" {
+		config.ContractsDir, err = filepath.Abs(initContractsDir)
+		common.Check(err)
+	}
+	if initTestCommand != "" {
+		config.TestCommand = strings.Fields(initTestCommand)
+	}
+	if initBlockchainClient != "" {
+		config.BlockchainClient = initBlockchainClient
+		config.Backend = ""
+	}
+
+	if stdin, err := os.Stdin.Stat(); err == nil && stdin.Mode()&os.ModeCharDevice != 0 && !initYes {
+		input := bufio.NewReader(os.Stdin)
+		config.ContractsDir = ask(input, "contracts_dir", config.ContractsDir)
+		config.CoverageReportDir = ask(input, "coverage_report_dir", config.CoverageReportDir)
+		config.TestCommand = strings.Fields(ask(input, "test_command", strings.Join(config.TestCommand, " ")))
+		config.BlockchainClient = ask(input, "blockchain_client, or nothing for the embedded chain", config.BlockchainClient)
+		config.Backend = ""
+		if config.BlockchainClient == "" {
+			config.Backend = "embedded"
+		}
+	}
+
+	common.Check(config.Write(path, initForce))
+	fmt.Printf("\nWrote %s. Run 'solstice doctor' to check it.\n", path)
+	if len(config.TestCommand) == 0 {
+		fmt.Println("test_command is empty; set it to a command that sends the tests' transactions to $SOLSTICE_RPC_URL.")
+	}
+}
+
+func printDetection(detection setup.Detection) {
+	if detection.Framework != nil {
+		fmt.Printf("Framework: %s\n", detection.Framework.Name)
+		if detection.Framework.Name == "foundry" {
+			fmt.Println("    forge test runs the tests in an EVM of its own, so solstice can't see their transactions;")
+			fmt.Println("    run scripts that broadcast to $SOLSTICE_RPC_URL instead.")
+		}
+	} else {
+		fmt.Println("Framework: none detected")
+	}
+
+	if detection.SolcVersion != "" {
+		fmt.Printf("solc: %s\n", detection.SolcVersion)
+	} else {
+		fmt.Println("solc: not on the PATH; install the version your contracts are compiled with")
+	}
+
+	switch {
+	case detection.NodeURL == "":
+		fmt.Println("Node: none running, so the embedded chain will be used")
+	case detection.NodeTraces:
+		fmt.Printf("Node: %s, which traces transactions\n", detection.NodeURL)
+	default:
+		fmt.Printf("Node: %s, which doesn't trace transactions, so the embedded chain will be used\n", detection.NodeURL)
+		fmt.Println("    The embedded chain serves on embedded_address, localhost:8545 by default; stop the node before")
+		fmt.Println("    running solstice cover if it's on the same address.")
+	}
+}
+
+// Asks for a setting, returning the default if nothing is typed.
+func ask(input *bufio.Reader, setting string, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", setting, defaultValue)
+	answer, _ := input.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return defaultValue
+}
@@ -3,17 +3,17 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"math/big"
 	"os/exec"
 	"strings"
 
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
     "github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/coverage"
 	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
 	"github.com/reserve-protocol/solstice/parity"
 	"github.com/reserve-protocol/solstice/srcmap"
 )
@@ -30,13 +30,13 @@ var lineCoverCmd = &cobra.Command{
 }
 
 func CoverLine(cmd *cobra.Command, args []string) {
-	client, err := ethclient.Dial(viper.GetString("blockchain_client"))
+	ctx := context.Background()
+	client, err := ethclient.DialContext(ctx, viper.GetString("blockchain_client"))
 	common.Check(err)
 
-	sourceMaps, bytecodeToFilename, err := srcmap.Get()
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
 	common.Check(err)
 
-	ctx := context.Background()
 	headerBeforeTests, err := client.HeaderByNumber(ctx, nil)
 	common.Check(err)
 	fmt.Printf("Start block number: %v\n", headerBeforeTests.Number)
@@ -44,7 +44,8 @@ func CoverLine(cmd *cobra.Command, args []string) {
 	// Run tests
 	{
 		args := viper.GetStringSlice("test_command")
-		cmd := exec.Command(
+		cmd := exec.CommandContext(
+			ctx,
 			args[0],
 			args[1:]...,
 		)
@@ -52,7 +53,7 @@ func CoverLine(cmd *cobra.Command, args []string) {
 		if output, err := cmd.CombinedOutput(); err != nil {
 			fmt.Printf("Tests return %v: %s\n", err, output)
 			if err.Error() != "exit status 1" || string(output) != "" {
-				panic(err)
+				common.Check(fmt.Errorf("%w: %v", coverage.ErrTestsFailed, err))
 			}
 		}
 	}
@@ -61,25 +62,6 @@ func CoverLine(cmd *cobra.Command, args []string) {
 	common.Check(err)
 	fmt.Printf("Ending block number: %v\n", blockAfterTests.Number())
 
-	// Build list of all transactions
-	var txns []*types.Transaction
-	for blockNumber := headerBeforeTests.Number; blockNumber.Cmp(blockAfterTests.Number()) < 0; blockNumber.Add(blockNumber, big.NewInt(1)) {
-		var oneMore big.Int
-		oneMore.Add(blockNumber, big.NewInt(1))
-		block, err := client.BlockByNumber(ctx, &oneMore)
-		common.Check(err)
-		for _, txn := range block.Transactions() {
-			if txn.To() != nil {
-				bytecode, err := client.CodeAt(ctx, *txn.To(), block.Number())
-				common.Check(err)
-				// If it's a function call and not just an ETH txn
-				if len(bytecode) != 0 {
-					txns = append(txns, txn)
-				}
-			}
-		}
-	}
-
 	// We have a list of contract names, but we need a list of file names; there can be many contracts per file.
 	var sourceFileName []string
 	{
@@ -103,26 +85,31 @@ func CoverLine(cmd *cobra.Command, args []string) {
 	}
 
 	// Fill the coverage report
-	for _, txn := range txns {
-		execTrace, err := parity.GetExecTrace(fmt.Sprintf("0x%x", txn.Hash()))
-		common.Check(err)
+	firstBlock, lastBlock := headerBeforeTests.Number.Uint64()+1, blockAfterTests.NumberU64()
+	common.Check(newFetcher(ctx).BlockTraces(ctx, firstBlock, lastBlock, func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
 		pcToOpIndex := evmbytecode.GetPcToOpIndex(execTrace.Code)
 		contractName := bytecodeToFilename[evmbytecode.RemoveMetaData(execTrace.Code)]
 		if contractName == "" {
-			continue
+			return nil
 		}
 		for _, traceOp := range execTrace.Ops {
-			location := sourceMaps[contractName][pcToOpIndex[traceOp.PC]]
+			location, err := srcmap.Location(sourceMaps[contractName], pcToOpIndex, traceOp.PC)
+			if err != nil {
+				return fmt.Errorf("%s: %w", txn.Hash, err)
+			}
 			if location.ByteLength == -1 || location.ByteOffset == -1 || location.SourceFileName == "" {
 				continue
 			}
 
 			lineNumber, _, _, err := location.ByteLocToSnippet()
-			common.Check(err)
+			if err != nil {
+				return err
+			}
 
 			coverage[location.SourceFileName][lineNumber] += 1
 		}
-	}
+		return nil
+	}))
 
 	// Print the coverage report
 	for filename, lines := range coverage {
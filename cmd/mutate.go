@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/linecov"
+	"github.com/reserve-protocol/solstice/mutation"
+	"github.com/reserve-protocol/solstice/solc"
+)
+
+func init() {
+	rootCmd.AddCommand(mutateCmd)
+}
+
+var mutateCmd = &cobra.Command{
+	Use:   "mutate",
+	Short: "Checks that the tests catch small changes to the contracts",
+	Long: `Makes small changes, called mutants, to the contracts in the contracts dir,
+such as flipping a comparison or removing a require, and runs the tests
+against each one. A mutant that the tests still pass with has survived, which
+points to behavior that is run but never checked.
+
+Mutants on lines that the last run of cover never ran are counted as surviving
+without running the tests. If the chain supports evm_snapshot, it's reverted
+to the same state before each run of the tests. The results are written to
+mutation_report.html in the coverage_report_dir.`,
+	Run: Mutate,
+}
+
+func Mutate(cmd *cobra.Command, args []string) {
+	// An interrupt cancels the run in progress, so that the mutant is put
+	// back and the chain stopped before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	cfg := coverageConfig()
+	common.Check(cfg.Validate())
+	contracts, err := cfg.Compiler.Contracts()
+	common.Check(err)
+	inContractsDir := make(map[string]bool)
+	for _, contract := range contracts {
+		inContractsDir[contract] = true
+	}
+
+	trees, err := ast.GetAll(ctx, cfg.Compiler)
+	common.Check(err)
+	for fileName := range trees {
+		// Libraries that are imported from elsewhere aren't being tested.
+		if !inContractsDir[fileName] {
+			delete(trees, fileName)
+		}
+	}
+	mutants, err := mutation.Generate(trees)
+	common.Check(err)
+
+	lineCoverage, err := linecov.ReadJSON(filepath.Join(cfg.ReportDir, "line_coverage.json"))
+	if err != nil {
+		fmt.Printf("No line coverage to skip unrun code with (%v); run 'solstice cover' first to save time.\n", err)
+	}
+
+	// Each run gets a fresh chain if solstice runs it, and otherwise starts
+	// from a snapshot if the chain supports them.
+	blockchainClient := cfg.BlockchainClient
+	var snapshot string
+	if !cfg.RunsChain() {
+		snapshot, err = chain.Snapshot(ctx, blockchainClient)
+		if err != nil {
+			fmt.Printf("The chain can't be snapshotted (%v), so each run starts where the last one ended.\n", err)
+		}
+	}
+	runTests := func() bool {
+		testChain, err := coverage.StartChain(ctx, cfg)
+		if ctx.Err() != nil {
+			return false
+		}
+		common.Check(err)
+		defer testChain.Stop()
+		if snapshot != "" {
+			err := chain.Revert(ctx, blockchainClient, snapshot)
+			if err == nil {
+				snapshot, err = chain.Snapshot(ctx, blockchainClient)
+			}
+			if ctx.Err() != nil {
+				return false
+			}
+			common.Check(err)
+		}
+		args := cfg.TestCommand
+		command := exec.CommandContext(ctx, args[0], args[1:]...)
+		command.Env = append(os.Environ(), "SOLSTICE_RPC_URL="+testChain.URL)
+		return command.Run() == nil
+	}
+
+	if !runTests() {
+		exitIfInterrupted(ctx)
+		common.Check(fmt.Errorf("%w without any mutants, so the mutants can't be judged.", coverage.ErrTestsFailed))
+	}
+
+	var results []mutation.Result
+	for i, mutant := range mutants {
+		status := mutation.NotCovered
+		if hits, ok := lineCoverage[mutant.File][mutant.Line]; !ok || hits != 0 {
+			status = tryMutant(ctx, cfg.Compiler, mutant, contracts, runTests)
+			exitIfInterrupted(ctx)
+		}
+		results = append(results, mutation.Result{Mutant: mutant, Status: status})
+		fmt.Printf("[%d/%d] %s:%d %s: %s\n", i+1, len(mutants), mutant.File, mutant.Line, mutant.Description, status)
+	}
+
+	fmt.Println()
+	common.Check(mutation.PrintSummary(os.Stdout, results))
+
+	page, err := mutation.HTMLReport(results)
+	common.Check(err)
+	common.Check(os.MkdirAll(cfg.ReportDir, 0711))
+	reportFileName := filepath.Join(cfg.ReportDir, "mutation_report.html")
+	common.Check(ioutil.WriteFile(reportFileName, page, 0644))
+	fmt.Printf("Wrote %s\n", reportFileName)
+}
+
+// Runs the tests with the mutant in place, putting the original source back
+// afterwards.
+func tryMutant(ctx context.Context, compiler solc.Compiler, mutant mutation.Mutant, contracts []string, runTests func() bool) mutation.Status {
+	info, err := os.Stat(mutant.File)
+	common.Check(err)
+	original, err := ioutil.ReadFile(mutant.File)
+	common.Check(err)
+
+	restore := func() {
+		if err := ioutil.WriteFile(mutant.File, original, info.Mode()); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't put %s back as it was, so it still has a mutant: %v\n", mutant.File, err)
+		}
+	}
+
+	common.Check(ioutil.WriteFile(mutant.File, mutant.Apply(original), info.Mode()))
+	defer restore()
+
+	if _, err := compiler.CombinedJSON(ctx, "bin-runtime", contracts); err != nil {
+		return mutation.Stillborn
+	}
+	if runTests() {
+		return mutation.Survived
+	}
+	return mutation.Killed
+}
+
+// Exits once an interrupted run has been cleaned up after.
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted.")
+		os.Exit(130)
+	}
+}
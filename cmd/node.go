@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/devchain"
+)
+
+func init() {
+	rootCmd.AddCommand(nodeCmd)
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Runs the embedded development chain",
+	Long: `Runs the development chain that solstice cover uses when backend is
+"embedded", on embedded_address, until interrupted. It answers
+trace_replayTransaction from the traces recorded as transactions were mined,
+so debug, display, step and watch can be pointed at it.`,
+	Run: Node,
+}
+
+func Node(cmd *cobra.Command, args []string) {
+	chain, server := startDevchain()
+	defer chain.Close()
+	defer server.Close()
+
+	fmt.Printf("Serving the embedded chain on %s\nAccounts and their private keys:\n", server.URL())
+	for _, account := range chain.Accounts() {
+		fmt.Printf("    %s %s\n", account.Hex(), chain.PrivateKey(account))
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	<-interrupts
+}
+
+func startDevchain() (*devchain.Chain, *devchain.Server) {
+	chain, err := devchain.New(devchain.Config{Accounts: viper.GetInt("embedded_accounts")})
+	common.Check(err)
+	server, err := devchain.NewServer(chain)
+	common.Check(err)
+	common.Check(server.Listen(viper.GetString("embedded_address")))
+	return chain, server
+}
@@ -20,9 +20,10 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+    defer recoverFailure()
     if err := rootCmd.Execute(); err != nil {
         fmt.Println(err)
-        os.Exit(1)
+        os.Exit(exitUsage)
     }
 }
 
@@ -33,6 +34,8 @@ func init() {
     // Cobra supports persistent flags, which, if defined here,
     // will be global for your application.
     rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.yml)")
+    rootCmd.PersistentFlags().Bool("offline", false, "read traces from the trace cache instead of blockchain_client")
+    viper.BindPFlag("offline", rootCmd.PersistentFlags().Lookup("offline"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -51,6 +54,13 @@ func initConfig() {
     }
 
     viper.AutomaticEnv() // read in environment variables that match
+    viper.SetDefault("embedded_address", "localhost:8545")
+    viper.SetDefault("node_startup_timeout", "30s")
+
+    // init writes the config file, so it needn't exist yet.
+    if command, _, err := rootCmd.Find(os.Args[1:]); err == nil && command == initCmd {
+        return
+    }
 
     // If a config file is found, read it in.
     err = viper.ReadInConfig()
@@ -65,6 +75,6 @@ func initConfig() {
 func check(err error, msg string) {
     if err != nil {
         fmt.Fprintf(os.Stderr, "%v: %v\n", msg, err)
-        os.Exit(1)
+        os.Exit(exitUsage)
     }
 }
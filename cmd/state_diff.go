@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/calltree"
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/storage"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+func init() {
+	stateDiffCmd.Flags().StringVar(&txnHash, "txn", "", "the hash of a transaction to show the state changes of")
+	stateDiffCmd.MarkFlagRequired("txn")
+	rootCmd.AddCommand(stateDiffCmd)
+}
+
+var stateDiffCmd = &cobra.Command{
+	Use:   "state-diff",
+	Short: "Shows the state variables a transaction changed",
+	Long: `Shows the changes a transaction made to the storage of each contract it
+touched, by state variable, e.g. "balances[0xabc...] : 100 -> 40". Mapping
+keys and array indexes are recovered from the hashes computed during the
+transaction. Each account is named by the code that ran in it during the
+transaction; the node is only asked for the code of accounts the transaction
+didn't run, and only when online. Storage of contracts that aren't in the
+contracts dir is shown by slot.`,
+	Run: StateDiff,
+}
+
+func StateDiff(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	execTrace, err := parity.GetExecTrace(ctx, traceConfig(), txnHash, "trace", "stateDiff")
+	common.Check(err)
+
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
+	common.Check(err)
+
+	layouts, err := storage.Get(ctx, compiler())
+	common.Check(err)
+
+	steps := trace.Flatten(execTrace.VMTrace, sourceMaps, bytecodeToFilename)
+	preimages := storage.GetPreimages(steps)
+
+	root := calltree.Build(steps)
+	if len(execTrace.Trace) != 0 {
+		// The first call in Parity's trace is the transaction itself.
+		transaction := execTrace.Trace[0]
+		if transaction.Type == "create" {
+			root.Type = "CREATE"
+			if transaction.Result != nil {
+				root.Address = transaction.Result.Address
+			}
+		} else {
+			root.Type = strings.ToUpper(transaction.Action.CallType)
+			root.Address = transaction.Action.To
+		}
+	}
+	accounts := storage.Accounts(root, layouts)
+
+	var addresses []string
+	for address, accountDiff := range execTrace.StateDiff {
+		if len(accountDiff.Storage) != 0 {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	if len(addresses) == 0 {
+		fmt.Println("No storage was changed.")
+		return
+	}
+
+	var missing []string
+	for _, address := range addresses {
+		if _, ok := accounts[strings.ToLower(address)]; !ok {
+			missing = append(missing, address)
+		}
+	}
+	if len(missing) != 0 && !traceConfig().Offline {
+		common.Check(nameFromNode(ctx, accounts, missing, bytecodeToFilename))
+	}
+
+	for _, address := range addresses {
+		contract := accounts[strings.ToLower(address)]
+		if contract == "" {
+			fmt.Printf("%s (unknown contract)\n", address)
+		} else {
+			fmt.Printf("%s (%s)\n", address, contract)
+		}
+
+		accountDiff := execTrace.StateDiff[address]
+		var slots []string
+		for slot := range accountDiff.Storage {
+			slots = append(slots, slot)
+		}
+		sort.Strings(slots)
+
+		layout := layouts[contract]
+		for _, slot := range slots {
+			diff := accountDiff.Storage[slot]
+			if !diff.Changed {
+				continue
+			}
+			for _, change := range layout.DecodeSlot(slot, diff.From, diff.To, preimages) {
+				fmt.Printf("    %s : %s -> %s\n", change.Path, change.From, change.To)
+			}
+		}
+	}
+}
+
+// Names the given accounts from their code at the end of the transaction's
+// block, for accounts whose code didn't run in the transaction.
+func nameFromNode(
+	ctx context.Context,
+	accounts map[string]string,
+	addresses []string,
+	bytecodeToFilename map[string]string,
+) error {
+	rpcClient, err := rpc.DialContext(ctx, traceConfig().URL)
+	if err != nil {
+		return err
+	}
+	defer rpcClient.Close()
+
+	// go-ethereum's receipts don't carry the block number, so it's read from
+	// the JSON.
+	var receipt struct {
+		BlockNumber *hexutil.Big
+	}
+	if err := rpcClient.CallContext(ctx, &receipt, "eth_getTransactionReceipt", txnHash); err != nil {
+		return err
+	}
+	if receipt.BlockNumber == nil {
+		return fmt.Errorf("Transaction %s hasn't been mined.", txnHash)
+	}
+
+	client := ethclient.NewClient(rpcClient)
+	for _, address := range addresses {
+		code, err := client.CodeAt(ctx, ethcommon.HexToAddress(address), receipt.BlockNumber.ToInt())
+		if err != nil {
+			return err
+		}
+		accounts[strings.ToLower(address)] = bytecodeToFilename[evmbytecode.RemoveMetaData(hexutil.Encode(code))]
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/debugger"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/trace"
+	"github.com/reserve-protocol/solstice/variables"
+)
+
+func init() {
+	stepCmd.Flags().StringVar(&txnHash, "txn", "", "the hash of a transaction to step through")
+	stepCmd.MarkFlagRequired("txn")
+	rootCmd.AddCommand(stepCmd)
+}
+
+var stepCmd = &cobra.Command{
+	Use:   "step",
+	Short: "Steps through a transaction in an interactive debugger",
+	Long: `Replays the recorded trace of a transaction in a terminal debugger, one
+source location at a time. Type 'help' at the prompt for the commands.`,
+	Run: Step,
+}
+
+const stepHelp = `Commands:
+  s, step         step into the next source location
+  n, next         step over function calls
+  o, out          step out of the current function
+  c, continue     continue to the next breakpoint
+  b FILE:LINE     set a breakpoint
+  bt              print the call stack, with the variables of each frame
+  v, vars         print the arguments and local variables of the current function
+  stack           print the EVM stack
+  memory          print the EVM memory
+  storage         print the storage slots written so far
+  l, list         show the source around the current step
+  h, help         show this help
+  q, quit         quit
+`
+
+func Step(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	execTrace, err := parity.GetExecTrace(ctx, traceConfig(), txnHash)
+	common.Check(err)
+
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
+	common.Check(err)
+
+	asts, err := ast.GetAll(ctx, compiler())
+	common.Check(err)
+
+	debug := debugger.New(trace.Flatten(execTrace.VMTrace, sourceMaps, bytecodeToFilename))
+	printCurrentStep(debug, asts)
+
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(solstice) ")
+		if !input.Scan() {
+			return
+		}
+
+		fields := strings.Fields(input.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			moveTo(debug, asts, debug.StepInto())
+		case "n", "next":
+			moveTo(debug, asts, debug.StepOver())
+		case "o", "out":
+			moveTo(debug, asts, debug.StepOut())
+		case "c", "continue":
+			hit, err := debug.Continue()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if !hit {
+				fmt.Println("No breakpoint hit before the end of the transaction.")
+			}
+			printCurrentStep(debug, asts)
+		case "b", "break":
+			if len(fields) != 2 {
+				fmt.Println("Usage: b FILE:LINE")
+				continue
+			}
+			breakpoint, err := debugger.ParseBreakpoint(fields[1])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			debug.Breakpoints = append(debug.Breakpoints, breakpoint)
+			fmt.Printf("Breakpoint %d at %s:%d\n", len(debug.Breakpoints), breakpoint.File, breakpoint.Line)
+		case "bt":
+			printStackTrace(debug.Step().Stack(), variables.AtStep(asts, debug.Steps, debug.Step()), asts)
+		case "v", "vars":
+			printVariables(variables.AtStep(asts, debug.Steps, debug.Step())[0], "")
+		case "stack":
+			stack := debug.State().Stack
+			for i := len(stack) - 1; i >= 0; i-- {
+				fmt.Printf("%3d: %s\n", len(stack)-1-i, stack[i])
+			}
+		case "memory":
+			memory := debug.State().Memory
+			for offset := 0; offset < len(memory); offset += 32 {
+				end := offset + 32
+				if end > len(memory) {
+					end = len(memory)
+				}
+				fmt.Printf("0x%04x: %s\n", offset, hex.EncodeToString(memory[offset:end]))
+			}
+		case "storage":
+			storage := debug.State().Storage
+			var keys []string
+			for key := range storage {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("%s: %s\n", key, storage[key])
+			}
+		case "l", "list":
+			printSourceWindow(debug)
+		case "h", "help":
+			fmt.Print(stepHelp)
+		case "q", "quit":
+			return
+		default:
+			fmt.Printf("Unknown command %q. Type 'help' for the commands.\n", fields[0])
+		}
+	}
+}
+
+func moveTo(debug *debugger.Debugger, asts map[string]ast.AST, moved bool) {
+	if !moved {
+		fmt.Println("End of the transaction.")
+		return
+	}
+	printCurrentStep(debug, asts)
+}
+
+func printCurrentStep(debug *debugger.Debugger, asts map[string]ast.AST) {
+	step := debug.Step()
+	fmt.Printf(
+		"Step %d/%d, %s, gas left %d, in %s\n",
+		step.Index+1,
+		len(debug.Steps),
+		evmbytecode.OpCodeName(step.OpCode),
+		step.Op.Ex.Used,
+		ast.FunctionName(asts, step.SrcLoc),
+	)
+	printSourceWindow(debug)
+}
+
+func printSourceWindow(debug *debugger.Debugger) {
+	window, err := debug.SourceWindow(3)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(window)
+}
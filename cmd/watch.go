@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/reserve-protocol/solstice/common"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/covloc"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/srcmap"
+)
+
+var watchAddress string
+var watchInterval time.Duration
+var watchFromBlock int64
+
+// How many times a block is tried before it's skipped.
+const maxBlockFailures = 5
+
+func init() {
+	watchCmd.Flags().StringVar(&watchAddress, "address", "localhost:8090", "the address to serve the live report on")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", time.Second, "how often to check for new blocks")
+	watchCmd.Flags().Int64Var(&watchFromBlock, "from-block", -1, "the first block to trace (default is the next one mined)")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Collects coverage from a running node as transactions arrive",
+	Long: `Watches the blockchain client for new blocks, traces each contract
+transaction in them as it arrives, and serves a coverage report that refreshes
+itself as coverage grows. This is useful for seeing what interactive or manual
+testing covers.`,
+	Run: Watch,
+}
+
+// The coverage collected so far, shared between the watcher and the server.
+type liveCoverage struct {
+	lock        sync.Mutex
+	coverageMap map[string][]covloc.CoverageLoc
+	lastBlock   uint64
+	txns        int
+}
+
+func Watch(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	client, err := ethclient.DialContext(ctx, viper.GetString("blockchain_client"))
+	common.Check(err)
+
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, compiler())
+	common.Check(err)
+
+	coverageMap, err := coverage.NewMap(ctx, compiler())
+	common.Check(err)
+	live := &liveCoverage{coverageMap: coverageMap}
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	common.Check(err)
+	live.lastBlock = header.Number.Uint64()
+	if watchFromBlock == 0 {
+		// The genesis block has no transactions.
+		live.lastBlock = 0
+	} else if watchFromBlock > 0 {
+		live.lastBlock = uint64(watchFromBlock) - 1
+	}
+
+	fetcher := newFetcher(ctx)
+	go func() {
+		common.Check(http.ListenAndServe(watchAddress, live))
+	}()
+	fmt.Printf("Serving the coverage report on http://%s/\n", watchAddress)
+
+	// How many times in a row the next block has failed to trace.
+	failures := 0
+	for ; ; time.Sleep(watchInterval) {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			fmt.Printf("Couldn't get the latest block: %v\n", err)
+			continue
+		}
+
+		for live.lastBlock < header.Number.Uint64() {
+			var execTraces []parity.ExecTrace
+			err := fetcher.BlockTraces(ctx, live.lastBlock+1, live.lastBlock+1, func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+				execTraces = append(execTraces, execTrace)
+				return nil
+			})
+			if err != nil {
+				// Try the block again on the next round, unless it has failed
+				// too often to be likely to succeed.
+				failures++
+				if failures < maxBlockFailures {
+					fmt.Printf("Couldn't trace block %d: %v\n", live.lastBlock+1, err)
+					break
+				}
+				fmt.Printf("Skipping block %d after it failed to trace %d times, so its coverage is left out: %v\n", live.lastBlock+1, failures, err)
+				execTraces = nil
+			}
+			failures = 0
+
+			live.lock.Lock()
+			for _, execTrace := range execTraces {
+				if err := live.add(execTrace, sourceMaps, bytecodeToFilename); err != nil {
+					fmt.Printf("Couldn't add the coverage of a transaction in block %d: %v\n", live.lastBlock+1, err)
+				}
+			}
+			live.lastBlock++
+			live.lock.Unlock()
+		}
+	}
+}
+
+// Adds the coverage of a trace. The lock must be held.
+func (live *liveCoverage) add(
+	execTrace parity.ExecTrace,
+	sourceMaps map[string][]srclocation.SourceLocation,
+	bytecodeToFilename map[string]string,
+) error {
+	contractName := bytecodeToFilename[evmbytecode.RemoveMetaData(execTrace.Code)]
+	if contractName == "" {
+		return nil
+	}
+	pcToOpIndex := evmbytecode.GetPcToOpIndex(execTrace.Code)
+
+	live.txns++
+	for _, traceOp := range execTrace.Ops {
+		traceLoc, err := srcmap.Location(sourceMaps[contractName], pcToOpIndex, traceOp.PC)
+		if err != nil {
+			return err
+		}
+		if traceLoc.ByteLength <= 0 || traceLoc.ByteOffset == -1 || traceLoc.SourceFileName == "" {
+			continue
+		}
+		coverage.AddHit(live.coverageMap, traceLoc)
+	}
+	return nil
+}
+
+// The fraction of coverage locations in the file that ran.
+func coveredFraction(locs []covloc.CoverageLoc) (int, int) {
+	covered, total := 0, 0
+	for _, loc := range locs {
+		if loc.CoverageRange.ByteLength == 0 {
+			continue
+		}
+		total++
+		if loc.HitCount != 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+const liveHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="2">
+<title>%s</title>
+<style>body { font-family: sans-serif; margin: 16px; } pre { font-size: 13px; }</style>
+</head>
+<body>
+`
+
+// Serves an index of the files at /, and each file's marked up source at
+// /file?name=<file name>. Pages reload themselves every couple of seconds.
+func (live *liveCoverage) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	live.lock.Lock()
+	defer live.lock.Unlock()
+
+	switch request.URL.Path {
+	case "/":
+		fmt.Fprintf(writer, liveHeader, "Live coverage")
+		fmt.Fprintf(writer, "<h1>Live coverage</h1>\n<p>Traced %d transactions, up to block %d.</p>\n<ul>\n", live.txns, live.lastBlock)
+
+		var filenames []string
+		for filename := range live.coverageMap {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			covered, total := coveredFraction(live.coverageMap[filename])
+			fmt.Fprintf(
+				writer,
+				"<li><a href=\"/file?name=%s\">%s</a>: %d of %d ranges covered</li>\n",
+				url.QueryEscape(filename),
+				html.EscapeString(filename),
+				covered,
+				total,
+			)
+		}
+		fmt.Fprint(writer, "</ul>\n</body>\n</html>\n")
+	case "/file":
+		filename := request.URL.Query().Get("name")
+		locs, ok := live.coverageMap[filename]
+		if !ok {
+			http.NotFound(writer, request)
+			return
+		}
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(writer, liveHeader, html.EscapeString(filename))
+		fmt.Fprintf(writer, "<p><a href=\"/\">All files</a></p>\n<h3>%s</h3>\n", html.EscapeString(filename))
+		fmt.Fprint(writer, coverage.MarkUp(source, locs, func(srclocation.SourceLocation) string { return "" }))
+		fmt.Fprint(writer, "\n</body>\n</html>\n")
+	default:
+		http.NotFound(writer, request)
+	}
+}
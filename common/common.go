@@ -6,13 +6,17 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/spf13/viper"
 )
 
+// What Check panics with, so that the CLI can tell the errors it checked for
+// from bugs, and print them without a stack trace.
+type Failure struct {
+	Err error
+}
+
 func Check(err error) {
 	if err != nil {
-		panic(err)
+		panic(Failure{err})
 	}
 }
 
@@ -24,9 +28,10 @@ func NumberOfLines(filename string) (int, error) {
 	return bytes.Count(b, []byte{'\n'}), nil
 }
 
-func AllContracts() ([]string, error) {
+// The .sol files under dir.
+func AllContracts(dir string) ([]string, error) {
 	var filenames []string
-	err := filepath.Walk(viper.GetString("contracts_dir"), func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,122 @@
+package coverage
+
+import (
+	"fmt"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/covloc"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/gas"
+	"github.com/reserve-protocol/solstice/linecov"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/testcov"
+)
+
+// Fills the coverage, gas, line and per-test reports op by op, so that a
+// trace never has to be held in memory as a whole. Only the ops of the
+// contract a transaction was sent to count, not those of the contracts it
+// called.
+type coverageAccumulator struct {
+	sourceMaps         map[string][]srclocation.SourceLocation
+	bytecodeToFilename map[string]string
+	abis               map[string][]abi.Entry
+	testRanges         []testcov.TestRange
+
+	coverageMap  map[string][]covloc.CoverageLoc
+	gasCollector *gas.Collector
+	lineCoverage *linecov.Collector
+	testCoverage *testcov.Collector
+
+	pcToOpIndexes map[string]map[int]int
+	txns          map[string]*txnAccumulator
+}
+
+// What's known so far about a transaction whose trace is being read.
+type txnAccumulator struct {
+	contractName string
+	function     string
+	test         string
+	gasBefore    int
+	gasUsed      int
+	started      bool
+}
+
+// Starts a transaction's trace. Ops of transactions that haven't been
+// started are ignored.
+func (accumulator *coverageAccumulator) start(txn fetch.Transaction, code string) {
+	contractName := accumulator.bytecodeToFilename[evmbytecode.RemoveMetaData(code)]
+	if contractName == "" {
+		return
+	}
+	if _, ok := accumulator.pcToOpIndexes[contractName]; !ok {
+		accumulator.pcToOpIndexes[contractName] = evmbytecode.GetPcToOpIndex(code)
+	}
+	accumulator.txns[txn.Hash] = &txnAccumulator{
+		contractName: contractName,
+		function:     abi.FunctionName(accumulator.abis[contractName], txn.Input),
+		test:         testcov.TestAt(accumulator.testRanges, txn.BlockNumber),
+	}
+}
+
+// Adds an op from the top level of a transaction's trace.
+func (accumulator *coverageAccumulator) addOp(hash string, op parity.Operation) error {
+	txn, ok := accumulator.txns[hash]
+	if !ok {
+		return nil
+	}
+
+	// An op's cost is the drop in gas remaining since the op before it. See
+	// VMTrace.GasCosts.
+	if !txn.started {
+		txn.gasBefore = op.Ex.Used + op.Cost
+		txn.started = true
+	}
+	gasCost := txn.gasBefore - op.Ex.Used
+	txn.gasBefore = op.Ex.Used
+	txn.gasUsed += gasCost
+
+	traceLoc, err := srcmap.Location(accumulator.sourceMaps[txn.contractName], accumulator.pcToOpIndexes[txn.contractName], op.PC)
+	if err != nil {
+		return fmt.Errorf("%s: %w", hash, err)
+	}
+	if traceLoc.ByteLength == -1 || traceLoc.ByteOffset == -1 || traceLoc.SourceFileName == "" {
+		return nil
+	}
+	accumulator.gasCollector.AddLocation(traceLoc, gasCost)
+	if traceLoc.ByteLength == 0 {
+		return nil
+	}
+	if err := accumulator.lineCoverage.AddHit(traceLoc); err != nil {
+		return err
+	}
+	if txn.test != "" {
+		if err := accumulator.testCoverage.Add(txn.test, traceLoc); err != nil {
+			return err
+		}
+	}
+	AddHit(accumulator.coverageMap, traceLoc)
+	return nil
+}
+
+// Adds a whole trace.
+func (accumulator *coverageAccumulator) addTrace(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+	accumulator.start(txn, execTrace.Code)
+	for _, op := range execTrace.Ops {
+		if err := accumulator.addOp(txn.Hash, op); err != nil {
+			return err
+		}
+	}
+	accumulator.finish(txn.Hash)
+	return nil
+}
+
+// Ends a transaction's trace, adding the gas it used to the gas report.
+func (accumulator *coverageAccumulator) finish(hash string) {
+	if txn, ok := accumulator.txns[hash]; ok {
+		accumulator.gasCollector.Add(txn.contractName, txn.function, txn.gasUsed)
+		delete(accumulator.txns, hash)
+	}
+}
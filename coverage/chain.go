@@ -0,0 +1,99 @@
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/devchain"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+// The chain a run of the tests sends its transactions to, at URL. Embedded
+// is set if it's the embedded chain, whose traces can be read directly.
+type TestChain struct {
+	URL      string
+	Embedded *devchain.Chain
+	stop     func()
+}
+
+// Stops the chain, if solstice started it.
+func (testChain *TestChain) Stop() {
+	testChain.stop()
+}
+
+// Whether solstice runs the chain the tests run against, so that each run of
+// the tests can have a fresh one.
+func (cfg Config) RunsChain() bool {
+	return cfg.Backend == "embedded" || len(cfg.NodeCommand) != 0
+}
+
+// Starts the chain for a run of the tests, if solstice runs it: the embedded
+// chain if Backend is "embedded", or else NodeCommand, waiting until it
+// answers on BlockchainClient. Otherwise the tests run against
+// BlockchainClient as it is.
+func StartChain(ctx context.Context, cfg Config) (*TestChain, error) {
+	if cfg.Backend == "embedded" {
+		embedded, err := devchain.New(devchain.Config{Accounts: cfg.EmbeddedAccounts})
+		if err != nil {
+			return nil, err
+		}
+		server, err := devchain.NewServer(embedded)
+		if err == nil {
+			err = server.Listen(cfg.EmbeddedAddress)
+		}
+		if err != nil {
+			embedded.Close()
+			return nil, err
+		}
+		return &TestChain{URL: server.URL(), Embedded: embedded, stop: func() {
+			server.Close()
+			embedded.Close()
+		}}, nil
+	}
+
+	if len(cfg.NodeCommand) == 0 {
+		return &TestChain{URL: cfg.BlockchainClient, stop: func() {}}, nil
+	}
+	node, err := chain.StartNode(ctx, cfg.NodeCommand, cfg.BlockchainClient, cfg.NodeStartupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &TestChain{URL: cfg.BlockchainClient, stop: node.Stop}, nil
+}
+
+// Takes a snapshot of the chain if SnapshotChain is set, and returns a
+// function that reverts the chain to it, so that the tests leave it as they
+// found it.
+func (engine *Engine) snapshotChain(ctx context.Context, url string) (func(), error) {
+	if !engine.cfg.SnapshotChain {
+		return func() {}, nil
+	}
+	snapshot, err := chain.Snapshot(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := chain.Revert(ctx, url, snapshot); err != nil {
+			fmt.Fprintf(engine.log, "Couldn't revert the chain to before the tests: %v\n", err)
+		}
+	}, nil
+}
+
+// Saves a trace recorded by the embedded chain to the cache, if there is
+// one, so that it can be used offline like a fetched one.
+func cacheEmbeddedTrace(cache *tracecache.Cache, hash string, execTrace parity.ExecTrace, log io.Writer) {
+	if cache == nil {
+		return
+	}
+	result, err := json.Marshal(execTrace)
+	if err == nil {
+		err = cache.Put(hash, result)
+	}
+	if err != nil {
+		fmt.Fprintf(log, "Couldn't cache the trace of %s: %v\n", hash, err)
+	}
+}
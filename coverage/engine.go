@@ -0,0 +1,552 @@
+// Package coverage runs the tests against a chain and builds the coverage,
+// gas, line, per-test and event reports from the traces of the transactions
+// they sent. It's what `solstice cover` runs, configured without the CLI's
+// config file.
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/covloc"
+	"github.com/reserve-protocol/solstice/devchain"
+	"github.com/reserve-protocol/solstice/events"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/gas"
+	"github.com/reserve-protocol/solstice/linecov"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/srcmap"
+	"github.com/reserve-protocol/solstice/testcov"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+// The tests exited with an error other than the plain failure of a test.
+var ErrTestsFailed = errors.New("The tests failed")
+
+// A config option the engine needs is missing or wrong.
+var ErrInvalidConfig = errors.New("The config is invalid")
+
+// The settings of the engine, named after the config options of the same
+// names, which are described in the README. TestCommand is run against
+// BlockchainClient, or against the chain solstice starts for it if Backend is
+// "embedded" or NodeCommand is set. The reports are written to ReportDir.
+// With FromTraces set, the coverage is built from a directory of saved traces
+// instead of running the tests, and with Offline set, from the traces cached
+// by the last run. Tables and progress are written to Out, and warnings to
+// Log, if they're set.
+type Config struct {
+	Compiler  solc.Compiler
+	ReportDir string
+
+	BlockchainClient string
+	TestCommand      []string
+	TestHookAddress  string
+
+	Backend            string
+	EmbeddedAddress    string
+	EmbeddedAccounts   int
+	NodeCommand        []string
+	NodeStartupTimeout time.Duration
+	SnapshotChain      bool
+
+	RPCConcurrency int
+	RPCBatchSize   int
+	RPCRetries     int
+	StreamTraces   bool
+	TraceCacheDir  string
+	ChainID        string
+	Offline        bool
+
+	FromTraces string
+
+	Out io.Writer
+	Log io.Writer
+}
+
+// Everything a run of the engine found out. Tests is only filled in if the
+// tests reported when each of them started and ended to the test hook.
+type Report struct {
+	Coverage map[string][]covloc.CoverageLoc
+	Gas      gas.Report
+	Lines    linecov.Coverage
+	Tests    testcov.Coverage
+	Events   []events.EventStats
+}
+
+// Checks the settings a run needs before anything is started, so that a
+// mistake is reported by the name of its config option.
+func (cfg Config) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidConfig}, args...)...)
+	}
+	if cfg.Compiler.ContractsDir == "" {
+		return invalid("contracts_dir isn't set.")
+	}
+	if info, err := os.Stat(cfg.Compiler.ContractsDir); err != nil || !info.IsDir() {
+		return invalid("contracts_dir %s isn't a directory.", cfg.Compiler.ContractsDir)
+	}
+	if cfg.ReportDir == "" {
+		return invalid("coverage_report_dir isn't set.")
+	}
+	if cfg.FromTraces != "" || cfg.Offline {
+		return nil
+	}
+	if len(cfg.TestCommand) == 0 {
+		return invalid("test_command isn't set.")
+	}
+	switch cfg.Backend {
+	case "":
+		if cfg.BlockchainClient == "" {
+			return invalid("blockchain_client isn't set; set it, or set backend to embedded.")
+		}
+	case "embedded":
+		if cfg.EmbeddedAddress == "" {
+			return invalid("embedded_address isn't set.")
+		}
+	default:
+		return invalid("backend is %q; leave it unset, or set it to \"embedded\".", cfg.Backend)
+	}
+	return nil
+}
+
+type Engine struct {
+	cfg Config
+	out io.Writer
+	log io.Writer
+}
+
+func NewEngine(cfg Config) *Engine {
+	engine := &Engine{cfg: cfg, out: cfg.Out, log: cfg.Log}
+	if engine.out == nil {
+		engine.out = ioutil.Discard
+	}
+	if engine.log == nil {
+		engine.log = ioutil.Discard
+	}
+	return engine
+}
+
+// Runs the tests, builds the reports from the traces of their transactions,
+// and writes them to ReportDir.
+func (engine *Engine) Run(ctx context.Context) (*Report, error) {
+	cfg := engine.cfg
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	sourceMaps, bytecodeToFilename, err := srcmap.Get(ctx, cfg.Compiler)
+	if err != nil {
+		return nil, err
+	}
+	abis, err := abi.Get(ctx, cfg.Compiler)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offline, the reports are made again from the transactions and traces
+	// saved by the last run.
+	url := cfg.BlockchainClient
+	var cache *tracecache.Cache
+	var run coverageRun
+	var firstBlock, lastBlock uint64
+	var embedded *devchain.Chain
+	switch {
+	case cfg.FromTraces != "":
+	case cfg.Offline:
+		if cache, err = engine.cfg.TraceCache(ctx, url); err != nil {
+			return nil, err
+		}
+		if err := run.read(cache); err != nil {
+			return nil, err
+		}
+	default:
+		testChain, err := StartChain(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		defer testChain.Stop()
+		url, embedded = testChain.URL, testChain.Embedded
+		if cache, err = engine.cfg.TraceCache(ctx, url); err != nil {
+			return nil, err
+		}
+		revertChain, err := engine.snapshotChain(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		defer revertChain()
+		if firstBlock, lastBlock, run.TestRanges, err = engine.runTests(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	testRanges := run.TestRanges
+
+	// Initialize the coverage report
+	coverageMap, err := NewMap(ctx, cfg.Compiler)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill the coverage and gas reports
+	gasCollector := gas.NewCollector()
+	eventCoverage := events.NewCoverage(abi.Events(abis))
+	testCoverage := testcov.NewCollector()
+	lineCoverage := linecov.NewCollector()
+	for _, sourceMap := range sourceMaps {
+		for _, location := range sourceMap {
+			if location.ByteLength > 0 && location.ByteOffset >= 0 && location.SourceFileName != "" {
+				if err := lineCoverage.AddExecutable(location); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, testRange := range testRanges {
+		testCoverage.AddTest(testRange.Name)
+	}
+
+	accumulator := &coverageAccumulator{
+		sourceMaps:         sourceMaps,
+		bytecodeToFilename: bytecodeToFilename,
+		abis:               abis,
+		testRanges:         testRanges,
+		coverageMap:        coverageMap,
+		gasCollector:       gasCollector,
+		lineCoverage:       lineCoverage,
+		testCoverage:       testCoverage,
+		pcToOpIndexes:      make(map[string]map[int]int),
+		txns:               make(map[string]*txnAccumulator),
+	}
+
+	// Trace the transactions to contracts, and then fetch their logs
+	if cfg.FromTraces != "" {
+		if err := engine.importTraces(cfg.FromTraces, accumulator, eventCoverage); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := engine.addTraces(ctx, url, cache, embedded, &run, firstBlock, lastBlock, accumulator); err != nil {
+			return nil, err
+		}
+		for _, logs := range run.Logs {
+			for _, log := range logs {
+				eventCoverage.Add(log.Topics)
+			}
+		}
+	}
+
+	gasReport, err := gasCollector.Report()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Coverage: coverageMap,
+		Gas:      gasReport,
+		Lines:    lineCoverage.Coverage(),
+		Events:   eventCoverage.Report(),
+	}
+	if len(testRanges) != 0 {
+		report.Tests = testCoverage.Coverage()
+	}
+	return report, engine.writeReports(report, testCoverage)
+}
+
+// Adds the traces of the transactions mined from firstBlock to lastBlock,
+// and fetches their logs into the run. Offline, the transactions are those
+// the run already has.
+func (engine *Engine) addTraces(
+	ctx context.Context,
+	url string,
+	cache *tracecache.Cache,
+	embedded *devchain.Chain,
+	run *coverageRun,
+	firstBlock uint64,
+	lastBlock uint64,
+	accumulator *coverageAccumulator,
+) error {
+	cfg := engine.cfg
+	fetcher := engine.cfg.NewFetcher(url, cache)
+	if embedded == nil && !cfg.Offline && cfg.StreamTraces {
+		var err error
+		if run.Transactions, err = fetcher.ContractTransactions(ctx, firstBlock, lastBlock); err != nil {
+			return err
+		}
+	}
+	var txnHashes []string
+	for _, txn := range run.Transactions {
+		txnHashes = append(txnHashes, txn.Hash)
+	}
+
+	var err error
+	switch {
+	case embedded != nil:
+		// The embedded chain traced the transactions as it mined them.
+		err = embedded.BlockTraces(firstBlock, lastBlock, func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+			run.Transactions = append(run.Transactions, txn)
+			txnHashes = append(txnHashes, txn.Hash)
+			cacheEmbeddedTrace(cache, txn.Hash, execTrace, engine.log)
+			return accumulator.addTrace(txn, execTrace)
+		})
+	case cfg.StreamTraces:
+		// Traces too large to hold in memory are read op by op, skipping
+		// everything but what coverage needs.
+		started := make([]bool, len(run.Transactions))
+		err = fetcher.StreamTraces(ctx, txnHashes, parity.SkipAll, func(index int, depth int, code string, op parity.Operation) error {
+			if !started[index] {
+				accumulator.start(run.Transactions[index], code)
+				started[index] = true
+			}
+			return accumulator.addOp(txnHashes[index], op)
+		})
+		for _, hash := range txnHashes {
+			accumulator.finish(hash)
+		}
+	case cfg.Offline:
+		err = fetcher.Traces(ctx, txnHashes, func(index int, execTrace parity.ExecTrace) error {
+			return accumulator.addTrace(run.Transactions[index], execTrace)
+		})
+	default:
+		err = fetcher.BlockTraces(ctx, firstBlock, lastBlock, func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+			run.Transactions = append(run.Transactions, txn)
+			txnHashes = append(txnHashes, txn.Hash)
+			return accumulator.addTrace(txn, execTrace)
+		})
+	}
+	if err != nil || cfg.Offline {
+		return err
+	}
+
+	if embedded != nil {
+		run.Logs, err = embedded.Logs(txnHashes)
+	} else {
+		run.Logs, err = fetcher.Logs(ctx, txnHashes)
+	}
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		return run.write(cache)
+	}
+	return nil
+}
+
+// Writes the marked up sources and the JSON reports to ReportDir, and prints
+// the gas and event tables.
+func (engine *Engine) writeReports(report *Report, testCoverage *testcov.Collector) error {
+	reportDir := engine.cfg.ReportDir
+
+	// Write the coverage report
+	for filename, locs := range report.Coverage {
+		origSource, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		var titleErr error
+		markedUpString := MarkUp(origSource, locs, func(location srclocation.SourceLocation) string {
+			if report.Tests == nil {
+				return ""
+			}
+			line, err := testCoverage.Line(location)
+			if err != nil {
+				titleErr = err
+				return ""
+			}
+			if tests := report.Tests.TestsCovering(filename, line); len(tests) != 0 {
+				return "Covered by: " + strings.Join(tests, ", ")
+			}
+			return ""
+		})
+		if titleErr != nil {
+			return titleErr
+		}
+
+		relativeFileName := strings.TrimPrefix(filename, engine.cfg.Compiler.ContractsDir)
+		reportFileName := reportDir + relativeFileName + ".html"
+		if err := os.MkdirAll(filepath.Dir(reportFileName), 0711); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(reportFileName, []byte(markedUpString), 0644); err != nil {
+			return err
+		}
+	}
+
+	// Write the gas report
+	if err := report.Gas.PrintTable(engine.out); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(reportDir, 0711); err != nil {
+		return err
+	}
+	if err := report.Gas.WriteJSON(filepath.Join(reportDir, "gas_report.json")); err != nil {
+		return err
+	}
+
+	// Write the line coverage, for diff-cover
+	if err := report.Lines.WriteJSON(filepath.Join(reportDir, "line_coverage.json")); err != nil {
+		return err
+	}
+
+	// Write the per-test coverage
+	if report.Tests != nil {
+		if err := report.Tests.WriteJSON(filepath.Join(reportDir, "test_coverage.json")); err != nil {
+			return err
+		}
+		if redundant := report.Tests.WithoutUniqueLines(); len(redundant) != 0 {
+			fmt.Fprintln(engine.out, "\nTests that cover no lines that other tests don't:")
+			for _, test := range redundant {
+				fmt.Fprintf(engine.out, "    %s\n", test)
+			}
+		}
+	}
+
+	// Write the events report
+	fmt.Fprintln(engine.out, "\nEvents emitted:")
+	if err := events.PrintTable(engine.out, report.Events); err != nil {
+		return err
+	}
+	return events.WriteJSON(filepath.Join(reportDir, "event_report.json"), report.Events)
+}
+
+// Runs TestCommand against the chain at url, and returns the first and last
+// blocks it mined, and the blocks mined during each test if the tests report
+// them to the test hook.
+func (engine *Engine) runTests(ctx context.Context, url string) (uint64, uint64, []testcov.TestRange, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer client.Close()
+
+	headerBeforeTests, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	fmt.Fprintf(engine.out, "Start block number: %v\n", headerBeforeTests.Number)
+
+	// Tests can tell the hook when they start and end, so their
+	// transactions can be told apart.
+	var hook *testcov.Hook
+	if address := engine.cfg.TestHookAddress; address != "" {
+		hook = testcov.NewHook(func() (uint64, error) {
+			header, err := client.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return 0, err
+			}
+			return header.Number.Uint64(), nil
+		})
+		if err := hook.Listen(address); err != nil {
+			return 0, 0, nil, err
+		}
+		defer hook.Close()
+	}
+
+	// Run tests
+	{
+		args := engine.cfg.TestCommand
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = append(os.Environ(), "SOLSTICE_RPC_URL="+url)
+		if hook != nil {
+			cmd.Env = append(cmd.Env, "SOLSTICE_TEST_HOOK=http://"+engine.cfg.TestHookAddress)
+		}
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			fmt.Fprintf(engine.out, "Tests return %v: %s\n", err, output)
+			if err.Error() != "exit status 1" || string(output) != "" {
+				return 0, 0, nil, fmt.Errorf("%w: %v", ErrTestsFailed, err)
+			}
+		}
+	}
+
+	blockAfterTests, err := client.BlockByNumber(ctx, nil)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	fmt.Fprintf(engine.out, "Ending block number: %v\n", blockAfterTests.Number())
+
+	// The blocks mined during each test
+	var testRanges []testcov.TestRange
+	if hook != nil {
+		testRanges = hook.Ranges(blockAfterTests.NumberU64())
+	}
+	return headerBeforeTests.Number.Uint64() + 1, blockAfterTests.NumberU64(), testRanges, nil
+}
+
+// What the engine learned from the node about a run of the tests, saved next
+// to the traces so that the reports can be made again offline.
+type coverageRun struct {
+	Transactions []fetch.Transaction
+	Logs         [][]fetch.Log
+	TestRanges   []testcov.TestRange
+}
+
+func coverageRunFile(cache *tracecache.Cache) string {
+	return filepath.Join(cache.Dir(), "cover_run.json")
+}
+
+func (run *coverageRun) write(cache *tracecache.Cache) error {
+	runJSON, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cache.Dir(), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(coverageRunFile(cache), runJSON, 0644)
+}
+
+func (run *coverageRun) read(cache *tracecache.Cache) error {
+	runJSON, err := ioutil.ReadFile(coverageRunFile(cache))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(runJSON, run)
+}
+
+// Where the traces of the chain at url are cached.
+func (cfg Config) TraceConfig(url string) tracecache.Config {
+	return tracecache.Config{
+		Dir:     cfg.TraceCacheDir,
+		ChainID: cfg.ChainID,
+		URL:     url,
+		Offline: cfg.Offline,
+	}
+}
+
+// The trace cache of the chain at url. Online, traces can still be fetched
+// without a cache, so it's nil if it can't be set up, and Log is told why.
+func (cfg Config) TraceCache(ctx context.Context, url string) (*tracecache.Cache, error) {
+	cache, err := cfg.TraceConfig(url).Open(ctx)
+	if err != nil && !cfg.Offline {
+		if cfg.Log != nil {
+			fmt.Fprintf(cfg.Log, "Traces won't be cached: %v\n", err)
+		}
+		return nil, nil
+	}
+	return cache, err
+}
+
+// A fetcher for the chain at url, set up from the RPC settings, that caches
+// the traces it fetches in cache, if it's set. Progress is written to Log.
+func (cfg Config) NewFetcher(url string, cache *tracecache.Cache) *fetch.Fetcher {
+	return fetch.New(fetch.Config{
+		URL:         url,
+		Concurrency: cfg.RPCConcurrency,
+		BatchSize:   cfg.RPCBatchSize,
+		Retries:     cfg.RPCRetries,
+		Progress:    cfg.Log,
+		Cache:       cache,
+		Offline:     cfg.Offline,
+	})
+}
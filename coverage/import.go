@@ -0,0 +1,43 @@
+package coverage
+
+import (
+	"fmt"
+
+	"github.com/reserve-protocol/solstice/events"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/trace"
+	"github.com/reserve-protocol/solstice/traceimport"
+)
+
+// Adds the coverage of the traces saved in dir. Without receipts, the events
+// are read from the LOG ops of each trace, leaving out transactions that
+// reverted.
+func (engine *Engine) importTraces(dir string, accumulator *coverageAccumulator, eventCoverage *events.Coverage) error {
+	var candidates []string
+	for bytecode := range accumulator.bytecodeToFilename {
+		candidates = append(candidates, bytecode)
+	}
+
+	imported := 0
+	err := traceimport.Read(dir, candidates, func(importedTrace traceimport.Trace) error {
+		execTrace := importedTrace.ExecTrace
+		txn := fetch.Transaction{Hash: importedTrace.Name, Input: traceimport.Calldata(execTrace.VMTrace)}
+		if err := accumulator.addTrace(txn, execTrace); err != nil {
+			return err
+		}
+		imported++
+
+		lastOp := execTrace.Ops[len(execTrace.Ops)-1]
+		if opCode := evmbytecode.OpCodeAt(execTrace.Code, lastOp.PC); opCode == "fd" || opCode == "fe" {
+			return nil
+		}
+		steps := trace.Flatten(execTrace.VMTrace, accumulator.sourceMaps, accumulator.bytecodeToFilename)
+		for _, log := range trace.Logs(steps) {
+			eventCoverage.Add(log.Topics)
+		}
+		return nil
+	})
+	fmt.Fprintf(engine.out, "Imported %d traces from %s\n", imported, dir)
+	return err
+}
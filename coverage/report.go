@@ -0,0 +1,86 @@
+package coverage
+
+import (
+	"context"
+	"html"
+	"sort"
+
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/covloc"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+// Sets up the coverage locations of every file in the source maps, with no
+// hits yet.
+func NewMap(ctx context.Context, compiler solc.Compiler) (map[string][]covloc.CoverageLoc, error) {
+	coverageMap := make(map[string][]covloc.CoverageLoc)
+
+	plainASTs, err := ast.FromSrcmaps(ctx, compiler)
+	if err != nil {
+		return coverageMap, err
+	}
+	for sourceFileName, plainAST := range plainASTs {
+		coverageLocs, err := covloc.ToCoverageLocs(plainAST)
+		if err != nil {
+			return coverageMap, err
+		}
+		coverageMap[sourceFileName] = coverageLocs
+	}
+	return coverageMap, nil
+}
+
+// Counts a hit on the coverage locations with exactly the location of an op.
+func AddHit(coverageMap map[string][]covloc.CoverageLoc, traceLoc srclocation.SourceLocation) {
+	for i, coverageLoc := range coverageMap[traceLoc.SourceFileName] {
+		if coverageLoc.CoverageRange.ByteLength == traceLoc.ByteLength &&
+			coverageLoc.CoverageRange.ByteOffset == traceLoc.ByteOffset {
+			coverageMap[traceLoc.SourceFileName][i].HitCount += 1
+		}
+	}
+}
+
+// Marks up the source of a file, green where it ran and red where it didn't.
+// title gives the tooltip for a location that ran, if it should have one.
+func MarkUp(origSource []byte, locs []covloc.CoverageLoc, title func(srclocation.SourceLocation) string) string {
+	var flatLocs []covloc.CoverageCount
+	for _, covLoc := range locs {
+		for _, loc := range covLoc.SrcLocs {
+			if loc.ByteLength == 0 {
+				continue
+			}
+
+			flatLocs = append(flatLocs, covloc.CoverageCount{
+				SrcLoc: loc,
+				Count:  covLoc.HitCount,
+			})
+		}
+	}
+
+	sort.Slice(flatLocs, func(i, j int) bool {
+		// If they have the same byte offset, my current belief is that that can
+		// only happen if one of them is empty. In that case, we're going to throw
+		// it away anyway.
+		return flatLocs[i].SrcLoc.ByteOffset < flatLocs[j].SrcLoc.ByteOffset
+	})
+
+	markedUpString := "<pre>"
+	markupIndex := 0
+
+	for _, covCountLoc := range flatLocs {
+		markedUpString += html.EscapeString(string(origSource[markupIndex:covCountLoc.SrcLoc.ByteOffset]))
+		if covCountLoc.Count == 0 {
+			markedUpString += "<span style=\"background-color:" + srclocation.GithubRed + ";\">"
+		} else if tooltip := title(covCountLoc.SrcLoc); tooltip != "" {
+			markedUpString += "<span style=\"background-color:" + srclocation.GithubGreen + ";\" title=\"" + html.EscapeString(tooltip) + "\">"
+		} else {
+			markedUpString += "<span style=\"background-color:" + srclocation.GithubGreen + ";\">"
+		}
+		markedUpString += html.EscapeString(string(origSource[covCountLoc.SrcLoc.ByteOffset : covCountLoc.SrcLoc.ByteOffset+covCountLoc.SrcLoc.ByteLength]))
+		markedUpString += "</span>"
+		markupIndex = covCountLoc.SrcLoc.ByteOffset + covCountLoc.SrcLoc.ByteLength
+	}
+
+	markedUpString += "</pre>"
+	return markedUpString
+}
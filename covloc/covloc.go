@@ -59,19 +59,17 @@ func ToCoverageLocs(node ast.AST) ([]CoverageLoc, error) {
 
 		if byteLength1 != 0 {
 			covLoc.SrcLocs = append(covLoc.SrcLocs, srclocation.SourceLocation{
-				byteOffset1,
-				byteLength1,
-				node.SrcLoc.SourceFileName,
-				rune(0),
+				ByteOffset:     byteOffset1,
+				ByteLength:     byteLength1,
+				SourceFileName: node.SrcLoc.SourceFileName,
 			})
 		}
 
 		if byteLength2 != 0 {
 			covLoc.SrcLocs = append(covLoc.SrcLocs, srclocation.SourceLocation{
-				byteOffset2,
-				byteLength2,
-				node.SrcLoc.SourceFileName,
-				rune(0),
+				ByteOffset:     byteOffset2,
+				ByteLength:     byteLength2,
+				SourceFileName: node.SrcLoc.SourceFileName,
 			})
 		}
 
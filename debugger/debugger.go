@@ -0,0 +1,180 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+type Breakpoint struct {
+	File string
+	Line int
+}
+
+// Parses a breakpoint given as "file:line".
+func ParseBreakpoint(spec string) (Breakpoint, error) {
+	separator := strings.LastIndex(spec, ":")
+	if separator == -1 {
+		return Breakpoint{}, fmt.Errorf("Breakpoint %q should be given as file:line.", spec)
+	}
+	line, err := strconv.Atoi(spec[separator+1:])
+	if err != nil {
+		return Breakpoint{}, fmt.Errorf("Breakpoint %q should be given as file:line.", spec)
+	}
+	return Breakpoint{File: spec[:separator], Line: line}, nil
+}
+
+// Steps through a recorded trace, one source location at a time.
+type Debugger struct {
+	Steps       []trace.Step
+	Current     int
+	Breakpoints []Breakpoint
+
+	*srclocation.LineFinder
+}
+
+func New(steps []trace.Step) *Debugger {
+	debugger := &Debugger{
+		Steps:      steps,
+		LineFinder: srclocation.NewLineFinder(),
+	}
+	// Start on the first step that's in the source, if there is one.
+	for debugger.Current < len(steps)-1 && steps[debugger.Current].SrcLoc.SourceFileName == "" {
+		debugger.Current++
+	}
+	return debugger
+}
+
+func (debugger *Debugger) Step() trace.Step {
+	return debugger.Steps[debugger.Current]
+}
+
+// The number of frames on the call stack at a step.
+func stackDepth(step trace.Step) int {
+	depth := 1
+	for frame := step.Frame; frame.Parent != nil; frame = frame.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Moves to the next step that's at a different source location and satisfies
+// the condition. If there isn't one, it stays put and returns false.
+func (debugger *Debugger) advance(condition func(trace.Step) bool) bool {
+	current := debugger.Step()
+	for i := debugger.Current + 1; i < len(debugger.Steps); i++ {
+		step := debugger.Steps[i]
+		if step.SrcLoc.SourceFileName == "" {
+			continue
+		}
+		if step.SrcLoc == current.SrcLoc && step.Frame == current.Frame {
+			continue
+		}
+		if condition(step) {
+			debugger.Current = i
+			return true
+		}
+	}
+	return false
+}
+
+func (debugger *Debugger) StepInto() bool {
+	return debugger.advance(func(step trace.Step) bool { return true })
+}
+
+// Steps to the next location in the current function or a caller of it.
+func (debugger *Debugger) StepOver() bool {
+	depth := stackDepth(debugger.Step())
+	return debugger.advance(func(step trace.Step) bool { return stackDepth(step) <= depth })
+}
+
+func (debugger *Debugger) StepOut() bool {
+	depth := stackDepth(debugger.Step())
+	return debugger.advance(func(step trace.Step) bool { return stackDepth(step) < depth })
+}
+
+// Continues to the next breakpoint, or the end of the trace if none is hit.
+func (debugger *Debugger) Continue() (bool, error) {
+	currentLine, err := debugger.Line(debugger.Step().SrcLoc)
+	if err != nil {
+		return false, err
+	}
+	currentFile := debugger.Step().SrcLoc.SourceFileName
+
+	var lineErr error
+	hit := debugger.advance(func(step trace.Step) bool {
+		line, err := debugger.Line(step.SrcLoc)
+		if err != nil {
+			lineErr = err
+			return true
+		}
+		if line == currentLine && step.SrcLoc.SourceFileName == currentFile {
+			return false
+		}
+		for _, breakpoint := range debugger.Breakpoints {
+			if breakpoint.Line == line && matchesFile(step.SrcLoc.SourceFileName, breakpoint.File) {
+				return true
+			}
+		}
+		return false
+	})
+	if lineErr != nil {
+		return false, lineErr
+	}
+	if !hit {
+		debugger.Current = len(debugger.Steps) - 1
+	}
+	return hit, nil
+}
+
+// Breakpoints can name files by any trailing part of their path.
+func matchesFile(sourceFileName string, file string) bool {
+	return sourceFileName == file || strings.HasSuffix(sourceFileName, "/"+strings.TrimPrefix(file, "/"))
+}
+
+// The lines around the current location, with the current line marked.
+func (debugger *Debugger) SourceWindow(context int) (string, error) {
+	location := debugger.Step().SrcLoc
+	if location.SourceFileName == "" {
+		return "", fmt.Errorf("Step %d has no source location.", debugger.Current)
+	}
+
+	source, err := ioutil.ReadFile(location.SourceFileName)
+	if err != nil {
+		return "", err
+	}
+	currentLine, err := debugger.Line(location)
+	if err != nil {
+		return "", err
+	}
+
+	var window bytes.Buffer
+	fmt.Fprintf(&window, "%s\n", location.SourceFileName)
+	for i, line := range bytes.Split(source, []byte{'\n'}) {
+		lineNumber := i + 1
+		if lineNumber < currentLine-context || currentLine+context < lineNumber {
+			continue
+		}
+		marker := "  "
+		if lineNumber == currentLine {
+			marker = "=>"
+		}
+		fmt.Fprintf(&window, "%s %4d  %s\n", marker, lineNumber, line)
+	}
+	return window.String(), nil
+}
+
+// Rebuilds the state of the current external call just before the current
+// step, from the effects of the steps leading up to it.
+func (debugger *Debugger) State() trace.State {
+	machine := trace.NewMachine()
+	for _, step := range debugger.Steps[:debugger.Current] {
+		machine.Apply(step)
+	}
+	return machine.State(debugger.Step())
+}
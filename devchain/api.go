@@ -0,0 +1,471 @@
+package devchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// The eth_* methods that test frameworks use.
+type EthAPI struct {
+	chain *Chain
+}
+
+// The arguments of eth_call, eth_estimateGas and eth_sendTransaction.
+type CallArgs struct {
+	From     *common.Address
+	To       *common.Address
+	Gas      *hexutil.Uint64
+	GasPrice *hexutil.Big
+	Value    *hexutil.Big
+	Data     *hexutil.Bytes
+	Input    *hexutil.Bytes
+}
+
+// Transactions that don't say who they're from are sent from the first
+// account.
+func (api *EthAPI) message(args CallArgs) Message {
+	message := Message{From: api.chain.accounts[0], To: args.To}
+	if args.From != nil {
+		message.From = *args.From
+	}
+	if args.Gas != nil {
+		message.Gas = uint64(*args.Gas)
+	}
+	if args.GasPrice != nil {
+		message.GasPrice = args.GasPrice.ToInt()
+	}
+	if args.Value != nil {
+		message.Value = args.Value.ToInt()
+	}
+	if args.Input != nil {
+		message.Data = *args.Input
+	} else if args.Data != nil {
+		message.Data = *args.Data
+	}
+	return message
+}
+
+// The block a block number argument refers to; nil is the latest block.
+// There are no pending blocks, since every transaction is mined right away.
+func blockNumber(number *rpc.BlockNumber) *uint64 {
+	if number == nil || *number < 0 {
+		return nil
+	}
+	value := uint64(*number)
+	return &value
+}
+
+func (api *EthAPI) ChainId() hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.ChainID().Uint64())
+}
+
+func (api *EthAPI) Accounts() []common.Address {
+	return api.chain.Accounts()
+}
+
+func (api *EthAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.BlockNumber())
+}
+
+func (api *EthAPI) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(defaultGasPrice)
+}
+
+func (api *EthAPI) Syncing() bool {
+	return false
+}
+
+func (api *EthAPI) GetBalance(address common.Address, number *rpc.BlockNumber) (*hexutil.Big, error) {
+	statedb, _, err := api.chain.State(blockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(statedb.GetBalance(address)), nil
+}
+
+func (api *EthAPI) GetCode(address common.Address, number *rpc.BlockNumber) (hexutil.Bytes, error) {
+	statedb, _, err := api.chain.State(blockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(address), nil
+}
+
+func (api *EthAPI) GetStorageAt(address common.Address, key string, number *rpc.BlockNumber) (hexutil.Bytes, error) {
+	statedb, _, err := api.chain.State(blockNumber(number))
+	if err != nil {
+		return nil, err
+	}
+	value := statedb.GetState(address, common.HexToHash(key))
+	return value.Bytes(), nil
+}
+
+func (api *EthAPI) GetTransactionCount(address common.Address, number *rpc.BlockNumber) (hexutil.Uint64, error) {
+	statedb, _, err := api.chain.State(blockNumber(number))
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(statedb.GetNonce(address)), nil
+}
+
+func (api *EthAPI) Call(args CallArgs, number *rpc.BlockNumber) (hexutil.Bytes, error) {
+	return api.chain.Call(api.message(args), blockNumber(number))
+}
+
+func (api *EthAPI) EstimateGas(args CallArgs) (hexutil.Uint64, error) {
+	gas, err := api.chain.EstimateGas(api.message(args))
+	return hexutil.Uint64(gas), err
+}
+
+func (api *EthAPI) SendTransaction(args CallArgs) (common.Hash, error) {
+	return api.chain.Send(api.message(args))
+}
+
+func (api *EthAPI) SendRawTransaction(data hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return common.Hash{}, err
+	}
+	return api.chain.SendTransaction(tx)
+}
+
+func (api *EthAPI) GetTransactionByHash(hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, number, index := api.chain.Transaction(hash)
+	if tx == nil {
+		return nil, nil
+	}
+	return api.transaction(tx, blockHash, number, index)
+}
+
+func (api *EthAPI) transaction(tx *types.Transaction, blockHash common.Hash, number uint64, index uint64) (map[string]interface{}, error) {
+	from, err := api.chain.Sender(tx, number)
+	if err != nil {
+		return nil, err
+	}
+	v, r, s := tx.RawSignatureValues()
+	return map[string]interface{}{
+		"blockHash":        blockHash,
+		"blockNumber":      hexutil.Uint64(number),
+		"from":             from,
+		"gas":              hexutil.Uint64(tx.Gas()),
+		"gasPrice":         (*hexutil.Big)(tx.GasPrice()),
+		"hash":             tx.Hash(),
+		"input":            hexutil.Bytes(tx.Data()),
+		"nonce":            hexutil.Uint64(tx.Nonce()),
+		"to":               tx.To(),
+		"transactionIndex": hexutil.Uint64(index),
+		"value":            (*hexutil.Big)(tx.Value()),
+		"v":                (*hexutil.Big)(v),
+		"r":                (*hexutil.Big)(r),
+		"s":                (*hexutil.Big)(s),
+	}, nil
+}
+
+func (api *EthAPI) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, number, index := api.chain.Transaction(hash)
+	receipt := api.chain.Receipt(hash)
+	if tx == nil || receipt == nil {
+		return nil, nil
+	}
+	from, err := api.chain.Sender(tx, number)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"blockHash":         blockHash,
+		"blockNumber":       hexutil.Uint64(number),
+		"transactionHash":   hash,
+		"transactionIndex":  hexutil.Uint64(index),
+		"from":              from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+		"status":            hexutil.Uint(receipt.Status),
+	}
+	if receipt.Logs == nil {
+		fields["logs"] = []*types.Log{}
+	}
+	if tx.To() == nil {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields, nil
+}
+
+func (api *EthAPI) GetBlockByNumber(number rpc.BlockNumber, full bool) (map[string]interface{}, error) {
+	block := api.chain.Block(blockNumber(&number))
+	if block == nil {
+		return nil, nil
+	}
+	return api.block(block, full)
+}
+
+func (api *EthAPI) GetBlockByHash(hash common.Hash, full bool) (map[string]interface{}, error) {
+	block := api.chain.BlockByHash(hash)
+	if block == nil {
+		return nil, nil
+	}
+	return api.block(block, full)
+}
+
+func (api *EthAPI) block(block *types.Block, full bool) (map[string]interface{}, error) {
+	header := block.Header()
+	transactions := make([]interface{}, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		transactions[i] = tx.Hash()
+		if full {
+			var err error
+			transactions[i], err = api.transaction(tx, block.Hash(), block.NumberU64(), uint64(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return map[string]interface{}{
+		"number":           (*hexutil.Big)(header.Number),
+		"hash":             block.Hash(),
+		"parentHash":       header.ParentHash,
+		"nonce":            header.Nonce,
+		"mixHash":          header.MixDigest,
+		"sha3Uncles":       header.UncleHash,
+		"logsBloom":        header.Bloom,
+		"stateRoot":        header.Root,
+		"miner":            header.Coinbase,
+		"difficulty":       (*hexutil.Big)(header.Difficulty),
+		"totalDifficulty":  (*hexutil.Big)(new(big.Int).Mul(header.Number, header.Difficulty)),
+		"extraData":        hexutil.Bytes(header.Extra),
+		"size":             hexutil.Uint64(block.Size()),
+		"gasLimit":         hexutil.Uint64(header.GasLimit),
+		"gasUsed":          hexutil.Uint64(header.GasUsed),
+		"timestamp":        (*hexutil.Big)(header.Time),
+		"transactionsRoot": header.TxHash,
+		"receiptsRoot":     header.ReceiptHash,
+		"transactions":     transactions,
+		"uncles":           []common.Hash{},
+	}, nil
+}
+
+// The filter of eth_getLogs. Address is one address or a list of them, and
+// each topic is null, one topic, or a list of topics any of which match.
+type LogFilter struct {
+	FromBlock *rpc.BlockNumber
+	ToBlock   *rpc.BlockNumber
+	BlockHash *common.Hash
+	Address   json.RawMessage
+	Topics    []json.RawMessage
+}
+
+func (api *EthAPI) GetLogs(filter LogFilter) ([]*types.Log, error) {
+	addresses, err := hashesOrOne(filter.Address)
+	if err != nil {
+		return nil, err
+	}
+	topics := make([][]common.Hash, len(filter.Topics))
+	for i, topic := range filter.Topics {
+		if topics[i], err = hashesOrOne(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	var blocks []*types.Block
+	if filter.BlockHash != nil {
+		if block := api.chain.BlockByHash(*filter.BlockHash); block != nil {
+			blocks = append(blocks, block)
+		}
+	} else {
+		from, to := uint64(0), api.chain.BlockNumber()
+		if number := blockNumber(filter.FromBlock); number != nil {
+			from = *number
+		} else if filter.FromBlock != nil {
+			from = to
+		}
+		if number := blockNumber(filter.ToBlock); number != nil && *number < to {
+			to = *number
+		}
+		for number := from; number <= to; number++ {
+			if block := api.chain.Block(&number); block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+
+	logs := []*types.Log{}
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			receipt := api.chain.Receipt(tx.Hash())
+			if receipt == nil {
+				continue
+			}
+			for _, log := range receipt.Logs {
+				if matches(log, addresses, topics) {
+					logs = append(logs, log)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+func matches(log *types.Log, addresses []common.Hash, topics [][]common.Hash) bool {
+	if len(addresses) != 0 && !contains(addresses, common.BytesToHash(log.Address.Bytes())) {
+		return false
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, alternatives := range topics {
+		if len(alternatives) != 0 && !contains(alternatives, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(hashes []common.Hash, hash common.Hash) bool {
+	for _, other := range hashes {
+		if other == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads null, one hex value, or a list of them. Addresses are read as hashes,
+// padded on the left.
+func hashesOrOne(raw json.RawMessage) ([]common.Hash, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		values = []string{value}
+	}
+	hashes := make([]common.Hash, len(values))
+	for i, value := range values {
+		hashes[i] = common.HexToHash(value)
+	}
+	return hashes, nil
+}
+
+type NetAPI struct {
+	chain *Chain
+}
+
+func (api *NetAPI) Version() string {
+	return api.chain.ChainID().String()
+}
+
+func (api *NetAPI) Listening() bool {
+	return true
+}
+
+type Web3API struct{}
+
+func (api *Web3API) ClientVersion() string {
+	return "solstice-devchain"
+}
+
+// The evm_* methods of Ganache and Hardhat that tests use to control the
+// chain.
+type EVMAPI struct {
+	chain *Chain
+}
+
+// A number given either as a JSON number or as a hex string.
+type Number int64
+
+func (value *Number) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return json.Unmarshal(data, (*int64)(value))
+	}
+	parsed, err := strconv.ParseInt(text, 0, 64)
+	*value = Number(parsed)
+	return err
+}
+
+func (api *EVMAPI) Snapshot() hexutil.Uint64 {
+	return hexutil.Uint64(api.chain.Snapshot())
+}
+
+func (api *EVMAPI) Revert(id Number) (bool, error) {
+	return api.chain.Revert(uint64(id))
+}
+
+func (api *EVMAPI) Mine() (string, error) {
+	return "0x0", api.chain.Mine()
+}
+
+func (api *EVMAPI) IncreaseTime(seconds Number) int64 {
+	return api.chain.IncreaseTime(int64(seconds))
+}
+
+// Parity's trace_* methods, answered with the traces recorded as
+// transactions were mined, so that the rest of solstice can use the chain
+// like a Parity node.
+type TraceAPI struct {
+	chain *Chain
+}
+
+type BlockTrace struct {
+	TransactionHash common.Hash `json:"transactionHash"`
+	parity.ExecTrace
+}
+
+func checkTraceTypes(traceTypes []string) error {
+	for _, traceType := range traceTypes {
+		if traceType != "vmTrace" {
+			return fmt.Errorf("Only vmTrace is recorded, not %s.", traceType)
+		}
+	}
+	return nil
+}
+
+func (api *TraceAPI) ReplayTransaction(hash common.Hash, traceTypes []string) (*parity.ExecTrace, error) {
+	if err := checkTraceTypes(traceTypes); err != nil {
+		return nil, err
+	}
+	execTrace, ok := api.chain.Trace(hash)
+	if !ok {
+		return nil, nil
+	}
+	return &execTrace, nil
+}
+
+func (api *TraceAPI) ReplayBlockTransactions(number rpc.BlockNumber, traceTypes []string) ([]BlockTrace, error) {
+	if err := checkTraceTypes(traceTypes); err != nil {
+		return nil, err
+	}
+	block := api.chain.Block(blockNumber(&number))
+	if block == nil {
+		return nil, errors.New("No such block.")
+	}
+
+	traces := []BlockTrace{}
+	for _, tx := range block.Transactions() {
+		execTrace, ok := api.chain.Trace(tx.Hash())
+		if !ok {
+			return nil, fmt.Errorf("The trace of %s wasn't recorded.", tx.Hash().Hex())
+		}
+		traces = append(traces, BlockTrace{TransactionHash: tx.Hash(), ExecTrace: execTrace})
+	}
+	return traces, nil
+}
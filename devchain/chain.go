@@ -0,0 +1,535 @@
+// Package devchain is a development chain that runs in process, on
+// go-ethereum's EVM with an in-memory database, for tests to send
+// transactions to instead of a separate node. Every transaction is mined in
+// a block of its own, and traced as it runs.
+package devchain
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+const blockGasLimit = 30000000
+
+// Each account starts with a million ether.
+var accountBalance = new(big.Int).Mul(big.NewInt(1000000), big.NewInt(params.Ether))
+
+var defaultGasPrice = big.NewInt(params.GWei)
+
+// Block rewards and fees go to an account of their own, so that they don't
+// change the balances tests see.
+var coinbase = common.HexToAddress("0x000000000000000000000000000000000050151c")
+
+type Config struct {
+	// How many funded accounts to unlock. Defaults to 10.
+	Accounts int
+}
+
+type Chain struct {
+	lock       sync.Mutex
+	config     *params.ChainConfig
+	database   ethdb.Database
+	blockchain *core.BlockChain
+	accounts   []common.Address
+	keys       map[common.Address]*ecdsa.PrivateKey
+	traces     map[common.Hash]parity.ExecTrace
+	// Block numbers to revert to, by snapshot ID.
+	snapshots      map[uint64]uint64
+	nextSnapshot   uint64
+	timeAdjustment int64
+}
+
+func New(config Config) (*Chain, error) {
+	if config.Accounts == 0 {
+		config.Accounts = 10
+	}
+
+	chain := &Chain{
+		config:       params.AllEthashProtocolChanges,
+		database:     ethdb.NewMemDatabase(),
+		keys:         make(map[common.Address]*ecdsa.PrivateKey),
+		traces:       make(map[common.Hash]parity.ExecTrace),
+		snapshots:    make(map[uint64]uint64),
+		nextSnapshot: 1,
+	}
+
+	// The keys are the same every run, so that addresses in tests and traces
+	// are too.
+	alloc := make(core.GenesisAlloc)
+	for i := 0; i < config.Accounts; i++ {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("solstice dev account %d", i))))
+		if err != nil {
+			return nil, err
+		}
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		chain.accounts = append(chain.accounts, address)
+		chain.keys[address] = key
+		alloc[address] = core.GenesisAccount{Balance: accountBalance}
+	}
+
+	genesis := core.Genesis{
+		Config:     chain.config,
+		GasLimit:   blockGasLimit,
+		Difficulty: big.NewInt(1),
+		Timestamp:  uint64(time.Now().Unix()),
+		Alloc:      alloc,
+	}
+	if _, err := genesis.Commit(chain.database); err != nil {
+		return nil, err
+	}
+
+	// The state of every block is kept, so that the chain can be reverted to
+	// any of them. Headers aren't checked, since blocks are mined without
+	// proof of work, and several can be mined in a second.
+	var err error
+	chain.blockchain, err = core.NewBlockChain(
+		chain.database,
+		&core.CacheConfig{Disabled: true},
+		chain.config,
+		ethash.NewFullFaker(),
+		vm.Config{},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func (chain *Chain) Close() {
+	chain.blockchain.Stop()
+	chain.database.Close()
+}
+
+func (chain *Chain) ChainID() *big.Int {
+	return chain.config.ChainID
+}
+
+// The unlocked accounts, which transactions can be sent from without being
+// signed.
+func (chain *Chain) Accounts() []common.Address {
+	return append([]common.Address(nil), chain.accounts...)
+}
+
+// The private key of an unlocked account, hex encoded, for tests that sign
+// their own transactions. It's "" for other accounts.
+func (chain *Chain) PrivateKey(address common.Address) string {
+	key, ok := chain.keys[address]
+	if !ok {
+		return ""
+	}
+	return hexutil.Encode(crypto.FromECDSA(key))
+}
+
+func (chain *Chain) BlockNumber() uint64 {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return chain.blockchain.CurrentBlock().NumberU64()
+}
+
+// The trace recorded when a transaction was mined.
+func (chain *Chain) Trace(hash common.Hash) (parity.ExecTrace, bool) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	execTrace, ok := chain.traces[hash]
+	return execTrace, ok
+}
+
+// Hands the transactions to contracts in the blocks from first to last,
+// inclusive, to handle in order, along with the traces recorded when they
+// were mined.
+func (chain *Chain) BlockTraces(first uint64, last uint64, handle func(txn fetch.Transaction, execTrace parity.ExecTrace) error) error {
+	for number := first; number <= last; number++ {
+		chain.lock.Lock()
+		block := chain.blockchain.GetBlockByNumber(number)
+		chain.lock.Unlock()
+		if block == nil {
+			return fmt.Errorf("Block %d hasn't been mined.", number)
+		}
+
+		for _, tx := range block.Transactions() {
+			txn := fetch.Transaction{Hash: tx.Hash().Hex(), Input: tx.Data(), BlockNumber: number}
+			if tx.To() == nil {
+				continue
+			}
+			txn.To = strings.ToLower(tx.To().Hex())
+
+			execTrace, ok := chain.Trace(tx.Hash())
+			if !ok {
+				return fmt.Errorf("The trace of %s wasn't recorded.", txn.Hash)
+			}
+			if execTrace.Code == "0x" || len(execTrace.Ops) == 0 {
+				continue
+			}
+			if err := handle(txn, execTrace); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The logs emitted by each transaction.
+func (chain *Chain) Logs(hashes []string) ([][]fetch.Log, error) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	logs := make([][]fetch.Log, len(hashes))
+	for i, hash := range hashes {
+		receipt, _, _, _ := rawdb.ReadReceipt(chain.database, common.HexToHash(hash))
+		if receipt == nil {
+			return nil, fmt.Errorf("No receipt for %s.", hash)
+		}
+		for _, log := range receipt.Logs {
+			fetchLog := fetch.Log{Data: log.Data}
+			for _, topic := range log.Topics {
+				fetchLog.Topics = append(fetchLog.Topics, topic.Bytes())
+			}
+			logs[i] = append(logs[i], fetchLog)
+		}
+	}
+	return logs, nil
+}
+
+// Mines a block with the transaction, and records its trace. A transaction
+// that reverts is mined all the same, but an error saying why is returned
+// with its hash, as Ganache does.
+func (chain *Chain) SendTransaction(tx *types.Transaction) (common.Hash, error) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return chain.sendTransaction(tx)
+}
+
+// The lock must be held.
+func (chain *Chain) sendTransaction(tx *types.Transaction) (common.Hash, error) {
+	receipt, err := chain.mine(tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if receipt.Status == types.ReceiptStatusFailed {
+		output := common.FromHex(chain.traces[tx.Hash()].Output)
+		return tx.Hash(), fmt.Errorf("VM Exception while processing transaction: %s", abi.DecodeRevert(output, nil))
+	}
+	return tx.Hash(), nil
+}
+
+// Mines an empty block.
+func (chain *Chain) Mine() error {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	_, err := chain.mine(nil)
+	return err
+}
+
+// Mines a block with the transaction, if any, tracing it as it runs. The
+// lock must be held.
+func (chain *Chain) mine(tx *types.Transaction) (*types.Receipt, error) {
+	parent := chain.blockchain.CurrentBlock()
+	statedb, err := chain.blockchain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Unix() + chain.timeAdjustment
+	if timestamp < parent.Time().Int64() {
+		timestamp = parent.Time().Int64()
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Time:       big.NewInt(timestamp),
+		Coinbase:   coinbase,
+	}
+	engine := chain.blockchain.Engine()
+	if err := engine.Prepare(chain.blockchain, header); err != nil {
+		return nil, err
+	}
+
+	var txs []*types.Transaction
+	var receipts []*types.Receipt
+	var receipt *types.Receipt
+	tracer := newTracer()
+	if tx != nil {
+		gasPool := new(core.GasPool).AddGas(header.GasLimit)
+		statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+		receipt, _, err = core.ApplyTransaction(
+			chain.config,
+			chain.blockchain,
+			&header.Coinbase,
+			gasPool,
+			statedb,
+			header,
+			tx,
+			&header.GasUsed,
+			vm.Config{Debug: true, Tracer: tracer},
+		)
+		if err != nil {
+			return nil, err
+		}
+		txs, receipts = append(txs, tx), append(receipts, receipt)
+	}
+
+	block, err := engine.Finalize(chain.blockchain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := chain.blockchain.InsertChain(types.Blocks{block}); err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		chain.traces[tx.Hash()] = tracer.execTrace()
+	}
+	return receipt, nil
+}
+
+// A transaction or call to sign and send, or to run without mining it. To
+// is nil for contract creations.
+type Message struct {
+	From     common.Address
+	To       *common.Address
+	Gas      uint64
+	GasPrice *big.Int
+	Value    *big.Int
+	Data     []byte
+}
+
+// Signs a transaction from one of the unlocked accounts, and sends it.
+// Unless the message says otherwise, it pays the default gas price, and
+// can use up to the block gas limit, as with Hardhat. An estimate would only
+// be enough for the transaction not to fail, not for its calls not to.
+func (chain *Chain) Send(message Message) (common.Hash, error) {
+	key, ok := chain.keys[message.From]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("%s isn't one of the unlocked accounts.", message.From.Hex())
+	}
+	if message.Value == nil {
+		message.Value = new(big.Int)
+	}
+	if message.GasPrice == nil {
+		message.GasPrice = defaultGasPrice
+	}
+	if message.Gas == 0 {
+		message.Gas = blockGasLimit
+	}
+
+	// The lock is held from choosing the nonce until the transaction is
+	// mined, so that concurrent sends from one account get nonces in turn.
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	nonce, err := chain.nonce(message.From)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var tx *types.Transaction
+	if message.To == nil {
+		tx = types.NewContractCreation(nonce, message.Value, message.Gas, message.GasPrice, message.Data)
+	} else {
+		tx = types.NewTransaction(nonce, *message.To, message.Value, message.Gas, message.GasPrice, message.Data)
+	}
+	tx, err = types.SignTx(tx, types.NewEIP155Signer(chain.config.ChainID), key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return chain.sendTransaction(tx)
+}
+
+// A block, or the latest block if number is nil. It's nil if there's no such
+// block.
+func (chain *Chain) Block(number *uint64) *types.Block {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	if number == nil {
+		return chain.blockchain.CurrentBlock()
+	}
+	return chain.blockchain.GetBlockByNumber(*number)
+}
+
+func (chain *Chain) BlockByHash(hash common.Hash) *types.Block {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return chain.blockchain.GetBlockByHash(hash)
+}
+
+// A mined transaction, along with the block it's in and its index there. The
+// transaction is nil if it hasn't been mined.
+func (chain *Chain) Transaction(hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return rawdb.ReadTransaction(chain.database, hash)
+}
+
+// The receipt of a mined transaction, or nil if it hasn't been mined.
+func (chain *Chain) Receipt(hash common.Hash) *types.Receipt {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	receipt, _, _, _ := rawdb.ReadReceipt(chain.database, hash)
+	return receipt
+}
+
+// The account that sent a transaction.
+func (chain *Chain) Sender(tx *types.Transaction, number uint64) (common.Address, error) {
+	return types.Sender(types.MakeSigner(chain.config, new(big.Int).SetUint64(number)), tx)
+}
+
+func (chain *Chain) Nonce(address common.Address) (uint64, error) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return chain.nonce(address)
+}
+
+// The lock must be held.
+func (chain *Chain) nonce(address common.Address) (uint64, error) {
+	statedb, err := chain.blockchain.StateAt(chain.blockchain.CurrentBlock().Root())
+	if err != nil {
+		return 0, err
+	}
+	return statedb.GetNonce(address), nil
+}
+
+// The state after a block, or after the latest block if number is nil.
+func (chain *Chain) State(number *uint64) (*state.StateDB, *types.Header, error) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	block := chain.blockchain.CurrentBlock()
+	if number != nil {
+		block = chain.blockchain.GetBlockByNumber(*number)
+	}
+	if block == nil {
+		return nil, nil, errors.New("No such block.")
+	}
+	statedb, err := chain.blockchain.StateAt(block.Root())
+	return statedb, block.Header(), err
+}
+
+// Runs a message against the state after a block, or after the latest
+// block if number is nil, without mining it, and returns what it returned.
+// It fails if the message reverts.
+func (chain *Chain) Call(message Message, number *uint64) ([]byte, error) {
+	output, _, failed, err := chain.call(message, number)
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		return nil, fmt.Errorf("VM Exception while processing transaction: %s", abi.DecodeRevert(output, nil))
+	}
+	return output, nil
+}
+
+func (chain *Chain) call(message Message, number *uint64) ([]byte, uint64, bool, error) {
+	statedb, header, err := chain.State(number)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if message.Gas == 0 {
+		message.Gas = header.GasLimit
+	}
+	if message.GasPrice == nil {
+		message.GasPrice = new(big.Int)
+	}
+	if message.Value == nil {
+		message.Value = new(big.Int)
+	}
+
+	msg := types.NewMessage(message.From, message.To, 0, message.Value, message.Gas, message.GasPrice, message.Data, false)
+	chain.lock.Lock()
+	evmContext := core.NewEVMContext(msg, header, chain.blockchain, nil)
+	chain.lock.Unlock()
+	evm := vm.NewEVM(evmContext, statedb, chain.config, vm.Config{})
+	return core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+}
+
+// The least gas a message needs to not fail, found by binary search.
+func (chain *Chain) EstimateGas(message Message) (uint64, error) {
+	runs := func(gas uint64) bool {
+		message.Gas = gas
+		_, _, failed, err := chain.call(message, nil)
+		return err == nil && !failed
+	}
+
+	low, high := uint64(params.TxGas-1), uint64(blockGasLimit)
+	message.Gas = high
+	output, _, failed, err := chain.call(message, nil)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		return 0, fmt.Errorf("VM Exception while processing transaction: %s", abi.DecodeRevert(output, nil))
+	}
+	for low+1 < high {
+		middle := (low + high) / 2
+		if runs(middle) {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	return high, nil
+}
+
+// Saves the state of the chain, and returns the ID to revert to it with.
+func (chain *Chain) Snapshot() uint64 {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	id := chain.nextSnapshot
+	chain.nextSnapshot++
+	chain.snapshots[id] = chain.blockchain.CurrentBlock().NumberU64()
+	return id
+}
+
+// Reverts the chain to a snapshot, dropping it and any taken after it, as
+// Ganache does. It returns false if there's no such snapshot.
+func (chain *Chain) Revert(id uint64) (bool, error) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+
+	number, ok := chain.snapshots[id]
+	if !ok {
+		return false, nil
+	}
+	for other := range chain.snapshots {
+		if other >= id {
+			delete(chain.snapshots, other)
+		}
+	}
+
+	for current := chain.blockchain.CurrentBlock().NumberU64(); current > number; current-- {
+		for _, tx := range chain.blockchain.GetBlockByNumber(current).Transactions() {
+			delete(chain.traces, tx.Hash())
+		}
+	}
+	return true, chain.blockchain.SetHead(number)
+}
+
+// Moves the time of the blocks mined from now on ahead, and returns how far
+// ahead it is in all.
+func (chain *Chain) IncreaseTime(seconds int64) int64 {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.timeAdjustment += seconds
+	return chain.timeAdjustment
+}
@@ -0,0 +1,57 @@
+package devchain
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Serves a chain's JSON-RPC API over HTTP.
+type Server struct {
+	rpc    *rpc.Server
+	server *http.Server
+	url    string
+}
+
+func NewServer(chain *Chain) (*Server, error) {
+	server := &Server{rpc: rpc.NewServer()}
+	apis := map[string]interface{}{
+		"eth":   &EthAPI{chain},
+		"net":   &NetAPI{chain},
+		"web3":  &Web3API{},
+		"evm":   &EVMAPI{chain},
+		"trace": &TraceAPI{chain},
+	}
+	for namespace, api := range apis {
+		if err := server.rpc.RegisterName(namespace, api); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// Starts serving on an address like localhost:8545. Port 0 picks any free
+// port; URL gives the one picked.
+func (server *Server) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	server.url = "http://" + listener.Addr().String()
+	server.server = &http.Server{Handler: server.rpc}
+	go server.server.Serve(listener)
+	return nil
+}
+
+func (server *Server) URL() string {
+	return server.url
+}
+
+func (server *Server) Close() error {
+	server.rpc.Stop()
+	if server.server == nil {
+		return nil
+	}
+	return server.server.Close()
+}
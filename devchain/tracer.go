@@ -0,0 +1,151 @@
+package devchain
+
+import (
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// A vm.Tracer that builds a Parity vmTrace as a transaction runs. What an op
+// pushed, the memory it wrote and the gas left after it are only known at
+// the next op of the same call, so each call's last op is held until then.
+type tracer struct {
+	frames []*frame
+	trace  *parity.VMTrace
+	output []byte
+}
+
+type frame struct {
+	vmTrace *parity.VMTrace
+	// The index of the op waiting for what it did, or -1.
+	pending   int
+	stackLen  int
+	pops      int
+	memOffset uint64
+	memSize   uint64
+}
+
+func newTracer() *tracer {
+	return &tracer{}
+}
+
+// The trace of the transaction, once it has run.
+func (tracer *tracer) execTrace() parity.ExecTrace {
+	execTrace := parity.ExecTrace{Output: "0x" + hex.EncodeToString(tracer.output)}
+	if tracer.trace != nil {
+		execTrace.VMTrace = *tracer.trace
+	} else {
+		execTrace.VMTrace = parity.VMTrace{Code: "0x", Ops: []parity.Operation{}}
+	}
+	return execTrace
+}
+
+func (tracer *tracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (tracer *tracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	// Calls that returned
+	for len(tracer.frames) > depth {
+		tracer.frames = tracer.frames[:len(tracer.frames)-1]
+	}
+
+	// A new call, made by the op waiting in the frame below
+	if len(tracer.frames) < depth {
+		vmTrace := &parity.VMTrace{Code: "0x" + hex.EncodeToString(contract.Code), Ops: []parity.Operation{}}
+		if len(tracer.frames) == 0 {
+			tracer.trace = vmTrace
+		} else if caller := tracer.frames[len(tracer.frames)-1]; caller.pending >= 0 {
+			caller.vmTrace.Ops[caller.pending].Sub = vmTrace
+		}
+		tracer.frames = append(tracer.frames, &frame{vmTrace: vmTrace, pending: -1})
+	}
+
+	current := tracer.frames[len(tracer.frames)-1]
+	if current.pending >= 0 {
+		current.finish(gas, memory, stack)
+	}
+
+	opCode := hex.EncodeToString([]byte{byte(op)})
+	operation := parity.Operation{PC: int(pc), Cost: int(cost)}
+	operation.Ex.Used = int(gas) - int(cost)
+	if op == vm.SSTORE && len(stack.Data()) >= 2 {
+		operation.Ex.Store = &parity.StorageWrite{
+			Key: quantity(stack.Back(0)),
+			Val: quantity(stack.Back(1)),
+		}
+	}
+	current.vmTrace.Ops = append(current.vmTrace.Ops, operation)
+	current.pending = len(current.vmTrace.Ops) - 1
+	current.stackLen = len(stack.Data())
+	current.pops = evmbytecode.StackPops(opCode)
+	current.memOffset, current.memSize = memoryWritten(op, stack)
+	return nil
+}
+
+func (tracer *tracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (tracer *tracer) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	tracer.output = output
+	return nil
+}
+
+// Fills in what the pending op did from the state after it. Like Parity, DUP
+// and SWAP count the items they took as pushed too.
+func (frame *frame) finish(gas uint64, memory *vm.Memory, stack *vm.Stack) {
+	operation := &frame.vmTrace.Ops[frame.pending]
+	operation.Ex.Used = int(gas)
+
+	count := len(stack.Data()) - frame.stackLen + frame.pops
+	for i := count - 1; i >= 0 && i < len(stack.Data()); i-- {
+		operation.Ex.Push = append(operation.Ex.Push, quantity(stack.Back(i)))
+	}
+
+	data := memory.Data()
+	if frame.memSize != 0 && frame.memOffset+frame.memSize <= uint64(len(data)) {
+		operation.Ex.Mem = &parity.MemoryWrite{
+			Off:  int(frame.memOffset),
+			Data: "0x" + hex.EncodeToString(data[frame.memOffset:frame.memOffset+frame.memSize]),
+		}
+	}
+	frame.pending = -1
+}
+
+// The region of memory an op is about to write, from its arguments.
+func memoryWritten(op vm.OpCode, stack *vm.Stack) (uint64, uint64) {
+	arg := func(n int) uint64 {
+		if n >= len(stack.Data()) || !stack.Back(n).IsUint64() {
+			return 0
+		}
+		return stack.Back(n).Uint64()
+	}
+
+	switch op {
+	case vm.MSTORE:
+		return arg(0), 32
+	case vm.MSTORE8:
+		return arg(0), 1
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		return arg(0), arg(2)
+	case vm.EXTCODECOPY:
+		return arg(1), arg(3)
+	case vm.CALL, vm.CALLCODE:
+		return arg(5), arg(6)
+	case vm.DELEGATECALL, vm.STATICCALL:
+		return arg(4), arg(5)
+	}
+	return 0, 0
+}
+
+// Formats a stack item the way Parity does, as hex without leading zeros.
+func quantity(value *big.Int) string {
+	return "0x" + value.Text(16)
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/reserve-protocol/solstice/abi"
+)
+
+// How many times an event was emitted. Contracts are all of those that
+// declare it.
+type EventStats struct {
+	Signature string   `json:"signature"`
+	Contracts []string `json:"contracts"`
+	Emitted   int      `json:"emitted"`
+}
+
+// Counts the logs emitted for each declared event, so that events that were
+// never emitted, which usually means an untested path, stand out.
+type Coverage struct {
+	declared map[string]abi.DeclaredEvent
+	counts   map[string]int
+}
+
+func NewCoverage(declared map[string]abi.DeclaredEvent) *Coverage {
+	return &Coverage{
+		declared: declared,
+		counts:   make(map[string]int),
+	}
+}
+
+// Counts a log by its first topic. Logs of anonymous or undeclared events are
+// ignored.
+func (coverage *Coverage) Add(topics [][]byte) {
+	if len(topics) == 0 {
+		return
+	}
+	topic := hex.EncodeToString(topics[0])
+	if _, ok := coverage.declared[topic]; ok {
+		coverage.counts[topic]++
+	}
+}
+
+// Every declared event, with those never emitted first, then by signature.
+func (coverage *Coverage) Report() []EventStats {
+	var report []EventStats
+	for topic, event := range coverage.declared {
+		report = append(report, EventStats{
+			Signature: event.Entry.Signature(),
+			Contracts: event.Contracts,
+			Emitted:   coverage.counts[topic],
+		})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if (report[i].Emitted == 0) != (report[j].Emitted == 0) {
+			return report[i].Emitted == 0
+		}
+		return report[i].Signature < report[j].Signature
+	})
+	return report
+}
+
+func PrintTable(out io.Writer, report []EventStats) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Event\tEmitted\tDeclared by\t")
+	for _, stats := range report {
+		emitted := fmt.Sprint(stats.Emitted)
+		if stats.Emitted == 0 {
+			emitted = "never"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t\n", stats.Signature, emitted, strings.Join(stats.Contracts, ", "))
+	}
+	return writer.Flush()
+}
+
+func WriteJSON(filename string, report []EventStats) error {
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, reportJSON, 0644)
+}
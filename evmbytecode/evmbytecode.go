@@ -1,30 +1,28 @@
 package evmbytecode
 
 import (
-	"errors"
 	"strings"
 )
 
 // This function zeros-out the meta data stored in the bytecode. It is a hash
 // of all compilation context, and is impractical to reproduce. Documented here;
 // https://solidity.readthedocs.io/en/v0.5.1/metadata.html
+// Bytecode that isn't hex prefixed with 0x, or whose metadata is malformed, is
+// returned unchanged, since it can't have come from solc and won't match any
+// compiled contract either way.
 func RemoveMetaData(bytecode string) string {
-	if len(bytecode) < 2 || !strings.HasPrefix(bytecode, "0x") {
-		panic(errors.New("Bytecode must start with 0x."))
-	}
-
-	if bytecode == "0x" || len(bytecode) < 18+64+4 {
+	if !strings.HasPrefix(bytecode, "0x") || len(bytecode) < 18+64+4 {
 		return bytecode
 	}
 
 	metadataIndex := strings.Index(bytecode, "a165627a7a72305820")
 
-	if metadataIndex == -1 {
+	if metadataIndex == -1 || len(bytecode) < metadataIndex+18+64+4 {
 		return bytecode
 	}
 
 	if bytecode[metadataIndex+18+64:metadataIndex+18+64+4] != "0029" {
-		panic(errors.New("Metadata malformed."))
+		return bytecode
 	}
 
 	// If everything looks fine, replace metadata hash with 0's
@@ -49,12 +47,9 @@ func GetPcToOpIndex(bytecode string) map[int]int {
 		if index%2 == 0 {
 			firstByteRune = char
 			continue
-		} else if index%2 == 1 {
-			currentByte = string(firstByteRune) + string(char)
-			byteIndex = index / 2
-		} else {
-			panic("This is logically impossible.")
 		}
+		currentByte = string(firstByteRune) + string(char)
+		byteIndex = index / 2
 
 		// Now you have currentByte and byteIndex
 
@@ -76,6 +71,15 @@ func GetPcToOpIndex(bytecode string) map[int]int {
 	return pcToOpIndex
 }
 
+// The hex-encoded op code at the given program counter, e.g. "fd" for REVERT.
+func OpCodeAt(bytecode string, pc int) string {
+	code := strings.TrimPrefix(bytecode, "0x")
+	if pc < 0 || len(code) < 2*pc+2 {
+		return ""
+	}
+	return code[2*pc : 2*pc+2]
+}
+
 func bytesPushed(targetOpCode string) int {
 	var pushOps = [...]string{
 		"60",
@@ -0,0 +1,260 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/geth"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// How a node can trace all of the transactions in a block at once.
+type blockTracer int
+
+const (
+	unknownTracer blockTracer = iota
+	parityTracer              // trace_replayBlockTransactions
+	gethTracer                // debug_traceBlockByNumber
+	noTracer                  // Transactions have to be traced one at a time.
+)
+
+// Memory is left out of block traces, since it's logged in full at every
+// step. Older versions of geth log it unless it's disabled, and newer ones
+// only if it's enabled. Only transactions that create contracts need it, for
+// the init code, so they're traced again with it.
+var (
+	gethTraceOptions       = map[string]interface{}{"disableStorage": true, "disableMemory": true}
+	gethMemoryTraceOptions = map[string]interface{}{"disableStorage": true, "enableMemory": true}
+)
+
+// Traces the transactions to contracts in the blocks from first to last,
+// inclusive, handing each trace to handle along with its transaction. Whole
+// blocks are traced at once if the node supports it, which saves a round trip
+// for each transaction and a look up of the code of each recipient. Blocks
+// aren't handled in any particular order.
+func (fetcher *Fetcher) BlockTraces(
+	ctx context.Context,
+	first uint64,
+	last uint64,
+	handle func(txn Transaction, execTrace parity.ExecTrace) error,
+) error {
+	if first > last {
+		return nil
+	}
+	if fetcher.config.Offline {
+		return errors.New("Blocks can't be traced offline; only transactions whose traces were cached can.")
+	}
+	blocks, err := fetcher.blocks(ctx, first, last)
+	if err != nil {
+		return err
+	}
+
+	if fetcher.tracer == unknownTracer {
+		if fetcher.tracer, err = fetcher.detectTracer(ctx, first); err != nil {
+			return err
+		}
+	}
+	switch fetcher.tracer {
+	case parityTracer:
+		return fetcher.parityBlockTraces(ctx, first, blocks, handle)
+	case gethTracer:
+		return fetcher.gethBlockTraces(ctx, first, blocks, handle)
+	}
+
+	txns, err := fetcher.contractTransactions(ctx, blocks)
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, len(txns))
+	for i, txn := range txns {
+		hashes[i] = txn.Hash
+	}
+	return fetcher.Traces(ctx, hashes, func(index int, execTrace parity.ExecTrace) error {
+		return handle(txns[index], execTrace)
+	})
+}
+
+// Finds out which block tracing method the node supports by tracing a block
+// with each of them. Any error from the node itself means the method isn't
+// available, or isn't enabled.
+func (fetcher *Fetcher) detectTracer(ctx context.Context, block uint64) (blockTracer, error) {
+	probes := []struct {
+		tracer blockTracer
+		call   call
+	}{
+		{parityTracer, call{"trace_replayBlockTransactions", []interface{}{hexNumber(block), []string{"vmTrace"}}}},
+		{gethTracer, call{"debug_traceBlockByNumber", []interface{}{hexNumber(block), gethTraceOptions}}},
+	}
+	for _, probe := range probes {
+		_, err := fetcher.batch(ctx, []call{probe.call})
+		if _, unsupported := err.(*RPCError); unsupported {
+			continue
+		}
+		if err != nil {
+			return unknownTracer, err
+		}
+		return probe.tracer, nil
+	}
+	return noTracer, nil
+}
+
+// Plain transfers of ether to accounts without code have empty traces.
+func ranCode(txn Transaction, execTrace parity.ExecTrace) bool {
+	return txn.To != "" && execTrace.Code != "" && execTrace.Code != "0x" && len(execTrace.Ops) != 0
+}
+
+func (fetcher *Fetcher) parityBlockTraces(
+	ctx context.Context,
+	first uint64,
+	blocks [][]Transaction,
+	handle func(txn Transaction, execTrace parity.ExecTrace) error,
+) error {
+	calls := make([]call, len(blocks))
+	for i := range blocks {
+		calls[i] = call{"trace_replayBlockTransactions", []interface{}{hexNumber(first + uint64(i)), []string{"vmTrace"}}}
+	}
+
+	return fetcher.run(ctx, "Tracing blocks", calls, func(index int, raw json.RawMessage) error {
+		var rawResults []json.RawMessage
+		if err := json.Unmarshal(raw, &rawResults); err != nil {
+			return err
+		}
+		execTraces := make(map[string]parity.ExecTrace)
+		rawTraces := make(map[string]json.RawMessage)
+		for _, rawResult := range rawResults {
+			var result struct {
+				TransactionHash string
+				parity.ExecTrace
+			}
+			if err := json.Unmarshal(rawResult, &result); err != nil {
+				return err
+			}
+			hash := strings.ToLower(result.TransactionHash)
+			execTraces[hash] = result.ExecTrace
+			rawTraces[hash] = rawResult
+		}
+
+		for _, txn := range blocks[index] {
+			execTrace, ok := execTraces[strings.ToLower(txn.Hash)]
+			if !ok {
+				return fmt.Errorf("Block %d has no trace of %s.", txn.BlockNumber, txn.Hash)
+			}
+			if !ranCode(txn, execTrace) {
+				continue
+			}
+			if err := execTrace.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", txn.Hash, err)
+			}
+			fetcher.cacheTrace(txn.Hash, rawTraces[strings.ToLower(txn.Hash)])
+			if err := handle(txn, execTrace); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (fetcher *Fetcher) gethBlockTraces(
+	ctx context.Context,
+	first uint64,
+	blocks [][]Transaction,
+	handle func(txn Transaction, execTrace parity.ExecTrace) error,
+) error {
+	calls := make([]call, len(blocks))
+	for i := range blocks {
+		calls[i] = call{"debug_traceBlockByNumber", []interface{}{hexNumber(first + uint64(i)), gethTraceOptions}}
+	}
+
+	// Struct logs are large even without memory, so each block gets a
+	// request of its own.
+	return fetcher.runBatches(ctx, "Tracing blocks", calls, 1, func(index int, raw json.RawMessage) error {
+		// Older versions of geth don't give the hash, so results are matched
+		// to transactions by their order in the block.
+		var results []struct {
+			Result geth.Result
+		}
+		if err := json.Unmarshal(raw, &results); err != nil {
+			return err
+		}
+		block := blocks[index]
+		if len(results) != len(block) {
+			return fmt.Errorf("Block %d has %d traces for %d transactions.", first+uint64(index), len(results), len(block))
+		}
+
+		codes := make(map[string]string)
+		codeAt := func(address string) (string, error) {
+			if code, ok := codes[address]; ok {
+				return code, nil
+			}
+			results, err := fetcher.batch(ctx, []call{{"eth_getCode", []interface{}{address, hexNumber(first + uint64(index))}}})
+			if err != nil {
+				return "", err
+			}
+			var code string
+			if err := json.Unmarshal(results[0], &code); err != nil {
+				return "", err
+			}
+			codes[address] = code
+			return code, nil
+		}
+
+		for i, txn := range block {
+			if txn.To == "" || len(results[i].Result.StructLogs) == 0 {
+				continue
+			}
+			result := results[i].Result
+			withMemory := createsContracts(result.StructLogs)
+			if withMemory {
+				var err error
+				if result, err = fetcher.gethMemoryTrace(ctx, txn.Hash); err != nil {
+					return err
+				}
+			}
+			code, err := codeAt(txn.To)
+			if err != nil {
+				return err
+			}
+			execTrace, err := result.ExecTrace(code, codeAt)
+			if err != nil {
+				return err
+			}
+			if !ranCode(txn, execTrace) {
+				continue
+			}
+			// A trace without memory would replace any full one in the
+			// cache, and readers of the cache can't tell the difference.
+			if raw, err := json.Marshal(execTrace); err == nil && withMemory {
+				fetcher.cacheTrace(txn.Hash, raw)
+			}
+			if err := handle(txn, execTrace); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Whether the struct logs have a contract creation that ran init code, which
+// can only be read from memory.
+func createsContracts(logs []geth.StructLog) bool {
+	for i, log := range logs {
+		if (log.Op == "CREATE" || log.Op == "CREATE2") && i+1 < len(logs) && logs[i+1].Depth > log.Depth {
+			return true
+		}
+	}
+	return false
+}
+
+// Traces a transaction with its memory.
+func (fetcher *Fetcher) gethMemoryTrace(ctx context.Context, hash string) (geth.Result, error) {
+	var result geth.Result
+	results, err := fetcher.batch(ctx, []call{{"debug_traceTransaction", []interface{}{hash, gethMemoryTraceOptions}}})
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(results[0], &result)
+	return result, err
+}
@@ -0,0 +1,51 @@
+package fetch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+var errNoCache = errors.New("There's no trace cache to work offline from.")
+
+// Saves a trace to the cache, if there is one. A trace that can't be cached
+// is only worth a warning, since it was fetched all the same.
+func (fetcher *Fetcher) cacheTrace(hash string, result json.RawMessage) {
+	if fetcher.config.Cache == nil {
+		return
+	}
+	if err := fetcher.config.Cache.Put(hash, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't cache the trace of %s: %v\n", hash, err)
+	}
+}
+
+// Reads traces from the cache, as Traces does from the node.
+func (fetcher *Fetcher) cachedTraces(hashes []string, handle func(index int, execTrace parity.ExecTrace) error) error {
+	if fetcher.config.Cache == nil {
+		return errNoCache
+	}
+	progress := newProgress(fetcher.config.Progress, "Reading cached traces", len(hashes))
+	defer progress.finish()
+
+	for index, hash := range hashes {
+		result, err := fetcher.config.Cache.Get(hash, []string{"vmTrace"})
+		if err != nil {
+			return fmt.Errorf("%s: %w", hash, err)
+		}
+		var execTrace parity.ExecTrace
+		if err := json.Unmarshal(result, &execTrace); err != nil {
+			return err
+		}
+		if err := execTrace.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", hash, err)
+		}
+		if err := handle(index, execTrace); err != nil {
+			return err
+		}
+		progress.add(1)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package fetch
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+// Concurrency is the number of requests in flight at once, and BatchSize the
+// number of calls in each. Failed requests are retried up to Retries times,
+// 3 unless it's set, or not at all if it's negative, waiting Backoff before
+// the first retry and twice as long before each one after. Progress is
+// written to Progress, if it's set. Traces are saved to Cache, if it's set,
+// and read from it instead of the node if Offline is.
+type Config struct {
+	URL         string
+	Concurrency int
+	BatchSize   int
+	Retries     int
+	Backoff     time.Duration
+	Progress    io.Writer
+	Cache       *tracecache.Cache
+	Offline     bool
+}
+
+// Fetches blocks, code, receipts and traces from a node in parallel batches.
+// A Fetcher isn't safe to use from more than one goroutine at a time.
+type Fetcher struct {
+	config Config
+	client *http.Client
+	tracer blockTracer
+}
+
+func New(config Config) *Fetcher {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 8
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 20
+	}
+	if config.Retries == 0 {
+		config.Retries = 3
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 100 * time.Millisecond
+	}
+	return &Fetcher{
+		config: config,
+		client: &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: config.Concurrency}},
+	}
+}
+
+// A transaction that was sent to an account with code, as opposed to a plain
+// transfer of ether or a contract creation.
+type Transaction struct {
+	Hash        string
+	To          string
+	Input       []byte
+	BlockNumber uint64
+}
+
+type Log struct {
+	Topics [][]byte
+	Data   []byte
+}
+
+// Makes the calls in batches, spread over the workers, and hands each result
+// to handle as it arrives. handle is only ever called from the calling
+// goroutine, but not in any particular order.
+func (fetcher *Fetcher) run(
+	ctx context.Context,
+	label string,
+	calls []call,
+	handle func(index int, result json.RawMessage) error,
+) error {
+	return fetcher.runBatches(ctx, label, calls, fetcher.config.BatchSize, handle)
+}
+
+// Like run, with batches of batchSize calls rather than BatchSize.
+func (fetcher *Fetcher) runBatches(
+	ctx context.Context,
+	label string,
+	calls []call,
+	batchSize int,
+	handle func(index int, result json.RawMessage) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type batchResult struct {
+		start   int
+		results []json.RawMessage
+		err     error
+	}
+	starts := make(chan int)
+	results := make(chan batchResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < fetcher.config.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for start := range starts {
+				end := start + batchSize
+				if end > len(calls) {
+					end = len(calls)
+				}
+				batchResults, err := fetcher.batch(ctx, calls[start:end])
+				select {
+				case results <- batchResult{start, batchResults, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(starts)
+		for start := 0; start < len(calls); start += batchSize {
+			select {
+			case starts <- start:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	progress := newProgress(fetcher.config.Progress, label, len(calls))
+	defer progress.finish()
+	for result := range results {
+		if result.err != nil {
+			return result.err
+		}
+		for i, raw := range result.results {
+			if err := handle(result.start+i, raw); err != nil {
+				return err
+			}
+		}
+		progress.add(len(result.results))
+	}
+	return ctx.Err()
+}
+
+// The transactions to contracts in the blocks from first to last, inclusive,
+// in the order they were mined.
+func (fetcher *Fetcher) ContractTransactions(ctx context.Context, first uint64, last uint64) ([]Transaction, error) {
+	blocks, err := fetcher.blocks(ctx, first, last)
+	if err != nil {
+		return nil, err
+	}
+	return fetcher.contractTransactions(ctx, blocks)
+}
+
+// The transactions in each block from first to last. Contract creations have
+// no recipient, so their To is empty.
+func (fetcher *Fetcher) blocks(ctx context.Context, first uint64, last uint64) ([][]Transaction, error) {
+	var blockCalls []call
+	for number := first; number <= last && first <= last; number++ {
+		blockCalls = append(blockCalls, call{"eth_getBlockByNumber", []interface{}{hexNumber(number), true}})
+	}
+
+	blocks := make([][]Transaction, len(blockCalls))
+	err := fetcher.run(ctx, "Fetching blocks", blockCalls, func(index int, raw json.RawMessage) error {
+		var block struct {
+			Transactions []struct {
+				Hash  string
+				To    *string
+				Input string
+			}
+		}
+		if err := json.Unmarshal(raw, &block); err != nil {
+			return err
+		}
+		for _, txn := range block.Transactions {
+			input, err := decodeHex(txn.Input)
+			if err != nil {
+				return err
+			}
+			to := ""
+			if txn.To != nil {
+				to = strings.ToLower(*txn.To)
+			}
+			blocks[index] = append(blocks[index], Transaction{
+				Hash:        txn.Hash,
+				To:          to,
+				Input:       input,
+				BlockNumber: first + uint64(index),
+			})
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+// Keeps the transactions that were sent to accounts with code.
+func (fetcher *Fetcher) contractTransactions(ctx context.Context, blocks [][]Transaction) ([]Transaction, error) {
+	// Plain transfers of ether go to accounts without code.
+	type account struct {
+		address string
+		block   uint64
+	}
+	var accounts []account
+	accountIndexes := make(map[account]int)
+	for _, block := range blocks {
+		for _, txn := range block {
+			key := account{txn.To, txn.BlockNumber}
+			if txn.To == "" {
+				continue
+			}
+			if _, ok := accountIndexes[key]; !ok {
+				accountIndexes[key] = len(accounts)
+				accounts = append(accounts, key)
+			}
+		}
+	}
+	codeCalls := make([]call, len(accounts))
+	for i, account := range accounts {
+		codeCalls[i] = call{"eth_getCode", []interface{}{account.address, hexNumber(account.block)}}
+	}
+	hasCode := make([]bool, len(accounts))
+	err := fetcher.run(ctx, "Fetching code", codeCalls, func(index int, raw json.RawMessage) error {
+		var code string
+		if err := json.Unmarshal(raw, &code); err != nil {
+			return err
+		}
+		hasCode[index] = code != "0x" && code != ""
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var txns []Transaction
+	for _, block := range blocks {
+		for _, txn := range block {
+			index, ok := accountIndexes[account{txn.To, txn.BlockNumber}]
+			if ok && hasCode[index] {
+				txns = append(txns, txn)
+			}
+		}
+	}
+	return txns, nil
+}
+
+// The logs of each transaction, in the same order as the hashes.
+func (fetcher *Fetcher) Logs(ctx context.Context, hashes []string) ([][]Log, error) {
+	calls := make([]call, len(hashes))
+	for i, hash := range hashes {
+		calls[i] = call{"eth_getTransactionReceipt", []interface{}{hash}}
+	}
+
+	logs := make([][]Log, len(hashes))
+	err := fetcher.run(ctx, "Fetching receipts", calls, func(index int, raw json.RawMessage) error {
+		var receipt *struct {
+			Logs []struct {
+				Topics []string
+				Data   string
+			}
+		}
+		if err := json.Unmarshal(raw, &receipt); err != nil {
+			return err
+		}
+		if receipt == nil {
+			return fmt.Errorf("Transaction %s has no receipt.", hashes[index])
+		}
+		for _, rawLog := range receipt.Logs {
+			var log Log
+			for _, topic := range rawLog.Topics {
+				topicBytes, err := decodeHex(topic)
+				if err != nil {
+					return err
+				}
+				log.Topics = append(log.Topics, topicBytes)
+			}
+			data, err := decodeHex(rawLog.Data)
+			if err != nil {
+				return err
+			}
+			log.Data = data
+			logs[index] = append(logs[index], log)
+		}
+		return nil
+	})
+	return logs, err
+}
+
+// Traces the transactions, handing each trace to handle along with the index
+// of its hash. Traces can be large, so they aren't kept once handled.
+func (fetcher *Fetcher) Traces(
+	ctx context.Context,
+	hashes []string,
+	handle func(index int, execTrace parity.ExecTrace) error,
+) error {
+	if fetcher.config.Offline {
+		return fetcher.cachedTraces(hashes, handle)
+	}
+
+	calls := make([]call, len(hashes))
+	for i, hash := range hashes {
+		calls[i] = call{"trace_replayTransaction", []interface{}{hash, []string{"vmTrace"}}}
+	}
+
+	return fetcher.run(ctx, "Tracing transactions", calls, func(index int, raw json.RawMessage) error {
+		var execTrace parity.ExecTrace
+		if err := json.Unmarshal(raw, &execTrace); err != nil {
+			return err
+		}
+		if err := execTrace.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", hashes[index], err)
+		}
+		fetcher.cacheTrace(hashes[index], raw)
+		return handle(index, execTrace)
+	})
+}
+
+func hexNumber(number uint64) string {
+	return "0x" + strconv.FormatUint(number, 16)
+}
+
+func decodeHex(value string) ([]byte, error) {
+	value = strings.TrimPrefix(value, "0x")
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+	return hex.DecodeString(value)
+}
@@ -0,0 +1,49 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Shows how far along a fetch is, on one line that is rewritten as it goes.
+type progress struct {
+	out   io.Writer
+	label string
+	total int
+	done  int
+	start time.Time
+}
+
+func newProgress(out io.Writer, label string, total int) *progress {
+	progress := &progress{out: out, label: label, total: total, start: time.Now()}
+	progress.print()
+	return progress
+}
+
+func (progress *progress) add(done int) {
+	progress.done += done
+	progress.print()
+}
+
+func (progress *progress) print() {
+	if progress.out == nil || progress.total == 0 {
+		return
+	}
+	rate := float64(progress.done) / time.Since(progress.start).Seconds()
+	fmt.Fprintf(
+		progress.out,
+		"\r%s: %d of %d done, %d remaining, %.1f/s ",
+		progress.label,
+		progress.done,
+		progress.total,
+		progress.total-progress.done,
+		rate,
+	)
+}
+
+func (progress *progress) finish() {
+	if progress.out != nil && progress.total != 0 {
+		fmt.Fprintln(progress.out)
+	}
+}
@@ -0,0 +1,143 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// A JSON-RPC call, as sent in a batch.
+type call struct {
+	Method string
+	Params []interface{}
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int
+	Result json.RawMessage
+	Error  *RPCError
+}
+
+// An error returned by the node for a single call.
+type RPCError struct {
+	Method  string `json:"-"`
+	Code    int
+	Message string
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("%s: JSON-RPC error %d: %s", err.Method, err.Code, err.Message)
+}
+
+// An error that is likely to go away if the request is tried again, like a
+// dropped connection or an overloaded node.
+type transientError struct {
+	err error
+}
+
+func (err transientError) Error() string {
+	return err.err.Error()
+}
+
+// Sends the calls as one batch request, and returns their results in the same
+// order. Transient failures are retried with exponential backoff.
+func (fetcher *Fetcher) batch(ctx context.Context, calls []call) ([]json.RawMessage, error) {
+	backoff := fetcher.config.Backoff
+	for attempt := 0; ; attempt++ {
+		results, err := fetcher.tryBatch(ctx, calls)
+		if _, transient := err.(transientError); !transient || attempt >= fetcher.config.Retries {
+			return results, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (fetcher *Fetcher) tryBatch(ctx context.Context, calls []call) ([]json.RawMessage, error) {
+	requests := make([]rpcRequest, len(calls))
+	for i, call := range calls {
+		params := call.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		requests[i] = rpcRequest{JSONRPC: "2.0", ID: i, Method: call.Method, Params: params}
+	}
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := fetcher.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var responses []rpcResponse
+	if err := json.NewDecoder(response.Body).Decode(&responses); err != nil {
+		return nil, transientError{err}
+	}
+
+	results := make([]json.RawMessage, len(calls))
+	found := make([]bool, len(calls))
+	for _, response := range responses {
+		if response.ID < 0 || response.ID >= len(calls) {
+			continue
+		}
+		if response.Error != nil {
+			response.Error.Method = calls[response.ID].Method
+			return nil, response.Error
+		}
+		results[response.ID] = response.Result
+		found[response.ID] = true
+	}
+	for i := range found {
+		if !found[i] {
+			return nil, transientError{fmt.Errorf("The node didn't respond to %s.", calls[i].Method)}
+		}
+	}
+	return results, nil
+}
+
+// Posts a request, and returns the response if the node accepted it.
+func (fetcher *Fetcher) post(ctx context.Context, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodPost, fetcher.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := fetcher.client.Do(request.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, transientError{err}
+	}
+
+	if response.StatusCode == http.StatusOK {
+		return response, nil
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	err = fmt.Errorf("The node responded with %s.", response.Status)
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, transientError{err}
+	}
+	return nil, err
+}
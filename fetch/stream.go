@@ -0,0 +1,213 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// Streams the trace of each transaction op by op, for traces too large to
+// hold in memory. Each transaction gets a request of its own, since a batch
+// response can't be walked one trace at a time. Calls to visit don't overlap,
+// but the ops of different transactions are interleaved; index says which
+// transaction an op belongs to.
+func (fetcher *Fetcher) StreamTraces(
+	ctx context.Context,
+	hashes []string,
+	skip parity.Skip,
+	visit func(index int, depth int, code string, op parity.Operation) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	progress := newProgress(fetcher.config.Progress, "Tracing transactions", len(hashes))
+	defer progress.finish()
+
+	indexes := make(chan int)
+	errs := make(chan error, fetcher.config.Concurrency)
+	var workers sync.WaitGroup
+	for i := 0; i < fetcher.config.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range indexes {
+				err := fetcher.streamTrace(ctx, hashes[index], skip, func(depth int, code string, op parity.Operation) error {
+					lock.Lock()
+					defer lock.Unlock()
+					return visit(index, depth, code, op)
+				})
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", hashes[index], err)
+					cancel()
+					return
+				}
+				lock.Lock()
+				progress.add(1)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	func() {
+		defer close(indexes)
+		for index := range hashes {
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	workers.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+func (fetcher *Fetcher) streamTrace(ctx context.Context, hash string, skip parity.Skip, visit parity.OpVisitor) error {
+	if fetcher.config.Offline {
+		if fetcher.config.Cache == nil {
+			return errNoCache
+		}
+		reader, err := fetcher.config.Cache.Reader(hash)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return streamResponse(json.NewDecoder(reader), skip, visit)
+	}
+
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "trace_replayTransaction",
+		Params:  []interface{}{hash, []string{"vmTrace"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only failures before the trace starts arriving are retried, since ops
+	// that were already visited can't be taken back.
+	var response *http.Response
+	backoff := fetcher.config.Backoff
+	for attempt := 0; ; attempt++ {
+		response, err = fetcher.post(ctx, body)
+		if _, transient := err.(transientError); !transient || attempt >= fetcher.config.Retries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// The response is cached as it's read, and kept only if it all was.
+	if fetcher.config.Cache == nil {
+		return streamResponse(json.NewDecoder(response.Body), skip, visit)
+	}
+	writer, err := fetcher.config.Cache.Writer(hash)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(io.TeeReader(response.Body, writer))
+	if err := streamResponse(decoder, skip, visit); err != nil {
+		writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
+
+// Walks a JSON-RPC response to trace_replayTransaction, streaming the
+// vmTrace in its result.
+func streamResponse(decoder *json.Decoder, skip parity.Skip, visit parity.OpVisitor) error {
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return errors.New("The node's response wasn't a JSON-RPC response.")
+	}
+
+	foundResult := false
+	for decoder.More() {
+		var key string
+		if err := decoder.Decode(&key); err != nil {
+			return err
+		}
+		switch strings.ToLower(key) {
+		case "error":
+			var rpcError RPCError
+			if err := decoder.Decode(&rpcError); err != nil {
+				return err
+			}
+			rpcError.Method = "trace_replayTransaction"
+			return &rpcError
+		case "result":
+			var err error
+			foundResult, err = streamResult(decoder, skip, visit)
+			if err != nil {
+				return err
+			}
+		default:
+			if err := parity.SkipValue(decoder); err != nil {
+				return err
+			}
+		}
+	}
+	if !foundResult {
+		return parity.ErrTxNotFound
+	}
+	return nil
+}
+
+// Streams the vmTrace of a result, and says whether there was one.
+func streamResult(decoder *json.Decoder, skip parity.Skip, visit parity.OpVisitor) (bool, error) {
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return false, err
+	}
+	if token != json.Delim('{') {
+		return false, fmt.Errorf("Expected a trace, but found %v.", token)
+	}
+
+	found := false
+	for decoder.More() {
+		var key string
+		if err := decoder.Decode(&key); err != nil {
+			return found, err
+		}
+		if !strings.EqualFold(key, "vmTrace") {
+			if err := parity.SkipValue(decoder); err != nil {
+				return found, err
+			}
+			continue
+		}
+
+		code, err := parity.StreamVMTrace(decoder, skip, visit)
+		if err != nil {
+			return found, err
+		}
+		if code == "0x" {
+			return found, parity.ErrNoBytecode
+		}
+		found = code != ""
+	}
+	_, err = decoder.Token()
+	return found, err
+}
@@ -0,0 +1,153 @@
+package gas
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The gas used by one function or line in two runs. A zero Base means it's
+// new in the head run, and a zero Head means it's gone.
+type Change struct {
+	Name       string
+	Base       int
+	Head       int
+	Regression bool
+}
+
+func (change Change) Percent() float64 {
+	if change.Base == 0 {
+		return 0
+	}
+	return float64(change.Head-change.Base) / float64(change.Base) * 100
+}
+
+type Comparison struct {
+	Threshold float64
+	Functions []Change
+	Lines     []Change
+}
+
+// Compares the average gas of each function and the total gas of each line.
+// Increases of more than threshold percent are marked as regressions.
+func Compare(base Report, head Report, threshold float64) Comparison {
+	return Comparison{
+		Threshold: threshold,
+		Functions: changes(functionAverages(base), functionAverages(head), threshold),
+		Lines:     changes(lineTotals(base), lineTotals(head), threshold),
+	}
+}
+
+type namedGas struct {
+	name string
+	gas  int
+}
+
+func functionAverages(report Report) []namedGas {
+	var averages []namedGas
+	for _, stats := range report.Functions {
+		averages = append(averages, namedGas{stats.Contract + " " + stats.Signature, stats.Average})
+	}
+	return averages
+}
+
+func lineTotals(report Report) []namedGas {
+	var totals []namedGas
+	for _, stats := range report.Lines {
+		totals = append(totals, namedGas{fmt.Sprintf("%s:%d", stats.File, stats.Line), stats.Gas})
+	}
+	return totals
+}
+
+// Only names whose gas differs between the runs are kept. They are kept in the
+// head run's order, followed by any names that only the base run has.
+func changes(base []namedGas, head []namedGas, threshold float64) []Change {
+	baseGas := make(map[string]int)
+	for _, entry := range base {
+		baseGas[entry.name] = entry.gas
+	}
+	headGas := make(map[string]int)
+	var names []string
+	for _, entry := range head {
+		headGas[entry.name] = entry.gas
+		names = append(names, entry.name)
+	}
+	for _, entry := range base {
+		if _, ok := headGas[entry.name]; !ok {
+			names = append(names, entry.name)
+		}
+	}
+
+	var changes []Change
+	for _, name := range names {
+		change := Change{Name: name, Base: baseGas[name], Head: headGas[name]}
+		if change.Base == change.Head {
+			continue
+		}
+		change.Regression = change.Base != 0 && change.Percent() > threshold
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func (comparison Comparison) Regressions() int {
+	regressions := 0
+	for _, change := range append(append([]Change(nil), comparison.Functions...), comparison.Lines...) {
+		if change.Regression {
+			regressions += 1
+		}
+	}
+	return regressions
+}
+
+// Renders the comparison as Markdown suitable for a pull request comment.
+func (comparison Comparison) Markdown() string {
+	var markdown strings.Builder
+	markdown.WriteString("## Gas report\n\n")
+
+	if len(comparison.Functions) == 0 && len(comparison.Lines) == 0 {
+		markdown.WriteString("No changes in gas usage.\n")
+		return markdown.String()
+	}
+
+	fmt.Fprintf(
+		&markdown,
+		"%d regression(s) over %g%%.\n\n",
+		comparison.Regressions(),
+		comparison.Threshold,
+	)
+
+	writeTable(&markdown, "Function (average gas)", comparison.Functions)
+	writeTable(&markdown, "Line (total gas)", comparison.Lines)
+	return markdown.String()
+}
+
+func writeTable(markdown *strings.Builder, title string, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(markdown, "| %s | Base | Head | Change |\n", title)
+	markdown.WriteString("| --- | ---: | ---: | ---: |\n")
+	for _, change := range changes {
+		var difference string
+		if change.Base == 0 {
+			difference = "new"
+		} else if change.Head == 0 {
+			difference = "removed"
+		} else {
+			difference = fmt.Sprintf("%+d (%+.1f%%)", change.Head-change.Base, change.Percent())
+		}
+		if change.Regression {
+			difference = "**" + difference + "** :warning:"
+		}
+		fmt.Fprintf(
+			markdown,
+			"| `%s` | %d | %d | %s |\n",
+			change.Name,
+			change.Base,
+			change.Head,
+			difference,
+		)
+	}
+	markdown.WriteString("\n")
+}
@@ -0,0 +1,160 @@
+package gas
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+// Gas usage statistics of one external function, across every call to it
+// during a test run.
+type FunctionStats struct {
+	Contract  string `json:"contract"`
+	Signature string `json:"signature"`
+	Calls     int    `json:"calls"`
+	Min       int    `json:"min"`
+	Max       int    `json:"max"`
+	Average   int    `json:"average"`
+	Median    int    `json:"median"`
+}
+
+// The total gas spent on one line of source code during a test run.
+type LineStats struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Gas  int    `json:"gas"`
+}
+
+type Report struct {
+	Functions []FunctionStats `json:"functions"`
+	Lines     []LineStats     `json:"lines"`
+}
+
+type function struct {
+	contract  string
+	signature string
+}
+
+// Collects the gas used by each call and each source location, to be
+// summarized in a Report.
+type Collector struct {
+	samples   map[function][]int
+	locations map[srclocation.SourceLocation]int
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		samples:   make(map[function][]int),
+		locations: make(map[srclocation.SourceLocation]int),
+	}
+}
+
+func (collector *Collector) Add(contract string, signature string, gasUsed int) {
+	key := function{contract, signature}
+	collector.samples[key] = append(collector.samples[key], gasUsed)
+}
+
+// Gas spent by an op is attributed to the first line of the op's location.
+func (collector *Collector) AddLocation(location srclocation.SourceLocation, gasUsed int) {
+	location.JumpType = rune(0)
+	collector.locations[location] += gasUsed
+}
+
+func (collector *Collector) Report() (Report, error) {
+	var report Report
+	for key, samples := range collector.samples {
+		sorted := append([]int(nil), samples...)
+		sort.Ints(sorted)
+
+		total := 0
+		for _, sample := range sorted {
+			total += sample
+		}
+
+		median := sorted[len(sorted)/2]
+		if len(sorted)%2 == 0 {
+			median = (sorted[len(sorted)/2-1] + median) / 2
+		}
+
+		report.Functions = append(report.Functions, FunctionStats{
+			Contract:  key.contract,
+			Signature: key.signature,
+			Calls:     len(sorted),
+			Min:       sorted[0],
+			Max:       sorted[len(sorted)-1],
+			Average:   total / len(sorted),
+			Median:    median,
+		})
+	}
+
+	sort.Slice(report.Functions, func(i, j int) bool {
+		if report.Functions[i].Contract == report.Functions[j].Contract {
+			return report.Functions[i].Signature < report.Functions[j].Signature
+		}
+		return report.Functions[i].Contract < report.Functions[j].Contract
+	})
+
+	lineGas := make(map[LineStats]int)
+	lines := srclocation.NewLineFinder()
+	for location, gasUsed := range collector.locations {
+		lineNumber, err := lines.Line(location)
+		if err != nil {
+			return report, err
+		}
+		lineGas[LineStats{File: location.SourceFileName, Line: lineNumber}] += gasUsed
+	}
+	for line, gasUsed := range lineGas {
+		line.Gas = gasUsed
+		report.Lines = append(report.Lines, line)
+	}
+
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].File == report.Lines[j].File {
+			return report.Lines[i].Line < report.Lines[j].Line
+		}
+		return report.Lines[i].File < report.Lines[j].File
+	})
+	return report, nil
+}
+
+func (report Report) PrintTable(out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Contract\tFunction\tCalls\tMin\tMax\tAverage\tMedian\t")
+	for _, stats := range report.Functions {
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%d\t%d\t%d\t%d\t%d\t\n",
+			stats.Contract,
+			stats.Signature,
+			stats.Calls,
+			stats.Min,
+			stats.Max,
+			stats.Average,
+			stats.Median,
+		)
+	}
+	return writer.Flush()
+}
+
+func (report Report) WriteJSON(filename string) error {
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, reportJSON, 0644)
+}
+
+func ReadJSON(filename string) (Report, error) {
+	var report Report
+	reportJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(reportJSON, &report)
+	return report, err
+}
@@ -0,0 +1,259 @@
+package geth
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// The result of geth's debug_traceTransaction, and of each transaction in
+// debug_traceBlockByNumber, with the default struct logger.
+type Result struct {
+	Gas         uint64
+	Failed      bool
+	ReturnValue string
+	StructLogs  []StructLog
+}
+
+// The machine state before an op. Stack items and memory words are hex;
+// newer versions of geth prefix stack items with "0x", and older ones pad
+// them to a word. The top of the stack is last.
+type StructLog struct {
+	PC      int
+	Op      string
+	Gas     int
+	GasCost int
+	Depth   int
+	Stack   []string
+	Memory  []string
+}
+
+// Newer versions of geth use different names for a few ops.
+var renamedOps = map[string]string{
+	"KECCAK256":  "SHA3",
+	"PREVRANDAO": "DIFFICULTY",
+	"SUICIDE":    "SELFDESTRUCT",
+}
+
+var opCodes = make(map[string]string)
+
+func init() {
+	for value := 0; value < 256; value++ {
+		opCode := hex.EncodeToString([]byte{byte(value)})
+		if name := evmbytecode.OpCodeName(opCode); name != "UNKNOWN" {
+			opCodes[name] = opCode
+		}
+	}
+	for newName, oldName := range renamedOps {
+		opCodes[newName] = opCodes[oldName]
+	}
+}
+
+// Gives the code of the account at an address, hex encoded.
+type CodeFunc func(address string) (string, error)
+
+// Converts the struct logs of a transaction to a Parity vmTrace, so that the
+// rest of solstice can use it. code is the code the transaction ran; the code
+// of the accounts it called is looked up with codeAt.
+func (result Result) ExecTrace(code string, codeAt CodeFunc) (parity.ExecTrace, error) {
+	converter := converter{logs: result.StructLogs, codeAt: codeAt}
+	return converter.execTrace(result, code)
+}
+
+// Converts the struct logs of a transaction to a Parity vmTrace without a
+// node to look up code with. The code of each call is found among the
+// candidates instead, as the only one with the logged ops at the logged
+// program counters. Calls that match none of them, or more than one, are
+// left without code.
+func (result Result) MatchingExecTrace(candidates []string) (parity.ExecTrace, error) {
+	converter := converter{logs: result.StructLogs, candidates: candidates}
+	return converter.execTrace(result, "")
+}
+
+func (converter *converter) execTrace(result Result, code string) (parity.ExecTrace, error) {
+	vmTrace, err := converter.frame(code)
+	if err != nil {
+		return parity.ExecTrace{}, err
+	}
+	return parity.ExecTrace{
+		Output:  "0x" + strings.TrimPrefix(result.ReturnValue, "0x"),
+		VMTrace: *vmTrace,
+	}, nil
+}
+
+type converter struct {
+	logs       []StructLog
+	next       int
+	codeAt     CodeFunc
+	candidates []string
+}
+
+// Converts the logs from the next one up to the end of its call.
+func (converter *converter) frame(code string) (*parity.VMTrace, error) {
+	vmTrace := &parity.VMTrace{Code: code, Ops: []parity.Operation{}}
+	if converter.next >= len(converter.logs) {
+		return vmTrace, nil
+	}
+	depth := converter.logs[converter.next].Depth
+
+	var frameLogs []StructLog
+	for converter.next < len(converter.logs) && converter.logs[converter.next].Depth == depth {
+		log := converter.logs[converter.next]
+		frameLogs = append(frameLogs, log)
+		converter.next++
+		op := parity.Operation{PC: log.PC, Cost: log.GasCost}
+
+		if converter.next < len(converter.logs) && converter.logs[converter.next].Depth > depth {
+			calleeCode, err := converter.calleeCode(log)
+			if err != nil {
+				return nil, err
+			}
+			op.Sub, err = converter.frame(calleeCode)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		op.Ex.Used = log.Gas - log.GasCost
+		if converter.next < len(converter.logs) && converter.logs[converter.next].Depth == depth {
+			after := converter.logs[converter.next]
+			op.Ex.Used = after.Gas
+			op.Ex.Push = pushed(log, after)
+			op.Ex.Mem = memoryWrite(log.Memory, after.Memory)
+		}
+		if log.Op == "SSTORE" && len(log.Stack) >= 2 {
+			op.Ex.Store = &parity.StorageWrite{
+				Key: quantity(log.Stack[len(log.Stack)-1]),
+				Val: quantity(log.Stack[len(log.Stack)-2]),
+			}
+		}
+		vmTrace.Ops = append(vmTrace.Ops, op)
+	}
+
+	if code == "" {
+		vmTrace.Code = matchCode(converter.candidates, frameLogs)
+	}
+	return vmTrace, nil
+}
+
+// The only candidate with the ops of the logs at their program counters, or
+// "" if there isn't exactly one.
+func matchCode(candidates []string, logs []StructLog) string {
+	match := ""
+	for _, candidate := range candidates {
+		matches := true
+		for _, log := range logs {
+			opCode, known := opCodes[log.Op]
+			if known && evmbytecode.OpCodeAt(candidate, log.PC) != opCode {
+				matches = false
+				break
+			}
+		}
+		if matches && match != "" {
+			return ""
+		}
+		if matches {
+			match = candidate
+		}
+	}
+	return match
+}
+
+// The code run by the call or contract creation an op made.
+func (converter *converter) calleeCode(log StructLog) (string, error) {
+	stackItem := func(depth int) *big.Int {
+		if depth >= len(log.Stack) {
+			return new(big.Int)
+		}
+		value, _ := new(big.Int).SetString(strings.TrimPrefix(log.Stack[len(log.Stack)-1-depth], "0x"), 16)
+		if value == nil {
+			return new(big.Int)
+		}
+		return value
+	}
+
+	switch log.Op {
+	case "CALL", "CALLCODE", "DELEGATECALL", "STATICCALL":
+		if converter.codeAt == nil {
+			// The code will be matched once the call's logs are read.
+			return "", nil
+		}
+		address := stackItem(1).Bytes()
+		if len(address) > 20 {
+			address = address[len(address)-20:]
+		}
+		padded := make([]byte, 20)
+		copy(padded[20-len(address):], address)
+		return converter.codeAt("0x" + hex.EncodeToString(padded))
+	case "CREATE", "CREATE2":
+		memory, _ := hex.DecodeString(strings.Join(log.Memory, ""))
+		offset, size := stackItem(1), stackItem(2)
+		end := new(big.Int).Add(offset, size)
+		if !end.IsInt64() || end.Int64() > int64(len(memory)) {
+			return "0x", nil
+		}
+		return "0x" + hex.EncodeToString(memory[offset.Int64():end.Int64()]), nil
+	}
+	return "0x", nil
+}
+
+// The items an op left on top of the stack. Like Parity, DUP and SWAP count
+// the items they took too.
+func pushed(before StructLog, after StructLog) []string {
+	pops := 0
+	if opCode, ok := opCodes[before.Op]; ok {
+		pops = evmbytecode.StackPops(opCode)
+	}
+	count := len(after.Stack) - len(before.Stack) + pops
+	if count <= 0 || count > len(after.Stack) {
+		return nil
+	}
+	var items []string
+	for _, item := range after.Stack[len(after.Stack)-count:] {
+		items = append(items, quantity(item))
+	}
+	return items
+}
+
+// The part of memory that changed between two logs, which stands in for what
+// the op wrote. Memory that grew is included even if it's still zero.
+func memoryWrite(before []string, after []string) *parity.MemoryWrite {
+	beforeBytes, _ := hex.DecodeString(strings.Join(before, ""))
+	afterBytes, _ := hex.DecodeString(strings.Join(after, ""))
+
+	common := len(beforeBytes)
+	if len(afterBytes) < common {
+		common = len(afterBytes)
+	}
+	start, end := -1, -1
+	for i := 0; i < common; i++ {
+		if beforeBytes[i] != afterBytes[i] {
+			if start < 0 {
+				start = i
+			}
+			end = i + 1
+		}
+	}
+	if len(afterBytes) > len(beforeBytes) {
+		if start < 0 {
+			start = len(beforeBytes)
+		}
+		end = len(afterBytes)
+	}
+	if start < 0 {
+		return nil
+	}
+	return &parity.MemoryWrite{Off: start, Data: "0x" + hex.EncodeToString(afterBytes[start:end])}
+}
+
+// Formats a stack item the way Parity does, as hex without leading zeros.
+func quantity(item string) string {
+	digits := strings.TrimLeft(strings.TrimPrefix(item, "0x"), "0")
+	if digits == "" {
+		digits = "0"
+	}
+	return "0x" + digits
+}
@@ -0,0 +1,100 @@
+package gitdiff
+
+import (
+	"bufio"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A changed range of lines. OldStart and NewStart are where the range starts
+// in the old and new versions of the file. A range of zero lines is an
+// insertion or deletion after its start line.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// The changes to one file. OldName is empty for new files, and NewName for
+// deleted ones.
+type FileDiff struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Diffs the working tree against a revision, with no context lines, for the
+// files matching the pathspecs. File names are absolute.
+func Changes(rev string, pathspecs ...string) ([]FileDiff, error) {
+	rootOutput, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"diff", "--unified=0", "--no-color", "--no-ext-diff", rev, "--"}, pathspecs...)
+	diffOutput, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(diffOutput), strings.TrimSpace(string(rootOutput))), nil
+}
+
+// Parses a unified diff, as given by git, joining the file names onto root.
+func Parse(diff string, root string) []FileDiff {
+	var files []FileDiff
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, FileDiff{})
+		case len(files) == 0:
+			continue
+		case strings.HasPrefix(line, "--- "):
+			files[len(files)-1].OldName = fileName(strings.TrimPrefix(line, "--- "), "a/", root)
+		case strings.HasPrefix(line, "+++ "):
+			files[len(files)-1].NewName = fileName(strings.TrimPrefix(line, "+++ "), "b/", root)
+		case strings.HasPrefix(line, "@@ "):
+			match := hunkHeader.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			files[len(files)-1].Hunks = append(files[len(files)-1].Hunks, Hunk{
+				OldStart: atoi(match[1], 0),
+				OldLines: atoi(match[2], 1),
+				NewStart: atoi(match[3], 0),
+				NewLines: atoi(match[4], 1),
+			})
+		}
+	}
+	return files
+}
+
+func fileName(name string, prefix string, root string) string {
+	if name == "/dev/null" {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	return filepath.Join(root, strings.TrimPrefix(name, prefix))
+}
+
+// Counts in hunk headers are left out when they're 1.
+func atoi(number string, missing int) int {
+	if number == "" {
+		return missing
+	}
+	value, err := strconv.Atoi(number)
+	if err != nil {
+		return missing
+	}
+	return value
+}
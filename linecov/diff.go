@@ -0,0 +1,83 @@
+package linecov
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/gitdiff"
+)
+
+// A changed line that code was compiled from. Source is the line itself.
+type ChangedLine struct {
+	File    string
+	Line    int
+	Source  string
+	Covered bool
+}
+
+// The coverage of just the changed lines that can run.
+type DiffCoverage struct {
+	Lines []ChangedLine
+}
+
+// Finds the coverage of the lines added or changed in the diff, going by the
+// new version of each file, which is the one the coverage was recorded for.
+// Changed lines that no code was compiled from, like comments, are left out.
+func (coverage Coverage) Diff(files []gitdiff.FileDiff) (DiffCoverage, error) {
+	byAbsoluteName := make(map[string]map[int]int)
+	for file, lines := range coverage {
+		absolute, err := filepath.Abs(file)
+		if err != nil {
+			return DiffCoverage{}, err
+		}
+		byAbsoluteName[absolute] = lines
+	}
+
+	var diff DiffCoverage
+	for _, file := range files {
+		lines, ok := byAbsoluteName[file.NewName]
+		if !ok || file.NewName == "" {
+			continue
+		}
+		source, err := ioutil.ReadFile(file.NewName)
+		if err != nil {
+			return diff, err
+		}
+		sourceLines := strings.Split(string(source), "\n")
+
+		for _, hunk := range file.Hunks {
+			for line := hunk.NewStart; line < hunk.NewStart+hunk.NewLines; line++ {
+				hits, ok := lines[line]
+				if !ok {
+					continue
+				}
+				changed := ChangedLine{File: file.NewName, Line: line, Covered: hits != 0}
+				if line <= len(sourceLines) {
+					changed.Source = strings.TrimSpace(sourceLines[line-1])
+				}
+				diff.Lines = append(diff.Lines, changed)
+			}
+		}
+	}
+	return diff, nil
+}
+
+func (diff DiffCoverage) Uncovered() []ChangedLine {
+	var uncovered []ChangedLine
+	for _, line := range diff.Lines {
+		if !line.Covered {
+			uncovered = append(uncovered, line)
+		}
+	}
+	return uncovered
+}
+
+// The percentage of changed lines that were covered. With no changed lines
+// that can run, there's nothing left untested, so that's 100.
+func (diff DiffCoverage) Percent() float64 {
+	if len(diff.Lines) == 0 {
+		return 100
+	}
+	return 100 * float64(len(diff.Lines)-len(diff.Uncovered())) / float64(len(diff.Lines))
+}
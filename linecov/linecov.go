@@ -0,0 +1,75 @@
+package linecov
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+// The number of times each line of each source file was run, by file name and
+// then by line number. Only lines that code was compiled from are included, so
+// a line with no hits is one that could have run but didn't.
+type Coverage map[string]map[int]int
+
+// Builds up Coverage from the locations in the source maps and the traces.
+type Collector struct {
+	*srclocation.LineFinder
+	coverage Coverage
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		LineFinder: srclocation.NewLineFinder(),
+		coverage:   make(Coverage),
+	}
+}
+
+// Marks the line of a location from a source map as one that can run.
+func (collector *Collector) AddExecutable(location srclocation.SourceLocation) error {
+	line, err := collector.Line(location)
+	if err != nil {
+		return err
+	}
+	if collector.coverage[location.SourceFileName] == nil {
+		collector.coverage[location.SourceFileName] = make(map[int]int)
+	}
+	if _, ok := collector.coverage[location.SourceFileName][line]; !ok {
+		collector.coverage[location.SourceFileName][line] = 0
+	}
+	return nil
+}
+
+func (collector *Collector) AddHit(location srclocation.SourceLocation) error {
+	if err := collector.AddExecutable(location); err != nil {
+		return err
+	}
+	line, err := collector.Line(location)
+	if err != nil {
+		return err
+	}
+	collector.coverage[location.SourceFileName][line]++
+	return nil
+}
+
+func (collector *Collector) Coverage() Coverage {
+	return collector.coverage
+}
+
+func (coverage Coverage) WriteJSON(filename string) error {
+	coverageJSON, err := json.MarshalIndent(coverage, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, coverageJSON, 0644)
+}
+
+func ReadJSON(filename string) (Coverage, error) {
+	var coverage Coverage
+	coverageJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return coverage, err
+	}
+	err = json.Unmarshal(coverageJSON, &coverage)
+	return coverage, err
+}
@@ -0,0 +1,165 @@
+package mutation
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/ast"
+)
+
+// A single change to a source file, which the tests should notice. Offset
+// and Length give the bytes of the file that Replacement replaces, and Line
+// is the line they start on.
+type Mutant struct {
+	File        string
+	Line        int
+	Offset      int
+	Length      int
+	Original    string
+	Replacement string
+	Description string
+}
+
+// The operators each operator is swapped for.
+var operatorMutations = map[string]string{
+	"<":  ">=",
+	">=": "<",
+	">":  "<=",
+	"<=": ">",
+	"==": "!=",
+	"!=": "==",
+	"+":  "-",
+	"-":  "+",
+}
+
+// Makes mutants of the given source files, by:
+//   - flipping comparison operators, e.g. "<" to ">="
+//   - swapping "+" and "-"
+//   - replacing calls to require with true
+//   - changing number literals, to 1 if they're 0 and to 0 otherwise
+//   - removing modifiers from functions
+//
+// Mutants are in order of file name and then offset.
+func Generate(trees map[string]ast.AST) ([]Mutant, error) {
+	var fileNames []string
+	for fileName := range trees {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var mutants []Mutant
+	for _, fileName := range fileNames {
+		source, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return mutants, err
+		}
+		tree := trees[fileName]
+		generator := generator{fileName: fileName, source: source}
+		generator.visit(&tree)
+		mutants = append(mutants, generator.mutants...)
+	}
+
+	sort.SliceStable(mutants, func(i, j int) bool {
+		if mutants[i].File != mutants[j].File {
+			return mutants[i].File < mutants[j].File
+		}
+		return mutants[i].Offset < mutants[j].Offset
+	})
+	return mutants, nil
+}
+
+type generator struct {
+	fileName string
+	source   []byte
+	mutants  []Mutant
+}
+
+func (generator *generator) add(offset int, length int, replacement string, description string) {
+	if offset < 0 || length < 0 || offset+length > len(generator.source) {
+		return
+	}
+	generator.mutants = append(generator.mutants, Mutant{
+		File:        generator.fileName,
+		Line:        bytes.Count(generator.source[:offset], []byte{'\n'}) + 1,
+		Offset:      offset,
+		Length:      length,
+		Original:    string(generator.source[offset : offset+length]),
+		Replacement: replacement,
+		Description: description,
+	})
+}
+
+func (generator *generator) visit(node *ast.AST) {
+	switch node.NodeType {
+	case "BinaryOperation":
+		generator.mutateOperator(node)
+	case "Literal":
+		if node.Attributes.Token == "number" {
+			replacement := "0"
+			if node.Attributes.Value == "0" {
+				replacement = "1"
+			}
+			generator.add(
+				node.SrcLoc.ByteOffset,
+				node.SrcLoc.ByteLength,
+				replacement,
+				fmt.Sprintf("changed %s to %s", node.Attributes.Value, replacement),
+			)
+		}
+	case "FunctionCall":
+		if len(node.Children) != 0 &&
+			node.Children[0].NodeType == "Identifier" &&
+			node.Children[0].Attributes.Value == "require" {
+			generator.add(node.SrcLoc.ByteOffset, node.SrcLoc.ByteLength, "true", "removed require")
+		}
+	case "ModifierInvocation":
+		// Constructors of base contracts are given the same way as modifiers,
+		// but removing them usually doesn't compile, so it'll be caught then.
+		generator.add(
+			node.SrcLoc.ByteOffset,
+			node.SrcLoc.ByteLength,
+			"",
+			"removed modifier "+strings.SplitN(string(generator.source[node.SrcLoc.ByteOffset:node.SrcLoc.ByteOffset+node.SrcLoc.ByteLength]), "(", 2)[0],
+		)
+		return
+	}
+
+	for _, child := range node.Children {
+		generator.visit(child)
+	}
+}
+
+// The operator is found in the source between the two operands.
+func (generator *generator) mutateOperator(node *ast.AST) {
+	replacement, ok := operatorMutations[node.Attributes.Operator]
+	if !ok || len(node.Children) != 2 {
+		return
+	}
+	left := node.Children[0].SrcLoc
+	right := node.Children[1].SrcLoc
+	start := left.ByteOffset + left.ByteLength
+	if start < 0 || right.ByteOffset > len(generator.source) || start > right.ByteOffset {
+		return
+	}
+
+	index := strings.Index(string(generator.source[start:right.ByteOffset]), node.Attributes.Operator)
+	if index < 0 {
+		return
+	}
+	generator.add(
+		start+index,
+		len(node.Attributes.Operator),
+		replacement,
+		fmt.Sprintf("replaced %s with %s", node.Attributes.Operator, replacement),
+	)
+}
+
+// The source with the mutation made.
+func (mutant Mutant) Apply(source []byte) []byte {
+	mutated := append([]byte(nil), source[:mutant.Offset]...)
+	mutated = append(mutated, mutant.Replacement...)
+	return append(mutated, source[mutant.Offset+mutant.Length:]...)
+}
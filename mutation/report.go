@@ -0,0 +1,120 @@
+package mutation
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"text/tabwriter"
+)
+
+type Status string
+
+const (
+	// The tests failed with the mutant, as they should.
+	Killed Status = "killed"
+	// The tests passed with the mutant, so they don't check what it changed.
+	Survived Status = "survived"
+	// The tests never ran the mutated line, so the mutant wasn't tried.
+	NotCovered Status = "not covered"
+	// The mutant didn't compile.
+	Stillborn Status = "stillborn"
+)
+
+type Result struct {
+	Mutant Mutant
+	Status Status
+}
+
+// Counts the results of each status.
+func Summarize(results []Result) map[Status]int {
+	counts := make(map[Status]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// The percentage of mutants that were killed, out of those that compiled.
+// Mutants in code the tests never ran count as surviving.
+func Score(results []Result) float64 {
+	counts := Summarize(results)
+	compiled := counts[Killed] + counts[Survived] + counts[NotCovered]
+	if compiled == 0 {
+		return 100
+	}
+	return 100 * float64(counts[Killed]) / float64(compiled)
+}
+
+func PrintSummary(out io.Writer, results []Result) error {
+	counts := Summarize(results)
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, status := range []Status{Killed, Survived, NotCovered, Stillborn} {
+		fmt.Fprintf(writer, "%s\t%d\t\n", status, counts[status])
+	}
+	fmt.Fprintf(writer, "mutation score\t%.1f%%\t\n", Score(results))
+	return writer.Flush()
+}
+
+// A page listing every mutant, with the surviving ones first, since those are
+// the ones that need better tests.
+func HTMLReport(results []Result) ([]byte, error) {
+	var ordered []Result
+	for _, status := range []Status{Survived, NotCovered, Killed, Stillborn} {
+		for _, result := range results {
+			if result.Status == status {
+				ordered = append(ordered, result)
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for status, count := range Summarize(results) {
+		counts[string(status)] = count
+	}
+
+	var page bytes.Buffer
+	err := reportTemplate.Execute(&page, struct {
+		Results []Result
+		Counts  map[string]int
+		Score   string
+	}{ordered, counts, fmt.Sprintf("%.1f%%", Score(results))})
+	return page.Bytes(), err
+}
+
+var reportTemplate = template.Must(template.New("mutants").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Mutation testing report</title>
+<style>
+  body { font-family: sans-serif; margin: 16px; }
+  table { border-collapse: collapse; }
+  td, th { border: 1px solid #e1e4e8; padding: 4px 8px; text-align: left; vertical-align: top; }
+  code { white-space: pre-wrap; }
+  .survived { background-color: #ffeef0; }
+  .killed { background-color: #e6ffed; }
+  .not.covered { background-color: #fff5b1; }
+  .stillborn { color: #6a737d; }
+</style>
+</head>
+<body>
+<h1>Mutation testing report</h1>
+<p>Mutation score: <b>{{.Score}}</b>.
+Killed: {{index .Counts "killed"}},
+survived: {{index .Counts "survived"}},
+not covered: {{index .Counts "not covered"}},
+stillborn: {{index .Counts "stillborn"}}.</p>
+<table>
+<tr><th>Status</th><th>Location</th><th>Mutation</th><th>Original</th><th>Mutant</th></tr>
+{{range .Results}}<tr class="{{.Status}}">
+<td>{{.Status}}</td>
+<td>{{.Mutant.File}}:{{.Mutant.Line}}</td>
+<td>{{.Mutant.Description}}</td>
+<td><code>{{.Mutant.Original}}</code></td>
+<td><code>{{.Mutant.Replacement}}</code></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -1,51 +1,218 @@
 package parity
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 
-	"github.com/spf13/viper"
+	"github.com/reserve-protocol/solstice/tracecache"
 )
 
 type jsonrpcResponse struct {
 	JSONRPC string
-	Result  execTrace
+	Result  json.RawMessage
 	ID      int
 }
 
-type execTrace struct {
-	Trace     []interface{}
-	StateDiff interface{}
-	Output    string
-	VMTrace   VMTrace
+// The VMTrace is embedded so that its ops and code can be used directly.
+// Trace and StateDiff are only filled in if they were asked for.
+type ExecTrace struct {
+	Trace     []CallTrace            `json:"trace,omitempty"`
+	StateDiff map[string]AccountDiff `json:"stateDiff,omitempty"`
+	Output    string                 `json:"output"`
+	VMTrace   `json:"vmTrace"`
 }
 
+// One of the calls a transaction made, in the order they were made. The
+// first is the transaction itself. Result is nil if the call failed, in which
+// case Error says why.
+type CallTrace struct {
+	Type         string
+	Action       CallAction
+	Result       *CallResult
+	Error        string
+	Subtraces    int
+	TraceAddress []int
+}
+
+// CallType is "call", "delegatecall", "staticcall" or "callcode" for calls.
+// Creations have Init instead of Input and To.
+type CallAction struct {
+	CallType string
+	From     string
+	To       string
+	Input    string
+	Init     string
+	Value    string
+	Gas      string
+}
+
+type CallResult struct {
+	GasUsed string
+	Output  string
+	Address string
+}
+
+// The changes a transaction made to an account, keyed by storage slot.
+type AccountDiff struct {
+	Storage map[string]Diff
+}
+
+// A changed value. From is empty if the value was created, and To is empty
+// if it was deleted. Unchanged values have Changed set to false.
+type Diff struct {
+	From    string
+	To      string
+	Changed bool
+}
+
+// Parity encodes diffs as "=" if unchanged, {"+": to} if created, {"-": from}
+// if deleted, and {"*": {"from": from, "to": to}} if changed.
+func (diff *Diff) UnmarshalJSON(data []byte) error {
+	var unchanged string
+	if err := json.Unmarshal(data, &unchanged); err == nil {
+		*diff = Diff{}
+		return nil
+	}
+
+	var changes struct {
+		Created string `json:"+"`
+		Deleted string `json:"-"`
+		Changed *struct {
+			From string
+			To   string
+		} `json:"*"`
+	}
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return err
+	}
+
+	*diff = Diff{From: changes.Deleted, To: changes.Created, Changed: true}
+	if changes.Changed != nil {
+		diff.From = changes.Changed.From
+		diff.To = changes.Changed.To
+	}
+	return nil
+}
+
+// The JSON field names and order match Parity's, so that traces from other
+// nodes can be converted to this form and read back the same way.
 type VMTrace struct {
-	Ops  []traceOperation
-	Code string
+	Code string      `json:"code"`
+	Ops  []Operation `json:"ops"`
+}
+
+// Sub is the trace of the call or contract creation made by the op, if any.
+type Operation struct {
+	Cost int         `json:"cost"`
+	Ex   OperationEx `json:"ex"`
+	PC   int         `json:"pc"`
+	Sub  *VMTrace    `json:"sub"`
+}
+
+type OperationEx struct {
+	Mem   *MemoryWrite  `json:"mem"`
+	Push  []string      `json:"push"`
+	Store *StorageWrite `json:"store"`
+	Used  int           `json:"used"`
+}
+
+// The bytes an op wrote to memory, hex encoded, starting at Off.
+type MemoryWrite struct {
+	Data string `json:"data"`
+	Off  int    `json:"off"`
 }
 
-type traceOperation struct {
-	Cost int
-	PC   int
-	Sub  interface{}
-	Ex   execTraceOpEx
+// The value an SSTORE op wrote to a storage slot.
+type StorageWrite struct {
+	Key string `json:"key"`
+	Val string `json:"val"`
 }
 
-type execTraceOpEx struct {
-	Push  []string
-	Mem   interface{}
-	Used  int
-	Store interface{}
+// The gas spent executing the trace's bytecode. This doesn't include the
+// intrinsic cost of the transaction or any refunds.
+func (trace VMTrace) GasUsed() int {
+	total := 0
+	for _, cost := range trace.GasCosts() {
+		total += cost
+	}
+	return total
+}
+
+// The gas consumed by each op in the trace. An op's Cost isn't used directly,
+// since for calls it covers all of the gas passed along, including what's
+// later returned.
+func (trace VMTrace) GasCosts() []int {
+	costs := make([]int, len(trace.Ops))
+	if len(trace.Ops) == 0 {
+		return costs
+	}
+
+	gasBefore := trace.Ops[0].Ex.Used + trace.Ops[0].Cost
+	for i, op := range trace.Ops {
+		costs[i] = gasBefore - op.Ex.Used
+		gasBefore = op.Ex.Used
+	}
+	return costs
+}
+
+// The vmTrace is always fetched. Other kinds of traces, like "stateDiff", can
+// be asked for too. Traces are fetched from traces.URL and saved to the trace
+// cache as they're fetched, or read from the cache instead when offline.
+func GetExecTrace(ctx context.Context, traces tracecache.Config, txnHash string, extraTraceTypes ...string) (ExecTrace, error) {
+	traceTypes := append([]string{"vmTrace"}, extraTraceTypes...)
+	cache, cacheErr := traces.Open(ctx)
+
+	var result json.RawMessage
+	var err error
+	if traces.Offline {
+		if cacheErr != nil {
+			return ExecTrace{}, cacheErr
+		}
+		result, err = cache.Get(txnHash, traceTypes)
+		if err == tracecache.ErrNotCached {
+			return ExecTrace{}, fmt.Errorf("The %s of %s isn't in the trace cache %s.", strings.Join(traceTypes, " and "), txnHash, cache.Dir())
+		}
+	} else {
+		result, err = replayTransaction(ctx, traces.URL, txnHash, traceTypes)
+		if err == nil && len(result) != 0 && string(result) != "null" {
+			// The trace was fetched all the same, so failing to cache it is
+			// only worth a warning.
+			if cacheErr == nil {
+				cacheErr = cache.Put(txnHash, result)
+			}
+			if cacheErr != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't cache the trace of %s: %v\n", txnHash, cacheErr)
+			}
+		}
+	}
+	if err != nil {
+		return ExecTrace{}, err
+	}
+
+	var execTrace ExecTrace
+	if len(result) != 0 {
+		if err := json.Unmarshal(result, &execTrace); err != nil {
+			return ExecTrace{}, err
+		}
+	}
+	return execTrace, execTrace.Validate()
 }
 
-func GetExecTrace(txnHash string) (VMTrace, error) {
-	resp, err := http.Post(
-		viper.GetString("blockchain_client"),
-		"application/json",
+func replayTransaction(ctx context.Context, url string, txnHash string, traceTypes []string) (json.RawMessage, error) {
+	traceTypesJSON, err := json.Marshal(traceTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		url,
 		strings.NewReader(
 			fmt.Sprintf(
 				`{
@@ -53,36 +220,49 @@ func GetExecTrace(txnHash string) (VMTrace, error) {
 					"method": "trace_replayTransaction",
 					"params": [
 						%q,
-						["vmTrace"]
+						%s
 					],
 					"id": 1
 				}`,
 				txnHash,
+				traceTypesJSON,
 			),
 		),
 	)
 	if err != nil {
-		return VMTrace{}, err
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var execTraceResponse jsonrpcResponse
 	err = json.NewDecoder(resp.Body).Decode(&execTraceResponse)
-	if err != nil {
-		return VMTrace{}, err
-	}
+	return execTraceResponse.Result, err
+}
+
+var (
+	ErrTxNotFound   = errors.New("Transaction ID not found.")
+	ErrNoBytecode   = errors.New("Transaction has no associated bytecode.")
+	ErrNoTraceSteps = errors.New("Transaction has no execution trace steps.")
+)
 
-	if execTraceResponse.Result.Output == "" {
-		return execTraceResponse.Result.VMTrace, errors.New("Transaction ID not found.")
+// Checks that a trace is of a transaction that ran contract code.
+func (execTrace ExecTrace) Validate() error {
+	if execTrace.Output == "" {
+		return ErrTxNotFound
 	}
 
-	if execTraceResponse.Result.VMTrace.Code == "0x" {
-		return execTraceResponse.Result.VMTrace, errors.New("Transaction has no associated bytecode.")
+	if execTrace.VMTrace.Code == "0x" {
+		return ErrNoBytecode
 	}
 
-	if len(execTraceResponse.Result.VMTrace.Ops) == 0 {
-		return execTraceResponse.Result.VMTrace, errors.New("Transaction has no execution trace steps.")
+	if len(execTrace.VMTrace.Ops) == 0 {
+		return ErrNoTraceSteps
 	}
 
-	return execTraceResponse.Result.VMTrace, nil
+	return nil
 }
@@ -0,0 +1,202 @@
+package parity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parts of each op that StreamVMTrace doesn't decode. Coverage only needs
+// the program counters and gas, and skipping the rest saves most of the time
+// and memory that decoding a trace takes.
+type Skip struct {
+	Stack     bool
+	Memory    bool
+	Storage   bool
+	Subtraces bool
+}
+
+// What coverage needs.
+var SkipAll = Skip{Stack: true, Memory: true, Storage: true, Subtraces: true}
+
+// Called with each op of a vmTrace as it's read, along with the depth of its
+// call and the code being run. Sub is never set; the ops of a call are visited
+// before the op that made it, one level deeper.
+type OpVisitor func(depth int, code string, op Operation) error
+
+// Reads the vmTrace that is the next value in the decoder, visiting its ops
+// one at a time instead of holding them all in memory. It returns the code of
+// the trace. Parity puts the code before the ops; traces that don't are an
+// error.
+func StreamVMTrace(decoder *json.Decoder, skip Skip, visit OpVisitor) (string, error) {
+	return streamVMTrace(decoder, skip, visit, 0)
+}
+
+func streamVMTrace(decoder *json.Decoder, skip Skip, visit OpVisitor, depth int) (string, error) {
+	if isNull, err := startObject(decoder); err != nil || isNull {
+		return "", err
+	}
+
+	var code string
+	for decoder.More() {
+		key, err := nextKey(decoder)
+		if err != nil {
+			return code, err
+		}
+		switch key {
+		case "code":
+			if err := decoder.Decode(&code); err != nil {
+				return code, err
+			}
+		case "ops":
+			if code == "" {
+				return code, errors.New("The trace's ops come before its code.")
+			}
+			if err := streamOps(decoder, skip, visit, depth, code); err != nil {
+				return code, err
+			}
+		default:
+			if err := SkipValue(decoder); err != nil {
+				return code, err
+			}
+		}
+	}
+	_, err := decoder.Token()
+	return code, err
+}
+
+func streamOps(decoder *json.Decoder, skip Skip, visit OpVisitor, depth int, code string) error {
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		op, err := streamOp(decoder, skip, visit, depth)
+		if err != nil {
+			return err
+		}
+		if err := visit(depth, code, op); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+func streamOp(decoder *json.Decoder, skip Skip, visit OpVisitor, depth int) (Operation, error) {
+	var op Operation
+	if err := expectDelim(decoder, '{'); err != nil {
+		return op, err
+	}
+	for decoder.More() {
+		key, err := nextKey(decoder)
+		if err != nil {
+			return op, err
+		}
+		switch {
+		case key == "cost":
+			err = decoder.Decode(&op.Cost)
+		case key == "pc":
+			err = decoder.Decode(&op.PC)
+		case key == "ex":
+			err = streamEx(decoder, skip, &op.Ex)
+		case key == "sub" && !skip.Subtraces:
+			_, err = streamVMTrace(decoder, skip, visit, depth+1)
+		default:
+			err = SkipValue(decoder)
+		}
+		if err != nil {
+			return op, err
+		}
+	}
+	_, err := decoder.Token()
+	return op, err
+}
+
+func streamEx(decoder *json.Decoder, skip Skip, ex *OperationEx) error {
+	if isNull, err := startObject(decoder); err != nil || isNull {
+		return err
+	}
+	for decoder.More() {
+		key, err := nextKey(decoder)
+		if err != nil {
+			return err
+		}
+		switch {
+		case key == "used":
+			err = decoder.Decode(&ex.Used)
+		case key == "push" && !skip.Stack:
+			err = decoder.Decode(&ex.Push)
+		case key == "mem" && !skip.Memory:
+			err = decoder.Decode(&ex.Mem)
+		case key == "store" && !skip.Storage:
+			err = decoder.Decode(&ex.Store)
+		default:
+			err = SkipValue(decoder)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// Reads past the next value in the decoder without keeping it.
+func SkipValue(decoder *json.Decoder) error {
+	nesting := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			nesting++
+		case json.Delim('}'), json.Delim(']'):
+			nesting--
+		}
+		if nesting == 0 {
+			return nil
+		}
+	}
+}
+
+// Reads the start of an object, or a null in its place.
+func startObject(decoder *json.Decoder) (bool, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return false, err
+	}
+	if token == nil {
+		return true, nil
+	}
+	if token != json.Delim('{') {
+		return false, fmt.Errorf("Expected an object in the trace, but found %v.", token)
+	}
+	return false, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("Expected %v in the trace, but found %v.", delim, token)
+	}
+	return nil
+}
+
+func nextKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("Expected a key in the trace, but found %v.", token)
+	}
+	// Like encoding/json, keys are matched without regard to case.
+	return strings.ToLower(key), nil
+}
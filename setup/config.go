@@ -0,0 +1,64 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The settings solstice init writes to config.yml. The paths are absolute,
+// since solc runs in contracts_dir.
+type Config struct {
+	ContractsDir      string   `yaml:"contracts_dir"`
+	CoverageReportDir string   `yaml:"coverage_report_dir"`
+	BlockchainClient  string   `yaml:"blockchain_client,omitempty"`
+	Backend           string   `yaml:"backend,omitempty"`
+	TestCommand       []string `yaml:"test_command,omitempty"`
+	SolcArgs          []string `yaml:"solc_args,omitempty"`
+}
+
+// The config for the project as detected: laid out as its framework is,
+// running the tests against the node that was found if it can trace
+// transactions, and against the embedded chain otherwise.
+func (detection Detection) Config() Config {
+	config := Config{
+		ContractsDir:      filepath.Join(detection.Dir, "contracts"),
+		CoverageReportDir: filepath.Join(detection.Dir, "coverage"),
+	}
+	if detection.Framework != nil {
+		config.ContractsDir = filepath.Join(detection.Dir, detection.Framework.ContractsDir)
+		config.TestCommand = detection.Framework.TestCommand
+	}
+	if len(detection.Remappings) != 0 {
+		config.SolcArgs = append(append([]string(nil), detection.Remappings...), "--allow-paths", detection.Dir)
+	}
+	if detection.NodeURL != "" && detection.NodeTraces {
+		config.BlockchainClient = detection.NodeURL
+	} else {
+		config.Backend = "embedded"
+	}
+	return config
+}
+
+// Writes the config as YAML to path. An existing file is only overwritten if
+// overwrite is set.
+func (config Config) Write(path string, overwrite bool) error {
+	configYAML, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(configYAML); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,156 @@
+// Package setup finds out how a project is laid out, so that solstice init
+// can write a config for it, and checks an existing config for solstice
+// doctor.
+package setup
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/chain"
+)
+
+// A development framework whose layout solstice knows. A project uses it if
+// it has any of the ConfigFiles. TestCommand runs the tests against
+// localhost:8545, if the framework can.
+type Framework struct {
+	Name         string
+	ConfigFiles  []string
+	ContractsDir string
+	TestCommand  []string
+	NodeURLs     []string
+}
+
+var Frameworks = []Framework{
+	{
+		Name:         "hardhat",
+		ConfigFiles:  []string{"hardhat.config.js", "hardhat.config.ts", "hardhat.config.cjs"},
+		ContractsDir: "contracts",
+		TestCommand:  []string{"npx", "hardhat", "test", "--network", "localhost"},
+		NodeURLs:     []string{"http://localhost:8545"},
+	},
+	{
+		// forge test runs the tests in an EVM of its own, not against a node.
+		Name:         "foundry",
+		ConfigFiles:  []string{"foundry.toml"},
+		ContractsDir: "src",
+		NodeURLs:     []string{"http://localhost:8545"},
+	},
+	{
+		Name:         "truffle",
+		ConfigFiles:  []string{"truffle-config.js", "truffle.js"},
+		ContractsDir: "contracts",
+		TestCommand:  []string{"npx", "truffle", "test"},
+		// Ganache's own port, and truffle develop's.
+		NodeURLs: []string{"http://localhost:8545", "http://localhost:7545", "http://localhost:9545"},
+	},
+}
+
+// What Detect found out about a project. Framework is nil if the project
+// isn't laid out like any of the Frameworks, SolcVersion is empty if solc
+// isn't on the PATH, and NodeURL is empty if no node answered.
+type Detection struct {
+	Dir         string
+	Framework   *Framework
+	Remappings  []string
+	SolcVersion string
+	NodeURL     string
+	NodeTraces  bool
+}
+
+// Looks at the project in dir for a framework's config file, import
+// remappings, solc on the PATH and a node running where the framework's
+// nodes usually run.
+func Detect(ctx context.Context, dir string) (Detection, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Detection{}, err
+	}
+	detection := Detection{Dir: dir}
+
+	for i, framework := range Frameworks {
+		for _, configFile := range framework.ConfigFiles {
+			if _, err := os.Stat(filepath.Join(dir, configFile)); err == nil {
+				detection.Framework = &Frameworks[i]
+				break
+			}
+		}
+		if detection.Framework != nil {
+			break
+		}
+	}
+
+	if detection.Remappings, err = readRemappings(dir); err != nil {
+		return detection, err
+	}
+	detection.SolcVersion = SolcVersion(ctx)
+
+	nodeURLs := []string{"http://localhost:8545"}
+	if detection.Framework != nil {
+		nodeURLs = detection.Framework.NodeURLs
+	}
+	for _, url := range nodeURLs {
+		if chain.Ready(url) {
+			detection.NodeURL = url
+			detection.NodeTraces, _ = chain.Supports(ctx, url, "trace_replayTransaction", zeroHash, []string{"vmTrace"})
+			break
+		}
+	}
+	return detection, nil
+}
+
+// A transaction hash to ask about when all that matters is whether a node
+// has the method.
+const zeroHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// The version solc on the PATH says it is, like "0.8.19+commit.7dd6d404", or
+// an empty string if it can't be run.
+func SolcVersion(ctx context.Context) string {
+	output, err := exec.CommandContext(ctx, "solc", "--version").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "Version: ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Version: "))
+		}
+	}
+	return ""
+}
+
+// The import remappings in remappings.txt, as Foundry keeps them, with their
+// targets made absolute, since solc runs in contracts_dir rather than the
+// project's root.
+func readRemappings(dir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(dir, "remappings.txt"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var remappings []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		target := parts[1]
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+			if strings.HasSuffix(parts[1], "/") {
+				target += "/"
+			}
+		}
+		remappings = append(remappings, parts[0]+"="+target)
+	}
+	return remappings, scanner.Err()
+}
@@ -0,0 +1,180 @@
+package setup
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/srcmap"
+)
+
+type Status string
+
+const (
+	Passed  Status = "ok"
+	Failed  Status = "FAIL"
+	Skipped Status = "skip"
+)
+
+// The outcome of one of Doctor's checks. Detail says what was found, and for
+// a failure, what to do about it.
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+}
+
+// How many of the latest blocks are searched for a transaction to sample.
+const sampleBlocks = 256
+
+// Checks that the contracts in contracts_dir compile, that the chain the
+// tests run against can be traced, and that the code a sample transaction
+// ran is one of the compiled contracts. The sample is txnHash if it's set,
+// and otherwise the latest transaction to a contract. Checks that need one
+// that failed are skipped.
+func Doctor(ctx context.Context, cfg coverage.Config, txnHash string) []Result {
+	var results []Result
+	add := func(check string, status Status, format string, args ...interface{}) {
+		results = append(results, Result{Check: check, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// The contracts
+	const contractsCheck = "contracts_dir has contracts"
+	dir := cfg.Compiler.ContractsDir
+	contracts, err := cfg.Compiler.Contracts()
+	switch {
+	case dir == "":
+		add(contractsCheck, Failed, "contracts_dir isn't set; set it to the directory of your .sol files.")
+	case os.IsNotExist(err):
+		add(contractsCheck, Failed, "%s doesn't exist; set contracts_dir to the directory of your .sol files.", dir)
+	case err != nil:
+		add(contractsCheck, Failed, "%v", err)
+	case len(contracts) == 0:
+		add(contractsCheck, Failed, "There are no .sol files in %s.", dir)
+	default:
+		add(contractsCheck, Passed, "%d .sol files in %s", len(contracts), dir)
+	}
+
+	const compileCheck = "solc compiles the contracts"
+	var bytecodeToFilename map[string]string
+	if results[len(results)-1].Status != Passed {
+		add(compileCheck, Skipped, "contracts_dir needs fixing first.")
+	} else if _, err := exec.LookPath("solc"); err != nil {
+		add(compileCheck, Failed, "solc isn't on the PATH; install the version your contracts are compiled with.")
+	} else if _, bytecodeToFilename, err = srcmap.Get(ctx, cfg.Compiler); err != nil {
+		add(compileCheck, Failed, "%v\nCheck solc_args, and that they match the settings your framework compiles with.", err)
+	} else {
+		add(compileCheck, Passed, "%d contracts compiled with solc %s", len(bytecodeToFilename), SolcVersion(ctx))
+	}
+
+	// The chain
+	const traceCheck = "the chain can be traced"
+	const sampleCheck = "the deployed code is the compiled code"
+	if cfg.Offline {
+		add(traceCheck, Skipped, "Offline, traces are read from the trace cache.")
+		add(sampleCheck, Skipped, "Offline, there's no chain to compare with.")
+		return results
+	}
+	testChain, err := coverage.StartChain(ctx, cfg)
+	if err != nil {
+		add(traceCheck, Failed, "The chain couldn't be started: %v", err)
+		add(sampleCheck, Skipped, "The chain has to be running first.")
+		return results
+	}
+	defer testChain.Stop()
+
+	url := testChain.URL
+	if traces, err := chain.Supports(ctx, url, "trace_replayTransaction", zeroHash, []string{"vmTrace"}); err != nil {
+		add(traceCheck, Failed, "Nothing answered on %s (%v). Start your node, set node_command to start one, or set backend to embedded.", url, err)
+		add(sampleCheck, Skipped, "The chain has to be running first.")
+		return results
+	} else if traces {
+		add(traceCheck, Passed, "%s answers trace_replayTransaction", url)
+	} else if structLogs, _ := chain.Supports(ctx, url, "debug_traceTransaction", zeroHash); structLogs {
+		add(traceCheck, Passed, "%s answers debug_traceTransaction but not trace_replayTransaction, so cover and watch work, but debug, display, step, calltree and state-diff don't.", url)
+	} else {
+		add(traceCheck, Failed, "%s answers neither trace_replayTransaction nor debug_traceTransaction. Use a node that traces transactions, like geth, Erigon or Nethermind, or set backend to embedded.", url)
+	}
+
+	switch {
+	case bytecodeToFilename == nil:
+		add(sampleCheck, Skipped, "The contracts have to compile first.")
+	case cfg.RunsChain():
+		add(sampleCheck, Skipped, "Each run gets a fresh chain, so there's no code to compare until the tests deploy it.")
+	default:
+		status, detail := checkSample(ctx, cfg, url, txnHash, bytecodeToFilename)
+		add(sampleCheck, status, "%s", detail)
+	}
+	return results
+}
+
+// Compares the code that the sample transaction called with the compiled
+// contracts.
+func checkSample(ctx context.Context, cfg coverage.Config, url string, txnHash string, bytecodeToFilename map[string]string) (Status, string) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	defer client.Close()
+
+	var address ethcommon.Address
+	if txnHash == "" {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return Failed, err.Error()
+		}
+		last := header.Number.Uint64()
+		first := uint64(1)
+		if last > sampleBlocks {
+			first = last - sampleBlocks + 1
+		}
+		fetcher := cfg.NewFetcher(url, nil)
+		var txns []fetch.Transaction
+		if last != 0 {
+			if txns, err = fetcher.ContractTransactions(ctx, first, last); err != nil {
+				return Failed, err.Error()
+			}
+		}
+		if len(txns) == 0 {
+			return Skipped, fmt.Sprintf("No contract was called in the last %d blocks; pass --txn with a transaction your tests sent.", sampleBlocks)
+		}
+		txnHash = txns[len(txns)-1].Hash
+		address = ethcommon.HexToAddress(txns[len(txns)-1].To)
+	} else {
+		hash := ethcommon.HexToHash(txnHash)
+		txn, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return Failed, fmt.Sprintf("%s couldn't be found (%v); check that blockchain_client is the node that mined it.", txnHash, err)
+		}
+		if txn.To() != nil {
+			address = *txn.To()
+		} else {
+			receipt, err := client.TransactionReceipt(ctx, hash)
+			if err != nil {
+				return Failed, err.Error()
+			}
+			address = receipt.ContractAddress
+		}
+	}
+
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return Failed, err.Error()
+	}
+	if len(code) == 0 {
+		return Failed, fmt.Sprintf("%s, which %s called, has no code; pass --txn with a transaction to one of your contracts.", address.Hex(), txnHash)
+	}
+	if contractName, ok := bytecodeToFilename[evmbytecode.RemoveMetaData("0x"+hex.EncodeToString(code))]; ok {
+		return Passed, fmt.Sprintf("%s, which %s called, is %s", address.Hex(), txnHash, contractName)
+	}
+	return Failed, fmt.Sprintf("%s, which %s called, isn't any of the contracts compiled from contracts_dir. Check that solc_args and the version of solc match the ones it was deployed with, or pass --txn with a transaction to one of your contracts.", address.Hex(), txnHash)
+}
@@ -2,13 +2,24 @@ package solc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strings"
 
-	"github.com/spf13/viper"
+	"github.com/reserve-protocol/solstice/common"
 )
 
+// How the contracts are compiled: the .sol files under ContractsDir, with
+// Args passed to solc before the ones solstice adds. solc runs in
+// ContractsDir.
+type Compiler struct {
+	ContractsDir string
+	Args         []string
+}
+
 type CombinedJSON struct {
 	Contracts  map[string]runtimeArtifacts
 	SourceList []string
@@ -16,8 +27,10 @@ type CombinedJSON struct {
 }
 
 type runtimeArtifacts struct {
-	SrcmapRuntime string `json:"srcmap-runtime"`
-	BinRuntime    string `json:"bin-runtime"`
+	SrcmapRuntime string          `json:"srcmap-runtime"`
+	BinRuntime    string          `json:"bin-runtime"`
+	ABI           json.RawMessage `json:"abi"`
+	StorageLayout json.RawMessage `json:"storage-layout"`
 }
 
 type topASTNode struct {
@@ -25,24 +38,48 @@ type topASTNode struct {
 }
 
 type JSONAST struct {
-	ID       uint
-	Src      string
-	Children []*JSONAST
-	// name string
-	// attributes, which is a rich collection of information we're not using
+	ID         uint
+	Src        string
+	Name       string // The kind of node, e.g. "FunctionDefinition"
+	Attributes JSONASTAttributes
+	Children   []*JSONAST
+}
+
+// A small part of the rich collection of information in each node's
+// attributes. Which of them are set depends on the kind of node.
+type JSONASTAttributes struct {
+	Name            string // The declared name of contracts, functions and variables
+	Type            string // The type of variables and expressions, e.g. "uint256"
+	IsConstructor   bool
+	Kind            string
+	StorageLocation string
+	StateVariable   bool
+	Constant        bool
+	Operator        string // The operator of unary and binary operations, e.g. "+"
+	Value           string // The value of literals and the name an identifier refers to
+	Token           string // The kind of literal, e.g. "number" or "string"
+}
+
+// solc couldn't be run, or couldn't compile the contracts. The error it's
+// wrapped in includes what solc printed.
+var ErrCompileFailed = errors.New("Compiling the contracts failed")
+
+// All the contracts under ContractsDir.
+func (compiler Compiler) Contracts() ([]string, error) {
+	return common.AllContracts(compiler.ContractsDir)
 }
 
-func GetCombinedJSON(artifactList string, contracts []string) (CombinedJSON, error) {
+func (compiler Compiler) CombinedJSON(ctx context.Context, artifactList string, contracts []string) (CombinedJSON, error) {
 	var outputJSON CombinedJSON
 	solcArgs := append(
 		append(
-			viper.GetStringSlice("solc_args"),
+			append([]string(nil), compiler.Args...),
 			"--combined-json="+artifactList,
 		),
 		contracts...,
 	)
-	cmd := exec.Command("solc", solcArgs...)
-	cmd.Dir = viper.GetString("contracts_dir")
+	cmd := exec.CommandContext(ctx, "solc", solcArgs...)
+	cmd.Dir = compiler.ContractsDir
 
 	var out bytes.Buffer
 	var stderr bytes.Buffer
@@ -50,8 +87,10 @@ func GetCombinedJSON(artifactList string, contracts []string) (CombinedJSON, err
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	if err != nil {
-		fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-		return CombinedJSON{}, err
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			err = fmt.Errorf("%v: %s", err, output)
+		}
+		return CombinedJSON{}, fmt.Errorf("%w: %v", ErrCompileFailed, err)
 	}
 
 	err = json.Unmarshal(out.Bytes(), &outputJSON)
@@ -0,0 +1,34 @@
+package srclocation
+
+import (
+	"io/ioutil"
+	"sort"
+)
+
+// Finds the line numbers of locations, reading each file only once.
+type LineFinder struct {
+	lineStarts map[string][]int
+}
+
+func NewLineFinder() *LineFinder {
+	return &LineFinder{lineStarts: make(map[string][]int)}
+}
+
+// The line that a location starts on, counting from 1.
+func (finder *LineFinder) Line(location SourceLocation) (int, error) {
+	lineStarts, ok := finder.lineStarts[location.SourceFileName]
+	if !ok {
+		source, err := ioutil.ReadFile(location.SourceFileName)
+		if err != nil {
+			return 0, err
+		}
+		lineStarts = []int{0}
+		for i, sourceByte := range source {
+			if sourceByte == '\n' {
+				lineStarts = append(lineStarts, i+1)
+			}
+		}
+		finder.lineStarts[location.SourceFileName] = lineStarts
+	}
+	return sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > location.ByteOffset }), nil
+}
@@ -1,22 +1,29 @@
 package srcmap
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 
-	"github.com/reserve-protocol/solstice/common"
 	"github.com/reserve-protocol/solstice/evmbytecode"
 	"github.com/reserve-protocol/solstice/solc"
 	"github.com/reserve-protocol/solstice/srclocation"
 )
 
-func Get() (map[string][]srclocation.SourceLocation, map[string]string, error) {
-	files, err := common.AllContracts()
+// The code that ran doesn't line up with the source map of the contract it
+// was matched to, which happens when the deployed contracts were compiled
+// with different settings or a different solc than solc_args.
+var ErrSourceMapMismatch = errors.New("The code that ran doesn't match the source map of its contract.")
+
+func Get(ctx context.Context, compiler solc.Compiler) (map[string][]srclocation.SourceLocation, map[string]string, error) {
+	files, err := compiler.Contracts()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	srcMapJSON, err := solc.GetCombinedJSON("srcmap-runtime,bin-runtime", files)
+	srcMapJSON, err := compiler.CombinedJSON(ctx, "srcmap-runtime,bin-runtime", files)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -64,6 +71,9 @@ func Decompress(srcMap string, srcList []string) ([]srclocation.SourceLocation,
 					if err != nil {
 						return sourceLocations, err
 					}
+					if sourceFileIndex >= len(srcList) || sourceFileIndex < -1 {
+						return sourceLocations, fmt.Errorf("Source map refers to source %d, but solc listed %d.", sourceFileIndex, len(srcList))
+					}
 					if sourceFileIndex != -1 {
 						currentStruct.SourceFileName = srcList[sourceFileIndex]
 					} else {
@@ -81,3 +91,16 @@ func Decompress(srcMap string, srcList []string) ([]srclocation.SourceLocation,
 	}
 	return sourceLocations, nil
 }
+
+// The source location of the op at a program counter. pcToOpIndex is from
+// evmbytecode.GetPcToOpIndex of the code that ran.
+func Location(sourceMap []srclocation.SourceLocation, pcToOpIndex map[int]int, pc int) (srclocation.SourceLocation, error) {
+	opIndex, ok := pcToOpIndex[pc]
+	if !ok {
+		return srclocation.SourceLocation{}, fmt.Errorf("%w No op starts at program counter %d.", ErrSourceMapMismatch, pc)
+	}
+	if opIndex >= len(sourceMap) {
+		return srclocation.SourceLocation{}, fmt.Errorf("%w Op %d is past the end of the source map, which has %d.", ErrSourceMapMismatch, opIndex, len(sourceMap))
+	}
+	return sourceMap[opIndex], nil
+}
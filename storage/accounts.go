@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/reserve-protocol/solstice/calltree"
+)
+
+// Maps each account whose code ran in the call tree to the contract its
+// storage is laid out by. Delegate calls run in their caller's storage, so a
+// proxy's storage is decoded with the layout of the contract it delegates to,
+// as long as that contract has state variables.
+func Accounts(root *calltree.Call, layouts map[string]Layout) map[string]string {
+	accounts := make(map[string]string)
+	var visit func(call *calltree.Call, owner string)
+	visit = func(call *calltree.Call, owner string) {
+		switch call.Type {
+		case "DELEGATECALL", "CALLCODE":
+			if owner != "" && len(layouts[call.Contract].Storage) != 0 {
+				accounts[owner] = call.Contract
+			}
+		default:
+			owner = strings.ToLower(call.Address)
+			if _, ok := accounts[owner]; owner != "" && !ok {
+				accounts[owner] = call.Contract
+			}
+		}
+		for _, sub := range call.Calls {
+			visit(sub, owner)
+		}
+	}
+	visit(root, "")
+	return accounts
+}
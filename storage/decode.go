@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/variables"
+)
+
+// Keccak hashes computed during a transaction, keyed by the hash as 64 hex
+// digits, and mapped to what was hashed. Mapping values and dynamic array
+// elements are stored at slots derived from these hashes.
+type Preimages map[string][]byte
+
+// Slots this far past a hash are still considered to be derived from it,
+// as elements of arrays or members of structs.
+var maxDerivedOffset = big.NewInt(1 << 32)
+
+// A change to a named part of a contract's state, e.g. "balances[0xab...]".
+type Change struct {
+	Path string
+	From string
+	To   string
+}
+
+// A part of storage that starts at a slot. Slot is the slot being decoded
+// relative to that start, and Offset the byte offset within the slot for
+// value types that share it.
+type region struct {
+	path   string
+	typeID string
+	slot   *big.Int
+	offset int
+}
+
+type leaf struct {
+	path   string
+	typeID string
+	offset int
+}
+
+// Decodes a change to a storage slot into changes to the state variables
+// stored in it. Slots that can't be matched to a variable are named by their
+// number.
+func (layout Layout) DecodeSlot(slot string, from string, to string, preimages Preimages) []Change {
+	slotNumber, ok := new(big.Int).SetString(strings.TrimPrefix(slot, "0x"), 16)
+	if !ok {
+		return []Change{{Path: "slot " + slot, From: from, To: to}}
+	}
+	fromWord := toWord(from)
+	toWord := toWord(to)
+
+	var changes []Change
+	for _, region := range layout.locate(slotNumber, preimages, 0) {
+		for _, leaf := range layout.leaves(region) {
+			typ := layout.Types[leaf.typeID]
+			path := leaf.path
+			if typ.Encoding == "mapping" {
+				continue
+			}
+			if typ.Encoding == "dynamic_array" {
+				path += ".length"
+				typ = Type{Encoding: "inplace", Label: "uint256", NumberOfBytes: "32"}
+			}
+
+			change := Change{
+				Path: path,
+				From: formatValue(typ, fromWord, leaf.offset),
+				To:   formatValue(typ, toWord, leaf.offset),
+			}
+			if change.From != change.To {
+				changes = append(changes, change)
+			}
+		}
+	}
+
+	if len(changes) == 0 && fromWord != toWord {
+		changes = append(changes, Change{
+			Path: fmt.Sprintf("slot 0x%x", slotNumber),
+			From: "0x" + hex.EncodeToString(fromWord[:]),
+			To:   "0x" + hex.EncodeToString(toWord[:]),
+		})
+	}
+	return changes
+}
+
+func toWord(value string) [32]byte {
+	var word [32]byte
+	decoded, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil && len(value)%2 == 1 {
+		decoded, err = hex.DecodeString("0" + strings.TrimPrefix(value, "0x"))
+	}
+	if err != nil || len(decoded) > 32 {
+		return word
+	}
+	copy(word[32-len(decoded):], decoded)
+	return word
+}
+
+// Finds the regions of storage that contain the slot.
+func (layout Layout) locate(slot *big.Int, preimages Preimages, depth int) []region {
+	var regions []region
+	for _, variable := range layout.Storage {
+		start := variable.slot()
+		end := new(big.Int).Add(start, big.NewInt(layout.Types[variable.Type].slots()))
+		if start.Cmp(slot) <= 0 && slot.Cmp(end) < 0 {
+			regions = append(regions, region{
+				path:   variable.Label,
+				typeID: variable.Type,
+				slot:   new(big.Int).Sub(slot, start),
+				offset: variable.Offset,
+			})
+		}
+	}
+	if len(regions) != 0 || depth > 8 {
+		return regions
+	}
+
+	for hash, preimage := range preimages {
+		if len(preimage) < 32 {
+			continue
+		}
+		hashNumber, ok := new(big.Int).SetString(hash, 16)
+		if !ok {
+			continue
+		}
+		derivedOffset := new(big.Int).Sub(slot, hashNumber)
+		if derivedOffset.Sign() < 0 || derivedOffset.Cmp(maxDerivedOffset) >= 0 {
+			continue
+		}
+
+		baseSlot := new(big.Int).SetBytes(preimage[len(preimage)-32:])
+		key := preimage[:len(preimage)-32]
+		for _, baseRegion := range layout.locate(baseSlot, preimages, depth+1) {
+			for _, base := range layout.leaves(baseRegion) {
+				regions = append(regions, layout.derivedRegions(base, key, derivedOffset)...)
+			}
+		}
+	}
+	return regions
+}
+
+// The regions at an offset from the hash of a mapping's key and slot, or of a
+// dynamic array's slot.
+func (layout Layout) derivedRegions(base leaf, key []byte, derivedOffset *big.Int) []region {
+	typ := layout.Types[base.typeID]
+	switch {
+	case typ.Encoding == "mapping" && len(key) != 0:
+		return []region{{
+			path:   base.path + "[" + layout.formatKey(typ.Key, key) + "]",
+			typeID: typ.Value,
+			slot:   derivedOffset,
+		}}
+	case typ.Encoding == "dynamic_array" && len(key) == 0:
+		element := layout.Types[typ.Base]
+		if element.size() >= 32 {
+			slotsPerElement := big.NewInt(element.slots())
+			index, slot := new(big.Int).DivMod(derivedOffset, slotsPerElement, new(big.Int))
+			return []region{{
+				path:   fmt.Sprintf("%s[%s]", base.path, index),
+				typeID: typ.Base,
+				slot:   slot,
+			}}
+		}
+
+		var regions []region
+		perSlot := 32 / element.size()
+		for i := 0; i < perSlot; i++ {
+			index := new(big.Int).Mul(derivedOffset, big.NewInt(int64(perSlot)))
+			index.Add(index, big.NewInt(int64(i)))
+			regions = append(regions, region{
+				path:   fmt.Sprintf("%s[%s]", base.path, index),
+				typeID: typ.Base,
+				slot:   new(big.Int),
+				offset: i * element.size(),
+			})
+		}
+		return regions
+	case typ.Encoding == "bytes" && len(key) == 0:
+		return []region{{
+			path: fmt.Sprintf("%s (data slot %s)", base.path, derivedOffset),
+			slot: new(big.Int),
+		}}
+	}
+	return nil
+}
+
+// Breaks a region down into the variables in its slot.
+func (layout Layout) leaves(part region) []leaf {
+	typ, ok := layout.Types[part.typeID]
+	if !ok {
+		if part.slot.Sign() == 0 {
+			return []leaf{{path: part.path, typeID: part.typeID}}
+		}
+		return nil
+	}
+
+	if typ.Encoding == "inplace" && len(typ.Members) != 0 {
+		var leaves []leaf
+		for _, member := range typ.Members {
+			start := member.slot()
+			end := new(big.Int).Add(start, big.NewInt(layout.Types[member.Type].slots()))
+			if start.Cmp(part.slot) <= 0 && part.slot.Cmp(end) < 0 {
+				leaves = append(leaves, layout.leaves(region{
+					path:   part.path + "." + member.Label,
+					typeID: member.Type,
+					slot:   new(big.Int).Sub(part.slot, start),
+					offset: member.Offset,
+				})...)
+			}
+		}
+		return leaves
+	}
+
+	if typ.Encoding == "inplace" && typ.Base != "" {
+		element := layout.Types[typ.Base]
+		length := staticLength(typ.Label)
+		if element.size() >= 32 {
+			slotsPerElement := big.NewInt(element.slots())
+			index, slot := new(big.Int).DivMod(part.slot, slotsPerElement, new(big.Int))
+			return layout.leaves(region{
+				path:   fmt.Sprintf("%s[%s]", part.path, index),
+				typeID: typ.Base,
+				slot:   slot,
+			})
+		}
+
+		var leaves []leaf
+		perSlot := 32 / element.size()
+		for i := 0; i < perSlot; i++ {
+			index := part.slot.Int64()*int64(perSlot) + int64(i)
+			if index < length {
+				leaves = append(leaves, leaf{
+					path:   fmt.Sprintf("%s[%d]", part.path, index),
+					typeID: typ.Base,
+					offset: i * element.size(),
+				})
+			}
+		}
+		return leaves
+	}
+
+	if part.slot.Sign() != 0 {
+		return nil
+	}
+	return []leaf{{path: part.path, typeID: part.typeID, offset: part.offset}}
+}
+
+// The length of a static array type, from the end of its label, e.g. "uint8[4]".
+func staticLength(label string) int64 {
+	openIndex := strings.LastIndex(label, "[")
+	if openIndex < 0 || !strings.HasSuffix(label, "]") {
+		return 0
+	}
+	length, err := strconv.ParseInt(label[openIndex+1:len(label)-1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+// Formats a mapping key as it was hashed. Value types are padded to a word;
+// strings and bytes are hashed as they are.
+func (layout Layout) formatKey(keyTypeID string, key []byte) string {
+	typ := layout.Types[keyTypeID]
+	switch {
+	case typ.Encoding == "bytes" && typ.Label == "string":
+		return strconv.Quote(string(key))
+	case typ.Encoding == "bytes" || len(key) != 32:
+		return "0x" + hex.EncodeToString(key)
+	}
+	var word [32]byte
+	copy(word[:], key)
+	if strings.HasPrefix(typ.Label, "bytes") {
+		// Fixed size byte arrays are left aligned in the word, but are stored
+		// right aligned in slots, which is what formatValue expects.
+		return decodeBytesN(typ, word[:typ.size()])
+	}
+	return formatValue(Type{Label: typ.Label, NumberOfBytes: "32"}, word, 0)
+}
+
+// Formats the value of the type stored in the word at the offset, counted
+// from the lowest-order byte.
+func formatValue(typ Type, word [32]byte, offset int) string {
+	if typ.Label == "" {
+		return "0x" + hex.EncodeToString(word[:])
+	}
+
+	size := typ.size()
+	if offset < 0 || size <= 0 || offset+size > 32 {
+		return "0x" + hex.EncodeToString(word[:])
+	}
+	value := word[32-offset-size : 32-offset]
+
+	if typ.Encoding == "bytes" {
+		// Up to 31 bytes are stored in the slot itself, with twice the length
+		// in the lowest-order byte. Longer values store twice the length plus
+		// one, and keep their data at the hash of the slot.
+		lengthByte := word[31]
+		if lengthByte%2 == 0 && lengthByte/2 < 32 {
+			contents := word[:lengthByte/2]
+			if typ.Label == "string" {
+				return strconv.Quote(string(contents))
+			}
+			return "0x" + hex.EncodeToString(contents)
+		}
+		length := new(big.Int).SetBytes(word[:])
+		length.Rsh(length, 1)
+		return fmt.Sprintf("<%s bytes>", length)
+	}
+
+	if strings.HasPrefix(typ.Label, "bytes") {
+		return decodeBytesN(typ, value)
+	}
+
+	var padded [32]byte
+	copy(padded[32-size:], value)
+	if strings.HasPrefix(typ.Label, "int") && len(value) != 0 && value[0]&0x80 != 0 {
+		for i := 0; i < 32-size; i++ {
+			padded[i] = 0xff
+		}
+	}
+	return variables.DecodeValue(typ.Label, "0x"+hex.EncodeToString(padded[:]), nil)
+}
+
+func decodeBytesN(typ Type, value []byte) string {
+	var padded [32]byte
+	copy(padded[:], value)
+	return variables.DecodeValue(typ.Label, "0x"+hex.EncodeToString(padded[:]), nil)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	"github.com/reserve-protocol/solstice/solc"
+)
+
+// Where solc puts a contract's state variables in storage. Documented here;
+// https://docs.soliditylang.org/en/latest/internals/layout_in_storage.html
+type Layout struct {
+	Storage []Variable
+	Types   map[string]Type
+}
+
+// A state variable, or a member of a struct. Slot is relative to the start of
+// the struct for members. Offset is the byte offset within the slot, counted
+// from the lowest-order byte.
+type Variable struct {
+	Label  string
+	Offset int
+	Slot   string
+	Type   string
+}
+
+// Encoding is one of "inplace", "mapping", "dynamic_array" or "bytes".
+// Mappings have a Key and Value type, arrays a Base type, and structs
+// Members.
+type Type struct {
+	Encoding      string
+	Label         string
+	NumberOfBytes string
+	Key           string
+	Value         string
+	Base          string
+	Members       []Variable
+}
+
+// Maps a contract name, as given by solc, to its storage layout.
+func Get(ctx context.Context, compiler solc.Compiler) (map[string]Layout, error) {
+	files, err := compiler.Contracts()
+	if err != nil {
+		return nil, err
+	}
+
+	layoutJSON, err := compiler.CombinedJSON(ctx, "storage-layout", files)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := make(map[string]Layout)
+	for contractName, artifacts := range layoutJSON.Contracts {
+		var layout Layout
+		if len(artifacts.StorageLayout) != 0 {
+			// As with the ABI, some versions of solc give a string of JSON.
+			raw := artifacts.StorageLayout
+			var encoded string
+			if err := json.Unmarshal(raw, &encoded); err == nil {
+				raw = json.RawMessage(encoded)
+			}
+			if err := json.Unmarshal(raw, &layout); err != nil {
+				return layouts, err
+			}
+		}
+		layouts[contractName] = layout
+	}
+	return layouts, nil
+}
+
+func (variable Variable) slot() *big.Int {
+	slot, ok := new(big.Int).SetString(variable.Slot, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return slot
+}
+
+func (typ Type) size() int {
+	size, err := strconv.Atoi(typ.NumberOfBytes)
+	if err != nil {
+		return 32
+	}
+	return size
+}
+
+// The number of slots a value of the type takes up in place.
+func (typ Type) slots() int64 {
+	return int64((typ.size() + 31) / 32)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+// Collects the keccak hashes computed in the trace, along with the memory
+// they were computed from.
+func GetPreimages(steps []trace.Step) Preimages {
+	preimages := make(Preimages)
+	machine := trace.NewMachine()
+	for _, step := range steps {
+		if step.OpCode == "20" && len(step.Op.Ex.Push) == 1 { // SHA3
+			// Only the operands and the memory they point to are read, since
+			// SHA3 is frequent and the whole state is costly to copy.
+			offsetItem, okOffset := machine.StackItem(step, 0)
+			sizeItem, okSize := machine.StackItem(step, 1)
+			if okOffset && okSize {
+				offset, okOffset := new(big.Int).SetString(strings.TrimPrefix(offsetItem, "0x"), 16)
+				size, okSize := new(big.Int).SetString(strings.TrimPrefix(sizeItem, "0x"), 16)
+				hash, okHash := new(big.Int).SetString(strings.TrimPrefix(step.Op.Ex.Push[0], "0x"), 16)
+				// Slots are only ever derived from hashes of a few words.
+				if okOffset && okSize && okHash && offset.IsInt64() && size.IsInt64() && size.Int64() <= 1024 {
+					preimage := make([]byte, size.Int64())
+					if offset.Int64() <= math.MaxInt32 {
+						preimage = machine.Memory(step, int(offset.Int64()), int(size.Int64()))
+					}
+					preimages[fmt.Sprintf("%064x", hash)] = preimage
+				}
+			}
+		}
+		machine.Apply(step)
+	}
+	return preimages
+}
@@ -0,0 +1,47 @@
+package testcov
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/reserve-protocol/solstice/gitdiff"
+)
+
+// The tests that ran any line that was changed, going by the old version of
+// each file, which is the one the coverage was recorded for. Lines inserted
+// between two others affect the tests that ran either of them.
+func (coverage Coverage) Affected(files []gitdiff.FileDiff) []string {
+	changed := make(map[string][][2]int)
+	for _, file := range files {
+		if file.OldName == "" {
+			continue
+		}
+		for _, hunk := range file.Hunks {
+			if hunk.OldLines == 0 {
+				changed[file.OldName] = append(changed[file.OldName], [2]int{hunk.OldStart, hunk.OldStart + 1})
+			} else {
+				changed[file.OldName] = append(changed[file.OldName], [2]int{hunk.OldStart, hunk.OldStart + hunk.OldLines - 1})
+			}
+		}
+	}
+
+	var tests []string
+	for test, testFiles := range coverage {
+	testFiles:
+		for file, lines := range testFiles {
+			absolute, err := filepath.Abs(file)
+			if err != nil {
+				continue
+			}
+			for _, lineRange := range changed[absolute] {
+				index := sort.SearchInts(lines, lineRange[0])
+				if index < len(lines) && lines[index] <= lineRange[1] {
+					tests = append(tests, test)
+					break testFiles
+				}
+			}
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
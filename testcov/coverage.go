@@ -0,0 +1,123 @@
+package testcov
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+// The lines of each source file that each test ran, by test name and then by
+// file name. Lines are sorted and start at 1.
+type Coverage map[string]map[string][]int
+
+// Builds up Coverage from the source locations that each test ran.
+type Collector struct {
+	*srclocation.LineFinder
+	lines map[string]map[string]map[int]struct{}
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		LineFinder: srclocation.NewLineFinder(),
+		lines:      make(map[string]map[string]map[int]struct{}),
+	}
+}
+
+// Records a test, so that it shows up even if it ran no code.
+func (collector *Collector) AddTest(test string) {
+	if _, ok := collector.lines[test]; !ok {
+		collector.lines[test] = make(map[string]map[int]struct{})
+	}
+}
+
+func (collector *Collector) Add(test string, location srclocation.SourceLocation) error {
+	line, err := collector.Line(location)
+	if err != nil {
+		return err
+	}
+
+	collector.AddTest(test)
+	files := collector.lines[test]
+	if files[location.SourceFileName] == nil {
+		files[location.SourceFileName] = make(map[int]struct{})
+	}
+	files[location.SourceFileName][line] = struct{}{}
+	return nil
+}
+
+func (collector *Collector) Coverage() Coverage {
+	coverage := make(Coverage)
+	for test, files := range collector.lines {
+		coverage[test] = make(map[string][]int)
+		for file, lines := range files {
+			for line := range lines {
+				coverage[test][file] = append(coverage[test][file], line)
+			}
+			sort.Ints(coverage[test][file])
+		}
+	}
+	return coverage
+}
+
+func (coverage Coverage) covers(test string, file string, line int) bool {
+	lines := coverage[test][file]
+	index := sort.SearchInts(lines, line)
+	return index < len(lines) && lines[index] == line
+}
+
+// The names of the tests that ran the line, sorted.
+func (coverage Coverage) TestsCovering(file string, line int) []string {
+	var tests []string
+	for test := range coverage {
+		if coverage.covers(test, file, line) {
+			tests = append(tests, test)
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+// The tests that only ran lines that other tests ran too, sorted. These are
+// candidates for removal, or for a closer look at what they're testing.
+func (coverage Coverage) WithoutUniqueLines() []string {
+	var tests []string
+	for test, files := range coverage {
+		unique := false
+		for file, lines := range files {
+			for _, line := range lines {
+				if len(coverage.TestsCovering(file, line)) == 1 {
+					unique = true
+					break
+				}
+			}
+			if unique {
+				break
+			}
+		}
+		if !unique {
+			tests = append(tests, test)
+		}
+	}
+	sort.Strings(tests)
+	return tests
+}
+
+func (coverage Coverage) WriteJSON(filename string) error {
+	coverageJSON, err := json.MarshalIndent(coverage, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, coverageJSON, 0644)
+}
+
+func ReadJSON(filename string) (Coverage, error) {
+	var coverage Coverage
+	coverageJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return coverage, err
+	}
+	err = json.Unmarshal(coverageJSON, &coverage)
+	return coverage, err
+}
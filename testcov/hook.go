@@ -0,0 +1,112 @@
+package testcov
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// The blocks a test ran over. Its transactions are in the blocks after Start,
+// up to and including End.
+type TestRange struct {
+	Name  string
+	Start uint64
+	End   uint64
+}
+
+// An HTTP server that tests call as they start and end, so their transactions
+// can be told apart. A test framework calls it with e.g.
+//
+//	POST /start?name=transfers+tokens
+//	POST /end?name=transfers+tokens
+//
+// and the hook records the block number at each call. Tests that never call
+// /end are taken to run until the last block.
+type Hook struct {
+	currentBlock func() (uint64, error)
+	lock         sync.Mutex
+	started      map[string]uint64
+	ranges       []TestRange
+	server       *http.Server
+}
+
+func NewHook(currentBlock func() (uint64, error)) *Hook {
+	return &Hook{
+		currentBlock: currentBlock,
+		started:      make(map[string]uint64),
+	}
+}
+
+func (hook *Hook) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	name := request.FormValue("name")
+	if request.Method != http.MethodPost || name == "" {
+		http.Error(writer, "POST to /start or /end with a test name.", http.StatusBadRequest)
+		return
+	}
+
+	block, err := hook.currentBlock()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	switch request.URL.Path {
+	case "/start":
+		hook.started[name] = block
+	case "/end":
+		start, ok := hook.started[name]
+		if !ok {
+			http.Error(writer, fmt.Sprintf("Test %q was never started.", name), http.StatusBadRequest)
+			return
+		}
+		delete(hook.started, name)
+		hook.ranges = append(hook.ranges, TestRange{Name: name, Start: start, End: block})
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+// Starts serving in the background.
+func (hook *Hook) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	hook.server = &http.Server{Handler: hook}
+	go hook.server.Serve(listener)
+	return nil
+}
+
+func (hook *Hook) Close() error {
+	if hook.server == nil {
+		return nil
+	}
+	return hook.server.Close()
+}
+
+// The ranges of the tests seen so far. Tests still running end at lastBlock.
+func (hook *Hook) Ranges(lastBlock uint64) []TestRange {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+
+	ranges := append([]TestRange(nil), hook.ranges...)
+	for name, start := range hook.started {
+		ranges = append(ranges, TestRange{Name: name, Start: start, End: lastBlock})
+	}
+	return ranges
+}
+
+// The test that a transaction in the block belongs to, or "" if none does.
+// If tests overlap, the one that started last is picked.
+func TestAt(ranges []TestRange, block uint64) string {
+	var test TestRange
+	for _, testRange := range ranges {
+		if testRange.Start < block && block <= testRange.End && (test.Name == "" || testRange.Start > test.Start) {
+			test = testRange
+		}
+	}
+	return test.Name
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/abi"
+)
+
+func hexData(t *testing.T, words ...string) []byte {
+	data, err := hex.DecodeString(strings.Join(words, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeErrorString(t *testing.T) {
+	data := hexData(t,
+		"08c379a0",
+		"0000000000000000000000000000000000000000000000000000000000000020",
+		"0000000000000000000000000000000000000000000000000000000000000014",
+		"696e73756666696369656e742062616c616e6365000000000000000000000000",
+	)
+
+	if reason := abi.DecodeRevert(data, nil); reason != `Error("insufficient balance")` {
+		t.Errorf("Reason was %s", reason)
+	}
+}
+
+func TestDecodePanic(t *testing.T) {
+	data := hexData(t,
+		"4e487b71",
+		"0000000000000000000000000000000000000000000000000000000000000011",
+	)
+
+	if reason := abi.DecodeRevert(data, nil); reason != "Panic(0x11): arithmetic overflow or underflow" {
+		t.Errorf("Reason was %s", reason)
+	}
+}
+
+func TestDecodeCustomError(t *testing.T) {
+	customError := abi.Entry{
+		Type: "error",
+		Name: "InsufficientBalance",
+		Inputs: []abi.Param{
+			{Name: "account", Type: "address"},
+			{Name: "needed", Type: "int256"},
+			{Name: "ids", Type: "uint8[]"},
+		},
+	}
+	customErrors := abi.Errors(map[string][]abi.Entry{"Token.sol:Token": {customError}})
+
+	data := hexData(t,
+		customError.Selector(),
+		"000000000000000000000000000000000000000000000000000000000000abcd",
+		"fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe",
+		"0000000000000000000000000000000000000000000000000000000000000060",
+		"0000000000000000000000000000000000000000000000000000000000000002",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"0000000000000000000000000000000000000000000000000000000000000007",
+	)
+
+	want := "InsufficientBalance(account=0x000000000000000000000000000000000000abcd, needed=-2, ids=[1, 7])"
+	if reason := abi.DecodeRevert(data, customErrors); reason != want {
+		t.Errorf("Reason was %s", reason)
+	}
+}
+
+func TestDecodeUnknownRevert(t *testing.T) {
+	if reason := abi.DecodeRevert(nil, nil); reason != "reverted without a reason" {
+		t.Errorf("Reason was %s", reason)
+	}
+	if reason := abi.DecodeRevert([]byte{1, 2, 3, 4}, nil); reason != "unrecognized revert data 0x01020304" {
+		t.Errorf("Reason was %s", reason)
+	}
+}
+
+func TestDecodeStaticTuple(t *testing.T) {
+	params := []abi.Param{
+		{Name: "point", Type: "tuple", Components: []abi.Param{{Name: "x", Type: "uint256"}, {Name: "y", Type: "bool"}}},
+		{Name: "tag", Type: "bytes4"},
+	}
+	data := hexData(t,
+		"0000000000000000000000000000000000000000000000000000000000000003",
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		"deadbeef00000000000000000000000000000000000000000000000000000000",
+	)
+
+	values, err := abi.DecodeValues(params, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted := abi.FormatValues(params, values); formatted != "(point=(x=3, y=true), tag=0xdeadbeef)" {
+		t.Errorf("Values were %s", formatted)
+	}
+}
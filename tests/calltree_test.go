@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/calltree"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+var priceFunction = abi.Entry{
+	Type:    "function",
+	Name:    "price",
+	Inputs:  []abi.Param{{Name: "asset", Type: "uint8"}},
+	Outputs: []abi.Param{{Type: "uint256"}},
+}
+
+func TestCalltree(t *testing.T) {
+	caller := &trace.Frame{External: true, Contract: "Pool.sol:Pool"}
+	oracle := &trace.Frame{External: true, Contract: "Oracle.sol:Oracle", Parent: caller}
+	var steps []trace.Step
+	step := func(frame *trace.Frame, depth int, opCode string, op parity.Operation) {
+		steps = append(steps, trace.Step{Index: len(steps), OpCode: opCode, Frame: frame, Depth: depth, Op: op})
+	}
+	push := func(frame *trace.Frame, depth int, value string) {
+		step(frame, depth, "60", parity.Operation{Ex: parity.OperationEx{Push: []string{value}}})
+	}
+	mstore := func(frame *trace.Frame, depth int, data string) {
+		step(frame, depth, "52", parity.Operation{Ex: parity.OperationEx{Mem: &parity.MemoryWrite{Data: data}}})
+	}
+
+	// The pool calls price(2) on the oracle, which returns 100.
+	mstore(caller, 0, "0x"+priceFunction.Selector()+"0000000000000000000000000000000000000000000000000000000000000002")
+	for _, value := range []string{"0x20", "0x0", "0x24", "0x0", "0x0", "0xabc", "0xffff"} {
+		push(caller, 0, value)
+	}
+	sub := &parity.VMTrace{Ops: []parity.Operation{{Cost: 30, Ex: parity.OperationEx{Used: 70}}, {Ex: parity.OperationEx{Used: 70}}}}
+	step(caller, 0, "f1", parity.Operation{Sub: sub, Ex: parity.OperationEx{Push: []string{"0x1"}}})
+	mstore(oracle, 1, "0x0000000000000000000000000000000000000000000000000000000000000064")
+	push(oracle, 1, "0x20")
+	push(oracle, 1, "0x0")
+	step(oracle, 1, "f3", parity.Operation{})
+	// Then it reverts without a reason.
+	push(caller, 0, "0x0")
+	push(caller, 0, "0x0")
+	step(caller, 0, "fd", parity.Operation{})
+
+	root := calltree.Build(steps)
+	if len(root.Calls) != 1 || !root.Reverted {
+		t.Fatalf("Root call was %+v", root)
+	}
+	if call := root.Calls[0]; call.Address != "0x0000000000000000000000000000000000000abc" || call.Reverted || call.GasUsed != 30 {
+		t.Errorf("Sub-call was %+v", call)
+	}
+
+	var out bytes.Buffer
+	if err := calltree.Print(&out, root, map[string][]abi.Entry{"Oracle.sol:Oracle": {priceFunction}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "CALL Pool.receive() reverted: reverted without a reason [gas 0]\n" +
+		"└─ CALL Oracle.price(asset=2) -> (100) [0x0000000000000000000000000000000000000abc, gas 30]\n"
+	if out.String() != expected {
+		t.Errorf("Tree was:\n%s", out.String())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"testing"
+	"time"
+
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/devchain"
+)
+
+// Runs as the node started by TestStartNode, serving the embedded chain on
+// the address in SOLSTICE_TEST_NODE until interrupted.
+func TestHelperNode(t *testing.T) {
+	address := os.Getenv("SOLSTICE_TEST_NODE")
+	if address == "" {
+		return
+	}
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	devChain, err := devchain.New(devchain.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := devchain.NewServer(devChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start slowly, so that waiting for the node is tested.
+	time.Sleep(300 * time.Millisecond)
+	if err := server.Listen(address); err != nil {
+		t.Fatal(err)
+	}
+	<-interrupts
+	server.Close()
+	os.Exit(0)
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestStartNode(t *testing.T) {
+	address := freeAddress(t)
+	url := "http://" + address
+	os.Setenv("SOLSTICE_TEST_NODE", address)
+	defer os.Unsetenv("SOLSTICE_TEST_NODE")
+
+	command := []string{os.Args[0], "-test.run=^TestHelperNode$"}
+	node, err := chain.StartNode(context.Background(), command, url, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.Ready(url) {
+		t.Error("The node wasn't ready once started")
+	}
+
+	// The tests would run against a node that's already running.
+	if _, err := chain.StartNode(context.Background(), command, url, time.Second); err == nil {
+		t.Error("Started a second node on the same address")
+	}
+
+	node.Stop()
+	if chain.Ready(url) {
+		t.Error("The node was still answering once stopped")
+	}
+}
+
+func TestStartNodeThatExits(t *testing.T) {
+	_, err := chain.StartNode(context.Background(), []string{os.Args[0], "-test.run=^$"}, "http://"+freeAddress(t), 10*time.Second)
+	if err == nil {
+		t.Error("Started a node that exited")
+	}
+}
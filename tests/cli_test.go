@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/cmd"
+)
+
+// Runs as the solstice command started by the CLI tests, with the arguments
+// in SOLSTICE_TEST_CLI.
+func TestHelperSolstice(t *testing.T) {
+	args := os.Getenv("SOLSTICE_TEST_CLI")
+	if args == "" {
+		return
+	}
+	os.Args = append([]string{"solstice"}, strings.Fields(args)...)
+	cmd.Execute()
+	os.Exit(0)
+}
+
+// Runs solstice in dir, and returns what it printed.
+func runSolstice(t *testing.T, dir string, args ...string) (string, error) {
+	command := exec.Command(os.Args[0], "-test.run=^TestHelperSolstice$")
+	command.Dir = dir
+	command.Env = append(os.Environ(), "SOLSTICE_TEST_CLI="+strings.Join(args, " "))
+	output, err := command.CombinedOutput()
+	return string(output), err
+}
+
+func TestInitWritesConfigFlag(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "contracts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runSolstice(t, dir, "init", "--yes", "--config", "ci.yml")
+	if err != nil {
+		t.Fatalf("init failed (%v):\n%s", err, output)
+	}
+	written, err := os.ReadFile(filepath.Join(dir, "ci.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "contracts_dir: "+filepath.Join(dir, "contracts")) {
+		t.Errorf("Wrote\n%s", written)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config.yml")); !os.IsNotExist(err) {
+		t.Errorf("config.yml was written too: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+func TestEngineCompileFailed(t *testing.T) {
+	engine := coverage.NewEngine(coverage.Config{
+		Compiler:   solc.Compiler{ContractsDir: t.TempDir(), Args: []string{"--no-such-option"}},
+		ReportDir:  t.TempDir(),
+		FromTraces: t.TempDir(),
+	})
+	if _, err := engine.Run(context.Background()); !errors.Is(err, solc.ErrCompileFailed) {
+		t.Errorf("Running the engine gave %v", err)
+	}
+}
+
+func TestFetcherRetriesByDefault(t *testing.T) {
+	server := httptest.NewServer(&fakeNode{failures: 2})
+	defer server.Close()
+	if _, err := (coverage.Config{}).NewFetcher(server.URL, nil).ContractTransactions(context.Background(), 1, 1); err != nil {
+		t.Error(err)
+	}
+
+	server = httptest.NewServer(&fakeNode{failures: 1})
+	defer server.Close()
+	if _, err := (coverage.Config{RPCRetries: -1}).NewFetcher(server.URL, nil).ContractTransactions(context.Background(), 1, 1); err == nil {
+		t.Error("Fetching with retries turned off succeeded")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := coverage.Config{
+		Compiler:         solc.Compiler{ContractsDir: dir},
+		ReportDir:        dir,
+		TestCommand:      []string{"true"},
+		BlockchainClient: "http://localhost:8545",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validating a valid config gave %v", err)
+	}
+
+	missingDir := valid
+	missingDir.Compiler.ContractsDir = filepath.Join(dir, "missing")
+	noTestCommand := valid
+	noTestCommand.TestCommand = nil
+	noClient := valid
+	noClient.BlockchainClient = ""
+	unknownBackend := valid
+	unknownBackend.Backend = "ganache"
+	for _, cfg := range []coverage.Config{missingDir, noTestCommand, noClient, unknownBackend} {
+		if err := cfg.Validate(); !errors.Is(err, coverage.ErrInvalidConfig) {
+			t.Errorf("Validating %+v gave %v", cfg, err)
+		}
+	}
+
+	// Working from saved traces needs neither tests nor a chain.
+	fromTraces := noTestCommand
+	fromTraces.BlockchainClient = ""
+	fromTraces.FromTraces = dir
+	if err := fromTraces.Validate(); err != nil {
+		t.Errorf("Validating a config for saved traces gave %v", err)
+	}
+}
+
+func TestStartEmbeddedChain(t *testing.T) {
+	cfg := coverage.Config{Backend: "embedded", EmbeddedAddress: freeAddress(t), EmbeddedAccounts: 2}
+	if !cfg.RunsChain() {
+		t.Error("The embedded chain isn't run by solstice")
+	}
+	testChain, err := coverage.StartChain(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testChain.Embedded == nil || len(testChain.Embedded.Accounts()) != 2 {
+		t.Errorf("Started %v", testChain.Embedded)
+	}
+	if !chain.Ready(testChain.URL) {
+		t.Error("The embedded chain isn't answering")
+	}
+	testChain.Stop()
+	if chain.Ready(testChain.URL) {
+		t.Error("The embedded chain is still answering after being stopped")
+	}
+}
+
+func TestStartChainWithoutNode(t *testing.T) {
+	cfg := coverage.Config{BlockchainClient: "http://localhost:1"}
+	if cfg.RunsChain() {
+		t.Error("A chain is run without a backend or node_command")
+	}
+	testChain, err := coverage.StartChain(context.Background(), cfg)
+	if err != nil || testChain.URL != cfg.BlockchainClient || testChain.Embedded != nil {
+		t.Errorf("Started %v, %v", testChain, err)
+	}
+	testChain.Stop()
+}
+
+func TestTraceCacheConfigOffline(t *testing.T) {
+	dir := t.TempDir()
+	config := tracecache.Config{Dir: dir, Offline: true}
+	if _, err := config.Open(context.Background()); err == nil {
+		t.Error("Opened a cache with no chains offline")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "1337"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := config.Open(context.Background())
+	if err != nil || cache.Dir() != filepath.Join(dir, "1337") {
+		t.Errorf("Opened %v, %v", cache, err)
+	}
+}
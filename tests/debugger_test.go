@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/debugger"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+// Steps through jumpingCode, with a source file laid out so that each
+// location is on its own line. The source file is in dir.
+func jumpingDebugger(t *testing.T, dir string) *debugger.Debugger {
+	sourceFileName := filepath.Join(dir, "A.sol")
+	source := make([]byte, 100)
+	for i := range source {
+		source[i] = ' '
+		if i%10 == 9 {
+			source[i] = '\n'
+		}
+	}
+	if err := ioutil.WriteFile(sourceFileName, source, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sourceMap []srclocation.SourceLocation
+	for _, location := range jumpingSourceMap {
+		location.SourceFileName = sourceFileName
+		sourceMap = append(sourceMap, location)
+	}
+
+	vmTrace := parity.VMTrace{
+		Code: jumpingCode,
+		Ops: []parity.Operation{
+			{PC: 0, Ex: parity.OperationEx{Push: []string{"0x2"}}},
+			{PC: 1},
+			{PC: 2, Ex: parity.OperationEx{Mem: &parity.MemoryWrite{Off: 1, Data: "0xabcd"}}},
+			{PC: 3, Ex: parity.OperationEx{Store: &parity.StorageWrite{Key: "0x0", Val: "0x1"}}},
+			{PC: 4},
+		},
+	}
+	steps := trace.Flatten(
+		vmTrace,
+		map[string][]srclocation.SourceLocation{"A.sol:A": sourceMap},
+		map[string]string{jumpingCode: "A.sol:A"},
+	)
+	return debugger.New(steps)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "solstice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStepOverInternalCall(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	debug := jumpingDebugger(t, dir)
+	debug.StepInto()
+	if !debug.StepOver() || debug.Current != 4 {
+		t.Errorf("Stepped over to step %d", debug.Current)
+	}
+	if debug.StepOver() {
+		t.Errorf("Stepped past the end of the transaction")
+	}
+}
+
+func TestStepOutOfInternalCall(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	debug := jumpingDebugger(t, dir)
+	debug.StepInto()
+	debug.StepInto()
+	if debug.Current != 2 {
+		t.Fatalf("Stepped into step %d", debug.Current)
+	}
+	if !debug.StepOut() || debug.Current != 4 {
+		t.Errorf("Stepped out to step %d", debug.Current)
+	}
+}
+
+func TestContinueToBreakpoint(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	debug := jumpingDebugger(t, dir)
+	debug.Breakpoints = []debugger.Breakpoint{{File: "A.sol", Line: 6}}
+
+	hit, err := debug.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hit || debug.Current != 2 {
+		t.Errorf("Continued to step %d", debug.Current)
+	}
+}
+
+func TestStateBeforeStep(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	debug := jumpingDebugger(t, dir)
+	debug.Current = 4
+
+	state := debug.State()
+	if len(state.Stack) != 0 {
+		t.Errorf("Stack was %v", state.Stack)
+	}
+	if string(state.Memory) != "\x00\xab\xcd" {
+		t.Errorf("Memory was %x", state.Memory)
+	}
+	if state.Storage["0x0"] != "0x1" {
+		t.Errorf("Storage was %v", state.Storage)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/reserve-protocol/solstice/devchain"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// Stores the first word of calldata in slot 0, writes it to memory, and
+// emits it with the topic 0x2a.
+const storerCode = "60003580600055600052602a60206000a100"
+
+// Returns the runtime code that follows it, of the given length in bytes.
+func initCode(runtime string) string {
+	return fmt.Sprintf("0x60%02x80600b6000396000f3", len(runtime)/2) + runtime
+}
+
+// Calls the address with no calldata.
+func callerCode(address common.Address) string {
+	return "60006000600060006000" + "73" + strings.TrimPrefix(strings.ToLower(address.Hex()), "0x") + "5af100"
+}
+
+type devchainClient struct {
+	t      *testing.T
+	client *rpc.Client
+	from   common.Address
+}
+
+func (client devchainClient) call(result interface{}, method string, args ...interface{}) {
+	client.t.Helper()
+	if err := client.client.Call(result, method, args...); err != nil {
+		client.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func (client devchainClient) send(to *common.Address, data string) (string, map[string]interface{}) {
+	client.t.Helper()
+	args := map[string]interface{}{"from": client.from, "data": data}
+	if to != nil {
+		args["to"] = to
+	}
+	var hash string
+	client.call(&hash, "eth_sendTransaction", args)
+	var receipt map[string]interface{}
+	client.call(&receipt, "eth_getTransactionReceipt", hash)
+	if receipt["status"] != "0x1" {
+		client.t.Fatalf("Transaction %s failed: %v", hash, receipt)
+	}
+	return hash, receipt
+}
+
+func newDevchain(t *testing.T) (*devchain.Chain, devchainClient, func()) {
+	chain, err := devchain.New(devchain.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := devchain.NewServer(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Listen("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	client, err := rpc.Dial(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devClient := devchainClient{t: t, client: client}
+	var accounts []common.Address
+	devClient.call(&accounts, "eth_accounts")
+	if len(accounts) != 10 {
+		t.Fatalf("%d accounts", len(accounts))
+	}
+	devClient.from = accounts[0]
+	return chain, devClient, func() {
+		client.Close()
+		server.Close()
+		chain.Close()
+	}
+}
+
+func TestDevchainTracesTransactions(t *testing.T) {
+	chain, client, closeChain := newDevchain(t)
+	defer closeChain()
+
+	_, receipt := client.send(nil, initCode(storerCode))
+	storer := common.HexToAddress(receipt["contractAddress"].(string))
+	_, receipt = client.send(nil, initCode(callerCode(storer)))
+	caller := common.HexToAddress(receipt["contractAddress"].(string))
+
+	var code hexutil.Bytes
+	client.call(&code, "eth_getCode", storer, "latest")
+	if hexutil.Encode(code) != "0x"+storerCode {
+		t.Fatalf("Deployed code was %s", hexutil.Encode(code))
+	}
+
+	word := "0x" + strings.Repeat("0", 63) + "5"
+	hash, receipt := client.send(&storer, word)
+	logs := receipt["logs"].([]interface{})
+	if len(logs) != 1 || logs[0].(map[string]interface{})["data"] != word {
+		t.Errorf("Logs were %v", logs)
+	}
+	var stored hexutil.Bytes
+	client.call(&stored, "eth_getStorageAt", storer, "0x0", "latest")
+	if hexutil.Encode(stored) != word {
+		t.Errorf("Slot 0 was %s", hexutil.Encode(stored))
+	}
+
+	var execTrace parity.ExecTrace
+	client.call(&execTrace, "trace_replayTransaction", hash, []string{"vmTrace"})
+	if execTrace.Code != "0x"+storerCode || len(execTrace.Ops) != 12 {
+		t.Fatalf("Traced %d ops of %s", len(execTrace.Ops), execTrace.Code)
+	}
+	if push := execTrace.Ops[1].Ex.Push; len(push) != 1 || push[0] != "0x5" {
+		t.Errorf("CALLDATALOAD pushed %v", push)
+	}
+	if store := execTrace.Ops[4].Ex.Store; store == nil || *store != (parity.StorageWrite{Key: "0x0", Val: "0x5"}) {
+		t.Errorf("SSTORE stored %v", store)
+	}
+	if mem := execTrace.Ops[6].Ex.Mem; mem == nil || mem.Off != 0 || mem.Data != word {
+		t.Errorf("MSTORE wrote %v", mem)
+	}
+	for i, cost := range execTrace.GasCosts() {
+		if cost <= 0 && i != len(execTrace.Ops)-1 {
+			t.Errorf("Op %d cost %d", i, cost)
+		}
+	}
+
+	// Calls are traced as subtraces of the op that made them.
+	hash, _ = client.send(&caller, "0x")
+	client.call(&execTrace, "trace_replayTransaction", hash, []string{"vmTrace"})
+	if len(execTrace.Ops) != 9 {
+		t.Fatalf("Traced %d ops of the caller", len(execTrace.Ops))
+	}
+	call := execTrace.Ops[7]
+	if call.Sub == nil || call.Sub.Code != "0x"+storerCode || len(call.Sub.Ops) != 12 {
+		t.Fatalf("The call's subtrace was %v", call.Sub)
+	}
+	if len(call.Ex.Push) != 1 || call.Ex.Push[0] != "0x1" {
+		t.Errorf("CALL pushed %v", call.Ex.Push)
+	}
+
+	// Traces can also be had without a round trip.
+	var txns []fetch.Transaction
+	err := chain.BlockTraces(1, chain.BlockNumber(), func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+		txns = append(txns, txn)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txns) != 2 || txns[1].Hash != hash || txns[1].To != strings.ToLower(caller.Hex()) {
+		t.Errorf("Traced transactions were %v", txns)
+	}
+}
+
+func TestDevchainSnapshots(t *testing.T) {
+	_, client, closeChain := newDevchain(t)
+	defer closeChain()
+
+	_, receipt := client.send(nil, initCode(storerCode))
+	storer := common.HexToAddress(receipt["contractAddress"].(string))
+
+	var id string
+	client.call(&id, "evm_snapshot")
+	var before hexutil.Uint64
+	client.call(&before, "eth_blockNumber")
+
+	client.send(&storer, "0x"+strings.Repeat("0", 63)+"7")
+	var reverted bool
+	client.call(&reverted, "evm_revert", id)
+	if !reverted {
+		t.Fatal("Didn't revert")
+	}
+
+	var after hexutil.Uint64
+	client.call(&after, "eth_blockNumber")
+	var stored hexutil.Bytes
+	client.call(&stored, "eth_getStorageAt", storer, "0x0", "latest")
+	if after != before || hexutil.Encode(stored) != "0x"+strings.Repeat("0", 64) {
+		t.Errorf("After reverting, at block %d slot 0 was %s", after, hexutil.Encode(stored))
+	}
+
+	// A snapshot can only be reverted to once.
+	client.call(&reverted, "evm_revert", id)
+	if reverted {
+		t.Error("Reverted to the same snapshot twice")
+	}
+}
+
+func TestDevchainConcurrentSends(t *testing.T) {
+	chain, err := devchain.New(devchain.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+
+	// Sends from one account, as tests using Promise.all do.
+	from, to := chain.Accounts()[0], chain.Accounts()[1]
+	var sends sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		sends.Add(1)
+		go func() {
+			defer sends.Done()
+			_, err := chain.Send(devchain.Message{From: from, To: &to})
+			errs <- err
+		}()
+	}
+	sends.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if nonce, _ := chain.Nonce(from); nonce != 10 {
+		t.Errorf("Nonce was %d after 10 sends", nonce)
+	}
+}
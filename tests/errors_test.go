@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/srcmap"
+)
+
+func TestValidateErrors(t *testing.T) {
+	cases := []struct {
+		execTrace parity.ExecTrace
+		err       error
+	}{
+		{parity.ExecTrace{}, parity.ErrTxNotFound},
+		{parity.ExecTrace{Output: "0x", VMTrace: parity.VMTrace{Code: "0x"}}, parity.ErrNoBytecode},
+		{parity.ExecTrace{Output: "0x", VMTrace: parity.VMTrace{Code: "0x00"}}, parity.ErrNoTraceSteps},
+		{parity.ExecTrace{Output: "0x", VMTrace: parity.VMTrace{Code: "0x00", Ops: []parity.Operation{{}}}}, nil},
+	}
+	for _, c := range cases {
+		if err := c.execTrace.Validate(); err != c.err {
+			t.Errorf("Validating %v gave %v, not %v", c.execTrace, err, c.err)
+		}
+	}
+}
+
+func TestStreamTracesErrors(t *testing.T) {
+	cases := []struct {
+		result string
+		err    error
+	}{
+		{`null`, parity.ErrTxNotFound},
+		{`{"output": "0x", "vmTrace": {"code": "0x", "ops": []}}`, parity.ErrNoBytecode},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "result": %s}`, c.result)
+		}))
+		fetcher := fetch.New(fetch.Config{URL: server.URL})
+		err := fetcher.StreamTraces(context.Background(), []string{"0xa1"}, parity.SkipAll, func(int, int, string, parity.Operation) error {
+			return nil
+		})
+		if !errors.Is(err, c.err) {
+			t.Errorf("Streaming a result of %s gave %v, not %v", c.result, err, c.err)
+		}
+		server.Close()
+	}
+}
+
+func TestSourceMapLocation(t *testing.T) {
+	sourceMap := []srclocation.SourceLocation{{ByteOffset: 1}, {ByteOffset: 2}}
+	// PUSH1 0x01, STOP
+	pcToOpIndex := evmbytecode.GetPcToOpIndex("0x600100")
+
+	location, err := srcmap.Location(sourceMap, pcToOpIndex, 2)
+	if err != nil || location.ByteOffset != 2 {
+		t.Errorf("Location of pc 2 was %v, %v", location, err)
+	}
+	if _, err := srcmap.Location(sourceMap, pcToOpIndex, 1); !errors.Is(err, srcmap.ErrSourceMapMismatch) {
+		t.Errorf("Location within PUSH data gave %v", err)
+	}
+	if _, err := srcmap.Location(sourceMap[:1], pcToOpIndex, 2); !errors.Is(err, srcmap.ErrSourceMapMismatch) {
+		t.Errorf("Location past the end of the source map gave %v", err)
+	}
+}
+
+func TestCompileFailed(t *testing.T) {
+	compiler := solc.Compiler{ContractsDir: t.TempDir(), Args: []string{"--no-such-option"}}
+	if _, err := compiler.CombinedJSON(context.Background(), "bin-runtime", []string{"Missing.sol"}); !errors.Is(err, solc.ErrCompileFailed) {
+		t.Errorf("Compiling gave %v", err)
+	}
+}
+
+func TestRemoveMetaDataOfMalformedBytecode(t *testing.T) {
+	for _, bytecode := range []string{
+		"",
+		"6001",
+		"0x" + "a165627a7a72305820" + "00",
+		"0x" + "a165627a7a72305820" + strings.Repeat("00", 32) + "0030",
+	} {
+		if removed := evmbytecode.RemoveMetaData(bytecode); removed != bytecode {
+			t.Errorf("Removing the metadata of %q gave %q", bytecode, removed)
+		}
+	}
+}
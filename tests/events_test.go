@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/events"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+var transferEvent = abi.Entry{
+	Type: "event",
+	Name: "Transfer",
+	Inputs: []abi.Param{
+		{Name: "from", Type: "address", Indexed: true},
+		{Name: "to", Type: "address", Indexed: true},
+		{Name: "value", Type: "uint256"},
+	},
+}
+
+var approvalEvent = abi.Entry{
+	Type: "event",
+	Name: "Approval",
+	Inputs: []abi.Param{
+		{Name: "owner", Type: "address", Indexed: true},
+		{Name: "spender", Type: "address", Indexed: true},
+		{Name: "value", Type: "uint256"},
+	},
+}
+
+func TestDecodeLog(t *testing.T) {
+	declared := abi.Events(map[string][]abi.Entry{"Token.sol:Token": {transferEvent}})
+	topics := [][]byte{
+		hexData(t, transferEvent.Topic()),
+		hexData(t, "000000000000000000000000000000000000000000000000000000000000abcd"),
+		hexData(t, "0000000000000000000000000000000000000000000000000000000000001234"),
+	}
+	data := hexData(t, "0000000000000000000000000000000000000000000000000000000000000064")
+
+	decoded := abi.DecodeLog(topics, data, declared)
+	expected := "Transfer(from=0x000000000000000000000000000000000000abcd, to=0x0000000000000000000000000000000000001234, value=100)"
+	if decoded != expected {
+		t.Errorf("Log was %s", decoded)
+	}
+}
+
+func TestEventCoverage(t *testing.T) {
+	declared := abi.Events(map[string][]abi.Entry{
+		"Token.sol:Token":   {transferEvent, approvalEvent},
+		"Token.sol:Wrapper": {transferEvent},
+	})
+	coverage := events.NewCoverage(declared)
+	coverage.Add([][]byte{hexData(t, transferEvent.Topic())})
+	coverage.Add([][]byte{hexData(t, transferEvent.Topic())})
+	coverage.Add(nil)
+
+	report := coverage.Report()
+	if len(report) != 2 {
+		t.Fatalf("Report was %v", report)
+	}
+	if report[0].Signature != "Approval(address,address,uint256)" || report[0].Emitted != 0 {
+		t.Errorf("First event was %v", report[0])
+	}
+	if report[1].Emitted != 2 || len(report[1].Contracts) != 2 {
+		t.Errorf("Second event was %v", report[1])
+	}
+}
+
+func TestTraceLogs(t *testing.T) {
+	frame := &trace.Frame{External: true}
+	step := func(index int, opCode string, ex parity.OperationEx) trace.Step {
+		return trace.Step{Index: index, OpCode: opCode, Frame: frame, Op: parity.Operation{Ex: ex}}
+	}
+	steps := []trace.Step{
+		step(0, "52", parity.OperationEx{Mem: &parity.MemoryWrite{
+			Off:  0,
+			Data: "0x0000000000000000000000000000000000000000000000000000000000000064",
+		}}),
+		step(1, "60", parity.OperationEx{Push: []string{"0xdd"}}),
+		step(2, "60", parity.OperationEx{Push: []string{"0x20"}}),
+		step(3, "60", parity.OperationEx{Push: []string{"0x0"}}),
+		step(4, "a1", parity.OperationEx{}),
+	}
+
+	logs := trace.Logs(steps)
+	if len(logs) != 1 {
+		t.Fatalf("Logs were %v", logs)
+	}
+	if logs[0].Step.Index != 4 || len(logs[0].Topics) != 1 || logs[0].Topics[0][31] != 0xdd {
+		t.Errorf("Log was %v", logs[0])
+	}
+	if len(logs[0].Data) != 32 || logs[0].Data[31] != 0x64 {
+		t.Errorf("Log data was %x", logs[0].Data)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reserve-protocol/solstice/fetch"
+	"github.com/reserve-protocol/solstice/geth"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+const contractAddress = "0x00000000000000000000000000000000000000c0"
+
+// A node that mines blocks with one call to a contract and one plain transfer
+// each, answers after latency, and fails the first failures requests with a
+// 503. It traces whole blocks the way tracer does, "parity" or "geth", or not
+// at all. calls counts the calls of each method.
+type fakeNode struct {
+	latency  time.Duration
+	failures int32
+	requests int32
+	tracer   string
+	lock     sync.Mutex
+	calls    map[string]int
+}
+
+func (node *fakeNode) count(method string) int {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	return node.calls[method]
+}
+
+func (node *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&node.requests, 1) <= node.failures {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	time.Sleep(node.latency)
+
+	var requests []struct {
+		ID     int
+		Method string
+		Params []json.RawMessage
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Requests that aren't in a batch get a response that isn't either.
+	single := bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+	if single {
+		body = append(append([]byte("["), body...), ']')
+	}
+	if err := json.Unmarshal(body, &requests); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var responses []map[string]interface{}
+	for _, request := range requests {
+		var firstParam interface{}
+		json.Unmarshal(request.Params[0], &firstParam)
+		node.lock.Lock()
+		if node.calls == nil {
+			node.calls = make(map[string]int)
+		}
+		node.calls[request.Method]++
+		node.lock.Unlock()
+
+		contractTrace := parity.ExecTrace{
+			Output:  "0x",
+			VMTrace: parity.VMTrace{Code: "0x6000", Ops: []parity.Operation{{Cost: 3}}},
+		}
+		var result interface{}
+		switch {
+		case request.Method == "trace_replayBlockTransactions" && node.tracer == "parity":
+			number := firstParam.(string)
+			result = []interface{}{
+				struct {
+					TransactionHash string `json:"transactionHash"`
+					parity.ExecTrace
+				}{"0xa" + number[2:], contractTrace},
+				map[string]interface{}{"transactionHash": "0xb" + number[2:], "output": "0x", "vmTrace": nil},
+			}
+		case request.Method == "debug_traceBlockByNumber" && node.tracer == "geth":
+			structLogs := []geth.StructLog{
+				{Op: "PUSH1", Gas: 100, GasCost: 3, Depth: 1},
+				{PC: 2, Op: "STOP", Gas: 97, Depth: 1, Stack: []string{"0x0"}},
+			}
+			// The contract in the third block creates another, whose init
+			// code is only in memory.
+			if firstParam == "0x3" {
+				structLogs = creatorLogs(nil)
+			}
+			result = []interface{}{
+				map[string]interface{}{"result": geth.Result{StructLogs: structLogs}},
+				map[string]interface{}{"result": geth.Result{StructLogs: []geth.StructLog{}}},
+			}
+		case request.Method == "debug_traceTransaction" && node.tracer == "geth":
+			result = geth.Result{StructLogs: creatorLogs([]string{strings.Repeat("0", 64)})}
+		case strings.HasPrefix(request.Method, "trace_replayBlock") || strings.HasPrefix(request.Method, "debug_"):
+			responses = append(responses, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      request.ID,
+				"error":   map[string]interface{}{"code": -32601, "message": "Method not found"},
+			})
+			continue
+		}
+		switch request.Method {
+		case "eth_getBlockByNumber":
+			number := firstParam.(string)
+			result = map[string]interface{}{
+				"transactions": []map[string]interface{}{
+					{"hash": "0xa" + number[2:], "to": contractAddress, "input": "0x12345678", "blockNumber": number},
+					{"hash": "0xb" + number[2:], "to": "0x00000000000000000000000000000000000000e0", "input": "0x", "blockNumber": number},
+				},
+			}
+		case "eth_getCode":
+			result = "0x"
+			if firstParam == contractAddress {
+				result = "0x6000"
+			}
+		case "eth_getTransactionReceipt":
+			result = map[string]interface{}{
+				"logs": []map[string]interface{}{{"topics": []string{"0x01"}, "data": "0x02"}},
+			}
+		case "trace_replayTransaction":
+			// Parity puts the code before the ops, which streaming relies on.
+			result = json.RawMessage(`{"output": "0x", "vmTrace": {"code": "0x6000", "ops": [{"cost": 3, "pc": 0, "ex": {"used": 0}}]}}`)
+		}
+		responses = append(responses, map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result})
+	}
+	if single {
+		json.NewEncoder(w).Encode(responses[0])
+		return
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+func TestFetchContractTransactions(t *testing.T) {
+	server := httptest.NewServer(&fakeNode{failures: 2})
+	defer server.Close()
+	fetcher := fetch.New(fetch.Config{URL: server.URL, BatchSize: 2, Retries: 3, Backoff: time.Millisecond})
+
+	ctx := context.Background()
+	txns, err := fetcher.ContractTransactions(ctx, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for i, txn := range txns {
+		hashes = append(hashes, txn.Hash)
+		if txn.To != contractAddress || txn.BlockNumber != uint64(i+1) || fmt.Sprintf("%x", txn.Input) != "12345678" {
+			t.Errorf("Transaction %d was %+v", i, txn)
+		}
+	}
+	if expected := []string{"0xa1", "0xa2", "0xa3"}; !reflect.DeepEqual(hashes, expected) {
+		t.Fatalf("Transactions were %v instead of %v", hashes, expected)
+	}
+
+	logs, err := fetcher.Logs(ctx, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 || len(logs[2]) != 1 || fmt.Sprintf("%x %x", logs[2][0].Topics, logs[2][0].Data) != "[01] 02" {
+		t.Errorf("Logs were %v", logs)
+	}
+
+	traced := make([]bool, len(hashes))
+	err = fetcher.Traces(ctx, hashes, func(index int, execTrace parity.ExecTrace) error {
+		traced[index] = true
+		if execTrace.GasUsed() != 3 {
+			t.Errorf("Trace %d used %d gas", index, execTrace.GasUsed())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(traced, []bool{true, true, true}) {
+		t.Errorf("Traced %v", traced)
+	}
+}
+
+func TestFetchGivesUpAfterRetries(t *testing.T) {
+	server := httptest.NewServer(&fakeNode{failures: 100})
+	defer server.Close()
+	fetcher := fetch.New(fetch.Config{URL: server.URL, Retries: 2, Backoff: time.Millisecond})
+
+	if _, err := fetcher.ContractTransactions(context.Background(), 1, 1); err == nil {
+		t.Error("Fetching from a failing node succeeded")
+	}
+}
+
+// The struct logs of a call that creates a contract from the first byte of
+// memory, whose init code, STOP, does nothing.
+func creatorLogs(memory []string) []geth.StructLog {
+	return []geth.StructLog{
+		{Op: "CREATE", Gas: 100, GasCost: 32000, Depth: 1, Stack: []string{"0x1", "0x0", "0x0"}, Memory: memory},
+		{Op: "STOP", Gas: 50, Depth: 2},
+		{PC: 1, Op: "STOP", Gas: 50, Depth: 1, Stack: []string{"0xc1"}},
+	}
+}
+
+func TestFetchBlockTraces(t *testing.T) {
+	for _, tracer := range []string{"parity", "geth", ""} {
+		node := &fakeNode{tracer: tracer}
+		server := httptest.NewServer(node)
+		fetcher := fetch.New(fetch.Config{URL: server.URL, BatchSize: 2})
+
+		var hashes []string
+		err := fetcher.BlockTraces(context.Background(), 1, 3, func(txn fetch.Transaction, execTrace parity.ExecTrace) error {
+			hashes = append(hashes, txn.Hash)
+			if execTrace.Code != "0x6000" || len(execTrace.Ops) == 0 {
+				t.Errorf("The %q trace of %s was %+v", tracer, txn.Hash, execTrace)
+			}
+			if tracer == "geth" && txn.Hash == "0xa3" && len(execTrace.Ops) != 0 && (execTrace.Ops[0].Sub == nil || execTrace.Ops[0].Sub.Code != "0x00") {
+				t.Errorf("The init code run by %s was %+v", txn.Hash, execTrace.Ops[0].Sub)
+			}
+			return nil
+		})
+		server.Close()
+		if err != nil {
+			t.Errorf("Tracing blocks with %q failed: %v", tracer, err)
+			continue
+		}
+
+		sort.Strings(hashes)
+		if expected := []string{"0xa1", "0xa2", "0xa3"}; !reflect.DeepEqual(hashes, expected) {
+			t.Errorf("Traced %v with %q instead of %v", hashes, tracer, expected)
+		}
+		if tracer == "parity" && (node.count("eth_getCode") != 0 || node.count("trace_replayTransaction") != 0) {
+			t.Errorf("Block tracing still traced transactions one at a time: %v", node.calls)
+		}
+		if tracer == "geth" && node.count("debug_traceTransaction") != 1 {
+			t.Errorf("Only the transaction that created a contract should be traced again: %v", node.calls)
+		}
+	}
+}
+
+func TestGethBlockTracesKeepCachedTraces(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cache := tracecache.Open(dir, "1337")
+	full := `{"output":"0x","vmTrace":{"code":"0x6000","ops":[{"pc":0,"cost":3,"ex":{"mem":{"off":0,"data":"0x2a"}}}]}}`
+	if err := cache.Put("0xa1", json.RawMessage(full)); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(&fakeNode{tracer: "geth"})
+	defer server.Close()
+	fetcher := fetch.New(fetch.Config{URL: server.URL, Cache: cache})
+	err := fetcher.BlockTraces(context.Background(), 1, 3, func(fetch.Transaction, parity.ExecTrace) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := cache.Get("0xa1", []string{"vmTrace"})
+	if err != nil || !strings.Contains(string(cached), `"data":"0x2a"`) {
+		t.Errorf("A trace without memory replaced the cached one: %s %v", cached, err)
+	}
+	if _, err := cache.Get("0xa2", []string{"vmTrace"}); err == nil {
+		t.Error("A trace without memory was cached")
+	}
+	if _, err := cache.Get("0xa3", []string{"vmTrace"}); err != nil {
+		t.Errorf("The trace with memory wasn't cached: %v", err)
+	}
+}
+
+func TestStructLogsToVMTrace(t *testing.T) {
+	// PUSH1 0x2a PUSH1 0 MSTORE PUSH1 7 PUSH1 1 SSTORE, then a call into a
+	// contract that stops right away.
+	result := geth.Result{ReturnValue: "", StructLogs: []geth.StructLog{
+		{PC: 0, Op: "PUSH1", Gas: 100, GasCost: 3, Depth: 1},
+		{PC: 2, Op: "PUSH1", Gas: 97, GasCost: 3, Depth: 1, Stack: []string{"0x2a"}},
+		{PC: 4, Op: "MSTORE", Gas: 94, GasCost: 6, Depth: 1, Stack: []string{"0x2a", "0x0"}},
+		{PC: 5, Op: "PUSH1", Gas: 88, GasCost: 3, Depth: 1, Memory: []string{strings.Repeat("0", 62) + "2a"}},
+		{PC: 7, Op: "DUP1", Gas: 85, GasCost: 3, Depth: 1, Stack: []string{"0x7"}},
+		{PC: 8, Op: "SSTORE", Gas: 82, GasCost: 20, Depth: 1, Stack: []string{"0x7", "0x7"}},
+		{PC: 9, Op: "CALL", Gas: 62, GasCost: 40, Depth: 1, Stack: []string{"0x0", "0x0", "0x0", "0x0", "0x0", "0xc0", "0x10"}},
+		{PC: 0, Op: "STOP", Gas: 10, GasCost: 0, Depth: 2},
+		{PC: 10, Op: "STOP", Gas: 30, GasCost: 0, Depth: 1, Stack: []string{"0x1"}},
+	}}
+	var calledAddress string
+	execTrace, err := result.ExecTrace("0x6000", func(address string) (string, error) {
+		calledAddress = address
+		return "0x00", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := execTrace.Ops
+	if len(ops) != 8 || execTrace.Output != "0x" {
+		t.Fatalf("Trace was %+v", execTrace)
+	}
+	if !reflect.DeepEqual(ops[0].Ex.Push, []string{"0x2a"}) || ops[0].Ex.Used != 97 {
+		t.Errorf("PUSH1 was %+v", ops[0].Ex)
+	}
+	if write := ops[2].Ex.Mem; write == nil || write.Off != 0 || write.Data != "0x"+strings.Repeat("0", 62)+"2a" {
+		t.Errorf("MSTORE wrote %+v", write)
+	}
+	if !reflect.DeepEqual(ops[4].Ex.Push, []string{"0x7", "0x7"}) {
+		t.Errorf("DUP1 pushed %v", ops[4].Ex.Push)
+	}
+	if store := ops[5].Ex.Store; store == nil || store.Key != "0x7" || store.Val != "0x7" {
+		t.Errorf("SSTORE stored %+v", store)
+	}
+	if calledAddress != "0x00000000000000000000000000000000000000c0" {
+		t.Errorf("Looked up the code of %s", calledAddress)
+	}
+	if sub := ops[6].Sub; sub == nil || sub.Code != "0x00" || len(sub.Ops) != 1 {
+		t.Errorf("The call's trace was %+v", sub)
+	}
+	if !reflect.DeepEqual(ops[6].Ex.Push, []string{"0x1"}) || ops[6].Ex.Used != 30 {
+		t.Errorf("CALL was %+v", ops[6].Ex)
+	}
+}
+
+func TestStreamTraces(t *testing.T) {
+	server := httptest.NewServer(&fakeNode{failures: 1})
+	defer server.Close()
+	fetcher := fetch.New(fetch.Config{URL: server.URL, Retries: 1, Backoff: time.Millisecond})
+
+	hashes := []string{"0xa1", "0xa2"}
+	visited := make(map[int]int)
+	err := fetcher.StreamTraces(context.Background(), hashes, parity.SkipAll, func(index int, depth int, code string, op parity.Operation) error {
+		visited[index] += op.Cost
+		if code != "0x6000" || depth != 0 {
+			t.Errorf("Op %+v of %s ran %s at depth %d", op, hashes[index], code, depth)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(visited, map[int]int{0: 3, 1: 3}) {
+		t.Errorf("Visited ops costing %v", visited)
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cache := tracecache.Open(dir, "1337")
+	hashes := []string{"0xa1", "0xa2"}
+
+	server := httptest.NewServer(&fakeNode{tracer: "parity"})
+	online := fetch.New(fetch.Config{URL: server.URL, Cache: cache})
+	err := online.BlockTraces(context.Background(), 1, 1, func(fetch.Transaction, parity.ExecTrace) error { return nil })
+	if err == nil {
+		err = online.StreamTraces(context.Background(), hashes[1:], parity.SkipAll, func(int, int, string, parity.Operation) error { return nil })
+	}
+	server.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With the node gone, the traces can only come from the cache.
+	offline := fetch.New(fetch.Config{URL: server.URL, Cache: cache, Offline: true})
+	var traced []string
+	err = offline.Traces(context.Background(), hashes, func(index int, execTrace parity.ExecTrace) error {
+		traced = append(traced, hashes[index]+" "+execTrace.Code)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"0xa1 0x6000", "0xa2 0x6000"}; !reflect.DeepEqual(traced, expected) {
+		t.Errorf("Traced %v instead of %v", traced, expected)
+	}
+
+	ops := 0
+	err = offline.StreamTraces(context.Background(), hashes, parity.SkipAll, func(int, int, string, parity.Operation) error {
+		ops++
+		return nil
+	})
+	if err != nil || ops != 2 {
+		t.Errorf("Streamed %d cached ops: %v", ops, err)
+	}
+	if _, err := offline.ContractTransactions(context.Background(), 1, 1); err == nil {
+		t.Error("Fetched blocks offline")
+	}
+}
+
+func benchmarkTraces(b *testing.B, config fetch.Config) {
+	server := httptest.NewServer(&fakeNode{latency: 2 * time.Millisecond})
+	defer server.Close()
+	config.URL = server.URL
+	fetcher := fetch.New(config)
+
+	hashes := make([]string, 200)
+	for i := range hashes {
+		hashes[i] = fmt.Sprintf("0x%x", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := fetcher.Traces(context.Background(), hashes, func(int, parity.ExecTrace) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTracesOneAtATime(b *testing.B) {
+	benchmarkTraces(b, fetch.Config{Concurrency: 1, BatchSize: 1})
+}
+
+func BenchmarkTracesBatchedInParallel(b *testing.B) {
+	benchmarkTraces(b, fetch.Config{Concurrency: 8, BatchSize: 20})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/reserve-protocol/solstice/abi"
+	"github.com/reserve-protocol/solstice/gas"
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+func TestSelector(t *testing.T) {
+	entry := abi.Entry{
+		Type: "function",
+		Name: "transfer",
+		Inputs: []abi.Param{
+			{Name: "to", Type: "address"},
+			{Name: "value", Type: "uint256"},
+		},
+	}
+
+	if entry.Signature() != "transfer(address,uint256)" {
+		t.Errorf("Signature was %s", entry.Signature())
+	}
+	if entry.Selector() != "a9059cbb" {
+		t.Errorf("Selector was %s", entry.Selector())
+	}
+}
+
+func TestTupleSignature(t *testing.T) {
+	entry := abi.Entry{
+		Type: "function",
+		Name: "submit",
+		Inputs: []abi.Param{
+			{Type: "tuple[]", Components: []abi.Param{{Type: "uint256"}, {Type: "bytes"}}},
+			{Type: "bool"},
+		},
+	}
+
+	if entry.Signature() != "submit((uint256,bytes)[],bool)" {
+		t.Errorf("Signature was %s", entry.Signature())
+	}
+}
+
+func TestParseStringEncodedABI(t *testing.T) {
+	entries, err := abi.Parse([]byte(`"[{\"type\":\"function\",\"name\":\"f\",\"inputs\":[]}]"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Signature() != "f()" {
+		t.Errorf("Entries were %v", entries)
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	entries := []abi.Entry{{Type: "function", Name: "transfer", Inputs: []abi.Param{{Type: "address"}, {Type: "uint256"}}}}
+
+	if name := abi.FunctionName(entries, []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00}); name != "transfer(address,uint256)" {
+		t.Errorf("Name was %s", name)
+	}
+	if name := abi.FunctionName(entries, []byte{0x12, 0x34, 0x56, 0x78}); name != "0x12345678" {
+		t.Errorf("Name was %s", name)
+	}
+	if name := abi.FunctionName(entries, nil); name != "fallback" {
+		t.Errorf("Name was %s", name)
+	}
+}
+
+func TestGasReportStats(t *testing.T) {
+	collector := gas.NewCollector()
+	for _, gasUsed := range []int{40, 10, 30, 20} {
+		collector.Add("Token.sol:Token", "transfer(address,uint256)", gasUsed)
+	}
+	collector.Add("Token.sol:Token", "approve(address,uint256)", 7)
+
+	report, err := collector.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gas.FunctionStats{
+		{Contract: "Token.sol:Token", Signature: "approve(address,uint256)", Calls: 1, Min: 7, Max: 7, Average: 7, Median: 7},
+		{Contract: "Token.sol:Token", Signature: "transfer(address,uint256)", Calls: 4, Min: 10, Max: 40, Average: 25, Median: 25},
+	}
+
+	if len(report.Functions) != len(want) {
+		t.Fatalf("Report was %v", report)
+	}
+	for i := range want {
+		if report.Functions[i] != want[i] {
+			t.Errorf("Stats differed at index %d\nGot  %v\nWant %v", i, report.Functions[i], want[i])
+		}
+	}
+}
+
+func TestGasReportLines(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "Token.sol")
+	if err := ioutil.WriteFile(file, []byte("contract Token {\n    uint x;\n    function f() { x = 1; }\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := gas.NewCollector()
+	collector.AddLocation(srclocation.SourceLocation{SourceFileName: file, ByteOffset: 0, ByteLength: 50}, 100)
+	collector.AddLocation(srclocation.SourceLocation{SourceFileName: file, ByteOffset: 32, ByteLength: 23}, 20)
+	collector.AddLocation(srclocation.SourceLocation{SourceFileName: file, ByteOffset: 47, ByteLength: 5, JumpType: 'i'}, 5)
+
+	report, err := collector.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gas.LineStats{{File: file, Line: 1, Gas: 100}, {File: file, Line: 3, Gas: 25}}
+	if diff := cmp.Diff(want, report.Lines); diff != "" {
+		t.Errorf("Lines differed (-want +got):\n%s", diff)
+	}
+}
+
+func TestGasComparison(t *testing.T) {
+	base := gas.Report{
+		Functions: []gas.FunctionStats{
+			{Contract: "Token.sol:Token", Signature: "transfer(address,uint256)", Average: 100},
+			{Contract: "Token.sol:Token", Signature: "approve(address,uint256)", Average: 100},
+			{Contract: "Token.sol:Token", Signature: "burn(uint256)", Average: 100},
+		},
+		Lines: []gas.LineStats{{File: "Token.sol", Line: 12, Gas: 1000}},
+	}
+	head := gas.Report{
+		Functions: []gas.FunctionStats{
+			{Contract: "Token.sol:Token", Signature: "transfer(address,uint256)", Average: 120},
+			{Contract: "Token.sol:Token", Signature: "approve(address,uint256)", Average: 104},
+			{Contract: "Token.sol:Token", Signature: "mint(uint256)", Average: 100},
+		},
+		Lines: []gas.LineStats{{File: "Token.sol", Line: 12, Gas: 1000}},
+	}
+
+	comparison := gas.Compare(base, head, 5)
+	want := []gas.Change{
+		{Name: "Token.sol:Token transfer(address,uint256)", Base: 100, Head: 120, Regression: true},
+		{Name: "Token.sol:Token approve(address,uint256)", Base: 100, Head: 104},
+		{Name: "Token.sol:Token mint(uint256)", Head: 100},
+		{Name: "Token.sol:Token burn(uint256)", Base: 100},
+	}
+
+	if !cmp.Equal(comparison.Functions, want) {
+		t.Errorf("Function changes were %v", comparison.Functions)
+	}
+	if len(comparison.Lines) != 0 {
+		t.Errorf("Line changes were %v", comparison.Lines)
+	}
+	if comparison.Regressions() != 1 {
+		t.Errorf("Regressions were %d", comparison.Regressions())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/gitdiff"
+	"github.com/reserve-protocol/solstice/testcov"
+)
+
+const tokenDiff = `diff --git a/contracts/Token.sol b/contracts/Token.sol
+index 3b18e51..a9c2d4f 100644
+--- a/contracts/Token.sol
++++ b/contracts/Token.sol
+@@ -12 +12 @@ contract Token {
+-        balances[to] += amount;
++        balances[to] += amount + 1;
+@@ -20,0 +21,2 @@ contract Token {
++        emit Burned(amount);
++        return;
+diff --git a/contracts/Vault.sol b/contracts/Vault.sol
+new file mode 100644
+--- /dev/null
++++ b/contracts/Vault.sol
+@@ -0,0 +1,3 @@
++contract Vault {
++}
++
+`
+
+func TestParseDiff(t *testing.T) {
+	files := gitdiff.Parse(tokenDiff, "/repo")
+	expected := []gitdiff.FileDiff{
+		{
+			OldName: "/repo/contracts/Token.sol",
+			NewName: "/repo/contracts/Token.sol",
+			Hunks: []gitdiff.Hunk{
+				{OldStart: 12, OldLines: 1, NewStart: 12, NewLines: 1},
+				{OldStart: 20, OldLines: 0, NewStart: 21, NewLines: 2},
+			},
+		},
+		{
+			NewName: "/repo/contracts/Vault.sol",
+			Hunks:   []gitdiff.Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 3}},
+		},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Diff was %+v", files)
+	}
+}
+
+func TestAffectedTests(t *testing.T) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverage := testcov.Coverage{
+		"mints":     {"contracts/Token.sol": {5, 12, 13}},
+		"burns":     {"contracts/Token.sol": {19}},
+		"burns all": {"contracts/Token.sol": {21, 22}},
+		"transfers": {"contracts/Other.sol": {12}},
+	}
+
+	files := gitdiff.Parse(tokenDiff, workingDir)
+	tests := coverage.Affected(files)
+	if !reflect.DeepEqual(tests, []string{"burns all", "mints"}) {
+		t.Errorf("Affected tests were %v", tests)
+	}
+}
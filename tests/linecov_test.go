@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/gitdiff"
+	"github.com/reserve-protocol/solstice/linecov"
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+func TestDiffCoverage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "A.sol")
+	source := "contract A {\n  // Adds one.\n  function f() {\n    x += 1;\n    y += 1;\n  }\n}\n"
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lineStart := func(line int) srclocation.SourceLocation {
+		offsets := []int{0, 13, 29, 46, 58}
+		return srclocation.SourceLocation{SourceFileName: filename, ByteOffset: offsets[line-1], ByteLength: 1}
+	}
+
+	collector := linecov.NewCollector()
+	for _, line := range []int{1, 3, 4, 5} {
+		if err := collector.AddExecutable(lineStart(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range []int{3, 4} {
+		if err := collector.AddHit(lineStart(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Lines 2 to 5 changed, but 2 is a comment.
+	files := []gitdiff.FileDiff{{
+		OldName: filename,
+		NewName: filename,
+		Hunks:   []gitdiff.Hunk{{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 4}},
+	}}
+	diff, err := collector.Coverage().Diff(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Lines) != 3 || diff.Percent() < 66 || diff.Percent() > 67 {
+		t.Errorf("Diff coverage was %+v", diff)
+	}
+	expected := []linecov.ChangedLine{{File: filename, Line: 5, Source: "y += 1;"}}
+	if uncovered := diff.Uncovered(); !reflect.DeepEqual(uncovered, expected) {
+		t.Errorf("Uncovered lines were %+v", uncovered)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/mutation"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+const mutatedSource = `contract A {
+    function f(uint x) public onlyOwner returns (uint) {
+        require(x < 10);
+        return x + 0;
+    }
+}
+`
+
+func TestGenerateMutants(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "A.sol")
+	if err := ioutil.WriteFile(filename, []byte(mutatedSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	node := func(nodeType string, text string, attributes solc.JSONASTAttributes, children ...*ast.AST) *ast.AST {
+		return &ast.AST{
+			NodeType: nodeType,
+			SrcLoc: srclocation.SourceLocation{
+				SourceFileName: filename,
+				ByteOffset:     strings.Index(mutatedSource, text),
+				ByteLength:     len(text),
+			},
+			Attributes: attributes,
+			Children:   children,
+		}
+	}
+	tree := node("SourceUnit", mutatedSource, solc.JSONASTAttributes{},
+		node("ModifierInvocation", "onlyOwner", solc.JSONASTAttributes{}),
+		node("FunctionCall", "require(x < 10)", solc.JSONASTAttributes{},
+			node("Identifier", "require", solc.JSONASTAttributes{Value: "require"}),
+			node("BinaryOperation", "x < 10", solc.JSONASTAttributes{Operator: "<"},
+				node("Identifier", "x", solc.JSONASTAttributes{Value: "x"}),
+				node("Literal", "10", solc.JSONASTAttributes{Token: "number", Value: "10"}),
+			),
+		),
+		node("BinaryOperation", "x + 0", solc.JSONASTAttributes{Operator: "+"},
+			node("Identifier", "x", solc.JSONASTAttributes{Value: "x"}),
+			node("Literal", "0;", solc.JSONASTAttributes{Token: "number", Value: "0"}),
+		),
+	)
+	// The literal was found with the semicolon to tell it apart.
+	tree.Children[2].Children[1].SrcLoc.ByteLength = 1
+
+	mutants, err := mutation.Generate(map[string]ast.AST{filename: *tree})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var descriptions []string
+	for _, mutant := range mutants {
+		descriptions = append(descriptions, mutant.Description)
+	}
+	expected := "removed modifier onlyOwner, removed require, replaced < with >=, changed 10 to 0, replaced + with -, changed 0 to 1"
+	if strings.Join(descriptions, ", ") != expected {
+		t.Fatalf("Mutants were %s", strings.Join(descriptions, ", "))
+	}
+
+	if mutants[0].Line != 2 {
+		t.Errorf("Modifier was on line %d", mutants[0].Line)
+	}
+	mutated := string(mutants[4].Apply([]byte(mutatedSource)))
+	if !strings.Contains(mutated, "return x - 0;") {
+		t.Errorf("Mutated source was:\n%s", mutated)
+	}
+}
+
+func TestMutationScore(t *testing.T) {
+	results := []mutation.Result{
+		{Status: mutation.Killed},
+		{Status: mutation.Killed},
+		{Status: mutation.Survived},
+		{Status: mutation.NotCovered},
+		{Status: mutation.Stillborn},
+	}
+	if score := mutation.Score(results); score != 50 {
+		t.Errorf("Score was %f", score)
+	}
+
+	page, err := mutation.HTMLReport(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "<b>50.0%</b>") {
+		t.Errorf("Report was:\n%s", page)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/chain"
+	"github.com/reserve-protocol/solstice/coverage"
+	"github.com/reserve-protocol/solstice/devchain"
+	"github.com/reserve-protocol/solstice/setup"
+	"github.com/reserve-protocol/solstice/solc"
+)
+
+func TestDetectFoundry(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"foundry.toml":   "[profile.default]\n",
+		"remappings.txt": "ds-test/=lib/ds-test/src/\n\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	detection, err := setup.Detect(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.Framework == nil || detection.Framework.Name != "foundry" {
+		t.Fatalf("Detected %v", detection.Framework)
+	}
+	remapping := "ds-test/=" + filepath.Join(dir, "lib/ds-test/src") + "/"
+	if len(detection.Remappings) != 1 || detection.Remappings[0] != remapping {
+		t.Errorf("Read the remappings %v", detection.Remappings)
+	}
+
+	detection.NodeURL = ""
+	config := detection.Config()
+	if config.ContractsDir != filepath.Join(dir, "src") || config.Backend != "embedded" || config.SolcArgs[0] != remapping {
+		t.Errorf("Suggested %+v", config)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	config := setup.Config{ContractsDir: "/contracts", CoverageReportDir: "/coverage", TestCommand: []string{"npm", "test"}}
+	if err := config.Write(path, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Write(path, false); !os.IsExist(err) {
+		t.Errorf("Writing over the config gave %v", err)
+	}
+	if err := config.Write(path, true); err != nil {
+		t.Errorf("Overwriting the config gave %v", err)
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "contracts_dir: /contracts\ncoverage_report_dir: /coverage\ntest_command:\n- npm\n- test\n"
+	if string(written) != expected {
+		t.Errorf("Wrote\n%s", written)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	embedded, err := devchain.New(devchain.Config{Accounts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer embedded.Close()
+	server, err := devchain.NewServer(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Listen(freeAddress(t)); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	zeroHash := "0x0000000000000000000000000000000000000000000000000000000000000000"
+	if supported, err := chain.Supports(ctx, server.URL(), "trace_replayTransaction", zeroHash, []string{"vmTrace"}); !supported || err != nil {
+		t.Errorf("trace_replayTransaction is supported: %v, %v", supported, err)
+	}
+	if supported, err := chain.Supports(ctx, server.URL(), "debug_traceTransaction", zeroHash); supported || err != nil {
+		t.Errorf("debug_traceTransaction is supported: %v, %v", supported, err)
+	}
+	if _, err := chain.Supports(ctx, "http://"+freeAddress(t), "eth_blockNumber"); err == nil {
+		t.Error("Asking a node that isn't running succeeded")
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	results := setup.Doctor(context.Background(), coverage.Config{
+		Compiler:        solc.Compiler{ContractsDir: filepath.Join(t.TempDir(), "missing")},
+		Backend:         "embedded",
+		EmbeddedAddress: freeAddress(t),
+	}, "")
+
+	expected := []setup.Status{setup.Failed, setup.Skipped, setup.Passed, setup.Skipped}
+	if len(results) != len(expected) {
+		t.Fatalf("Got %v", results)
+	}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			t.Errorf("%s: %s, not %s (%s)", result.Check, result.Status, expected[i], result.Detail)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/reserve-protocol/solstice/calltree"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/storage"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+var tokenLayout = storage.Layout{
+	Storage: []storage.Variable{
+		{Label: "totalSupply", Slot: "0", Type: "t_uint256"},
+		{Label: "paused", Slot: "1", Type: "t_bool"},
+		{Label: "owner", Slot: "1", Offset: 1, Type: "t_address"},
+		{Label: "balances", Slot: "2", Type: "t_mapping(t_address,t_uint256)"},
+	},
+	Types: map[string]storage.Type{
+		"t_uint256": {Encoding: "inplace", Label: "uint256", NumberOfBytes: "32"},
+		"t_bool":    {Encoding: "inplace", Label: "bool", NumberOfBytes: "1"},
+		"t_address": {Encoding: "inplace", Label: "address", NumberOfBytes: "20"},
+		"t_mapping(t_address,t_uint256)": {
+			Encoding:      "mapping",
+			Label:         "mapping(address => uint256)",
+			NumberOfBytes: "32",
+			Key:           "t_address",
+			Value:         "t_uint256",
+		},
+	},
+}
+
+func TestDecodeSimpleSlot(t *testing.T) {
+	changes := tokenLayout.DecodeSlot("0x0", "0x0", "0x64", nil)
+	if len(changes) != 1 || changes[0] != (storage.Change{Path: "totalSupply", From: "0", To: "100"}) {
+		t.Errorf("Changes were %v", changes)
+	}
+}
+
+func TestDecodePackedSlot(t *testing.T) {
+	to := "0x" + "0000000000000000000000" + "00000000000000000000000000000000000000ab" + "01"
+	changes := tokenLayout.DecodeSlot("0x1", "0x0", to, nil)
+
+	expected := []storage.Change{
+		{Path: "paused", From: "false", To: "true"},
+		{Path: "owner", From: "0x0000000000000000000000000000000000000000", To: "0x00000000000000000000000000000000000000ab"},
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("Changes were %v", changes)
+	}
+}
+
+func TestDecodeMappingSlot(t *testing.T) {
+	preimage := hexData(t,
+		"00000000000000000000000000000000000000000000000000000000000000ab",
+		"0000000000000000000000000000000000000000000000000000000000000002",
+	)
+	slot := fmt.Sprintf("0x%x", crypto.Keccak256(preimage))
+	preimages := storage.Preimages{slot[2:]: preimage}
+
+	changes := tokenLayout.DecodeSlot(slot, "0x64", "0x28", preimages)
+	expected := storage.Change{
+		Path: "balances[0x00000000000000000000000000000000000000ab]",
+		From: "100",
+		To:   "40",
+	}
+	if len(changes) != 1 || changes[0] != expected {
+		t.Errorf("Changes were %v", changes)
+	}
+}
+
+func TestDecodeUnknownSlot(t *testing.T) {
+	changes := tokenLayout.DecodeSlot("0x7", "0x0", "0x1", nil)
+	if len(changes) != 1 || changes[0].Path != "slot 0x7" {
+		t.Errorf("Changes were %v", changes)
+	}
+}
+
+func TestGetPreimages(t *testing.T) {
+	preimage := hexData(t,
+		"00000000000000000000000000000000000000000000000000000000000000ab",
+		"0000000000000000000000000000000000000000000000000000000000000002",
+	)
+	hash := fmt.Sprintf("%x", crypto.Keccak256(preimage))
+	frame := &trace.Frame{External: true, Contract: "Token.sol:Token"}
+	steps := []trace.Step{
+		{OpCode: "52", Frame: frame, Op: parity.Operation{Ex: parity.OperationEx{Mem: &parity.MemoryWrite{Data: fmt.Sprintf("0x%x", preimage)}}}},
+		{OpCode: "60", Frame: frame, Op: parity.Operation{Ex: parity.OperationEx{Push: []string{"0x40"}}}},
+		{OpCode: "60", Frame: frame, Op: parity.Operation{Ex: parity.OperationEx{Push: []string{"0x0"}}}},
+		{OpCode: "20", Frame: frame, Op: parity.Operation{Ex: parity.OperationEx{Push: []string{"0x" + hash}}}},
+	}
+
+	preimages := storage.GetPreimages(steps)
+	if len(preimages) != 1 || fmt.Sprintf("%x", preimages[hash]) != fmt.Sprintf("%x", preimage) {
+		t.Errorf("Preimages were %x", preimages)
+	}
+}
+
+func TestAccountsBehindProxy(t *testing.T) {
+	root := &calltree.Call{
+		Type:     "CALL",
+		Contract: "Proxy.sol:Proxy",
+		Address:  "0x00000000000000000000000000000000000000AA",
+		Calls: []*calltree.Call{
+			{Type: "DELEGATECALL", Contract: "Token.sol:Token", Address: "0x00000000000000000000000000000000000000bb"},
+			{Type: "DELEGATECALL", Contract: "Math.sol:Math", Address: "0x00000000000000000000000000000000000000cc"},
+			{Type: "STATICCALL", Contract: "Oracle.sol:Oracle", Address: "0x00000000000000000000000000000000000000dd"},
+		},
+	}
+	layouts := map[string]storage.Layout{"Token.sol:Token": tokenLayout}
+
+	accounts := storage.Accounts(root, layouts)
+	expected := map[string]string{
+		"0x00000000000000000000000000000000000000aa": "Token.sol:Token",
+		"0x00000000000000000000000000000000000000dd": "Oracle.sol:Oracle",
+	}
+	if fmt.Sprint(accounts) != fmt.Sprint(expected) {
+		t.Errorf("Accounts were %v", accounts)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+const streamedTrace = `{
+	"code": "0x6001",
+	"ops": [
+		{"cost": 3, "ex": {"mem": null, "push": ["0x1"], "store": null, "used": 97}, "pc": 0, "sub": null},
+		{
+			"cost": 700,
+			"ex": {"mem": {"off": 0, "data": "0x2a"}, "push": ["0x1"], "store": null, "used": 90},
+			"pc": 2,
+			"sub": {
+				"code": "0x00",
+				"ops": [{"cost": 0, "ex": {"mem": null, "push": [], "store": {"key": "0x1", "val": "0x2"}, "used": 50}, "pc": 0, "sub": null}]
+			}
+		}
+	]
+}`
+
+type visitedOp struct {
+	depth int
+	code  string
+	op    parity.Operation
+}
+
+func streamOps(t *testing.T, skip parity.Skip) []visitedOp {
+	var visited []visitedOp
+	code, err := parity.StreamVMTrace(json.NewDecoder(strings.NewReader(streamedTrace)), skip, func(depth int, code string, op parity.Operation) error {
+		visited = append(visited, visitedOp{depth, code, op})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "0x6001" {
+		t.Errorf("Code was %s", code)
+	}
+	return visited
+}
+
+func TestStreamVMTrace(t *testing.T) {
+	var decoded parity.VMTrace
+	if err := json.Unmarshal([]byte(streamedTrace), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// The call's op comes after the ops of the call.
+	sub := decoded.Ops[1].Sub
+	call := decoded.Ops[1]
+	call.Sub = nil
+	expected := []visitedOp{
+		{0, "0x6001", decoded.Ops[0]},
+		{1, "0x00", sub.Ops[0]},
+		{0, "0x6001", call},
+	}
+	if visited := streamOps(t, parity.Skip{}); !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Visited %+v instead of %+v", visited, expected)
+	}
+}
+
+func TestStreamVMTraceSkipsFields(t *testing.T) {
+	visited := streamOps(t, parity.SkipAll)
+	expected := []visitedOp{
+		{0, "0x6001", parity.Operation{Cost: 3, PC: 0, Ex: parity.OperationEx{Used: 97}}},
+		{0, "0x6001", parity.Operation{Cost: 700, PC: 2, Ex: parity.OperationEx{Used: 90}}},
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Visited %+v instead of %+v", visited, expected)
+	}
+}
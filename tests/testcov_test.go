@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/testcov"
+)
+
+func TestHookRanges(t *testing.T) {
+	block := uint64(10)
+	hook := testcov.NewHook(func() (uint64, error) { return block, nil })
+	call := func(path string) int {
+		recorder := httptest.NewRecorder()
+		hook.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, nil))
+		return recorder.Code
+	}
+
+	call("/start?name=mints")
+	block = 12
+	call("/end?name=mints")
+	call("/start?name=burns")
+	if code := call("/end?name=transfers"); code != http.StatusBadRequest {
+		t.Errorf("Ending a test that never started returned %d", code)
+	}
+
+	ranges := hook.Ranges(15)
+	if test := testcov.TestAt(ranges, 11); test != "mints" {
+		t.Errorf("Block 11 was in %q", test)
+	}
+	if test := testcov.TestAt(ranges, 13); test != "burns" {
+		t.Errorf("Block 13 was in %q", test)
+	}
+	if test := testcov.TestAt(ranges, 10); test != "" {
+		t.Errorf("Block 10 was in %q", test)
+	}
+}
+
+func TestCoverageByTest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "A.sol")
+	if err := ioutil.WriteFile(filename, []byte("line one\nline two\nline three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	location := func(offset int) srclocation.SourceLocation {
+		return srclocation.SourceLocation{SourceFileName: filename, ByteOffset: offset, ByteLength: 1}
+	}
+
+	collector := testcov.NewCollector()
+	for _, add := range []struct {
+		test   string
+		offset int
+	}{{"mints", 0}, {"mints", 10}, {"burns", 20}, {"transfers", 20}, {"transfers", 1}} {
+		if err := collector.Add(add.test, location(add.offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collector.AddTest("approves")
+	coverage := collector.Coverage()
+
+	if lines := coverage["mints"][filename]; !reflect.DeepEqual(lines, []int{1, 2}) {
+		t.Errorf("Lines covered by mints were %v", lines)
+	}
+	if tests := coverage.TestsCovering(filename, 1); !reflect.DeepEqual(tests, []string{"mints", "transfers"}) {
+		t.Errorf("Tests covering line 1 were %v", tests)
+	}
+	if tests := coverage.WithoutUniqueLines(); !reflect.DeepEqual(tests, []string{"approves", "burns", "transfers"}) {
+		t.Errorf("Tests without unique lines were %v", tests)
+	}
+}
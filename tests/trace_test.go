@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+// JUMPDEST, JUMP, JUMPDEST, JUMP, REVERT
+const jumpingCode = "0x5b565b56fd"
+
+var jumpingSourceMap = []srclocation.SourceLocation{
+	{ByteOffset: 0, ByteLength: 100, SourceFileName: "A.sol"},
+	{ByteOffset: 10, ByteLength: 5, SourceFileName: "A.sol", JumpType: 'i'},
+	{ByteOffset: 50, ByteLength: 20, SourceFileName: "A.sol"},
+	{ByteOffset: 60, ByteLength: 5, SourceFileName: "A.sol", JumpType: 'o'},
+	{ByteOffset: 20, ByteLength: 5, SourceFileName: "A.sol"},
+}
+
+func TestFlattenInternalCalls(t *testing.T) {
+	vmTrace := parity.VMTrace{
+		Code: jumpingCode,
+		Ops:  []parity.Operation{{PC: 0}, {PC: 1}, {PC: 2}, {PC: 3}, {PC: 4}},
+	}
+	sourceMaps := map[string][]srclocation.SourceLocation{"A.sol:A": jumpingSourceMap}
+	bytecodeToFilename := map[string]string{jumpingCode: "A.sol:A"}
+
+	steps := trace.Flatten(vmTrace, sourceMaps, bytecodeToFilename)
+	if len(steps) != 5 {
+		t.Fatalf("Flattened to %d steps", len(steps))
+	}
+
+	insideStack := steps[2].Stack()
+	if len(insideStack) != 2 ||
+		insideStack[0].SrcLoc != jumpingSourceMap[2] ||
+		insideStack[1].SrcLoc != jumpingSourceMap[1] {
+		t.Errorf("Stack inside the internal call was %v", insideStack)
+	}
+
+	if afterStack := steps[4].Stack(); len(afterStack) != 1 || afterStack[0].SrcLoc != jumpingSourceMap[4] {
+		t.Errorf("Stack after the internal call was %v", afterStack)
+	}
+}
+
+func TestOriginOfBubbledRevert(t *testing.T) {
+	// PUSH1 0, CALL, REVERT
+	callerCode := "0x6000f1fd"
+	vmTrace := parity.VMTrace{
+		Code: callerCode,
+		Ops: []parity.Operation{
+			{PC: 0},
+			{PC: 2, Sub: &parity.VMTrace{
+				Code: jumpingCode,
+				Ops:  []parity.Operation{{PC: 0}, {PC: 1}, {PC: 2}, {PC: 4}},
+			}},
+			{PC: 3},
+		},
+	}
+	sourceMaps := map[string][]srclocation.SourceLocation{
+		"A.sol:A": jumpingSourceMap,
+		"B.sol:B": {
+			{ByteOffset: 0, ByteLength: 10, SourceFileName: "B.sol"},
+			{ByteOffset: 3, ByteLength: 4, SourceFileName: "B.sol"},
+			{ByteOffset: 5, ByteLength: 1, SourceFileName: "B.sol"},
+		},
+	}
+	bytecodeToFilename := map[string]string{jumpingCode: "A.sol:A", callerCode: "B.sol:B"}
+
+	steps := trace.Flatten(vmTrace, sourceMaps, bytecodeToFilename)
+	origin := trace.Origin(steps)
+	if origin.Index != 5 || origin.Depth != 1 {
+		t.Fatalf("Origin was step %d at depth %d", origin.Index, origin.Depth)
+	}
+
+	stack := origin.Stack()
+	want := []trace.Location{
+		{Contract: "A.sol:A", SrcLoc: jumpingSourceMap[4]},
+		{Contract: "A.sol:A", SrcLoc: jumpingSourceMap[1]},
+		{Contract: "B.sol:B", SrcLoc: srclocation.SourceLocation{ByteOffset: 3, ByteLength: 4, SourceFileName: "B.sol"}},
+	}
+	if len(stack) != len(want) {
+		t.Fatalf("Stack was %v", stack)
+	}
+	for i := range want {
+		if stack[i].Contract != want[i].Contract || stack[i].SrcLoc != want[i].SrcLoc {
+			t.Errorf("Stack differed at frame %d\nGot  %v\nWant %v", i, stack[i], want[i])
+		}
+	}
+}
+
+func TestOriginOfCaughtRevert(t *testing.T) {
+	cases := []struct {
+		callerCode string
+		pcsAfter   []int
+		index      int
+		depth      int
+	}{
+		// PUSH1 0, CALL, PUSH1 0, POP, REVERT: the caller carried on after
+		// the call failed, and reverted on its own.
+		{"0x6000f1600050fd", []int{3, 5, 6}, 8, 0},
+		// PUSH1 0, CALL, then RETURNDATASIZE, PUSH1 0, DUP1, RETURNDATACOPY,
+		// RETURNDATASIZE, PUSH1 0, REVERT, as Solidity passes a failure up.
+		{"0x6000f13d6000803e3d6000fd", []int{3, 4, 6, 7, 8, 9, 11}, 5, 1},
+	}
+	for _, c := range cases {
+		ops := []parity.Operation{{PC: 0}, {PC: 2, Sub: &parity.VMTrace{
+			Code: jumpingCode,
+			Ops:  []parity.Operation{{PC: 0}, {PC: 1}, {PC: 2}, {PC: 4}},
+		}}}
+		callerSourceMap := []srclocation.SourceLocation{{ByteLength: 10, SourceFileName: "B.sol"}, {ByteLength: 10, SourceFileName: "B.sol"}}
+		for _, pc := range c.pcsAfter {
+			ops = append(ops, parity.Operation{PC: pc})
+			callerSourceMap = append(callerSourceMap, srclocation.SourceLocation{ByteLength: 10, SourceFileName: "B.sol"})
+		}
+		vmTrace := parity.VMTrace{Code: c.callerCode, Ops: ops}
+		sourceMaps := map[string][]srclocation.SourceLocation{"A.sol:A": jumpingSourceMap, "B.sol:B": callerSourceMap}
+		bytecodeToFilename := map[string]string{jumpingCode: "A.sol:A", c.callerCode: "B.sol:B"}
+
+		origin := trace.Origin(trace.Flatten(vmTrace, sourceMaps, bytecodeToFilename))
+		if origin.Index != c.index || origin.Depth != c.depth {
+			t.Errorf("Origin in %s was step %d at depth %d", c.callerCode, origin.Index, origin.Depth)
+		}
+	}
+}
+
+func TestMachineStorageByAccount(t *testing.T) {
+	store := func(key string) parity.Operation {
+		return parity.Operation{PC: 0, Ex: parity.OperationEx{Store: &parity.StorageWrite{Key: key, Val: "0x1"}}}
+	}
+	push := func(pc int, value string) parity.Operation {
+		return parity.Operation{PC: pc, Ex: parity.OperationEx{Push: []string{value}}}
+	}
+	// Two instances of one contract are called, and then a library is
+	// delegate called, each of them writing to storage: PUSH1 0xb1 PUSH1 0
+	// CALL PUSH1 0xb2 PUSH1 0 CALL PUSH1 0 PUSH1 0 DELEGATECALL STOP
+	vmTrace := parity.VMTrace{
+		Code: "0x60b16000f160b26000f160006000f400",
+		Ops: []parity.Operation{
+			push(0, "0xb1"), push(2, "0x0"),
+			{PC: 4, Sub: &parity.VMTrace{Code: "0x55", Ops: []parity.Operation{store("0x1")}}},
+			push(5, "0xb2"), push(7, "0x0"),
+			{PC: 9, Sub: &parity.VMTrace{Code: "0x55", Ops: []parity.Operation{store("0x2")}}},
+			push(10, "0x0"), push(12, "0x0"),
+			{PC: 14, Sub: &parity.VMTrace{Code: "0x5500", Ops: []parity.Operation{store("0x3"), {PC: 1}}}},
+			{PC: 15},
+		},
+	}
+	bytecodeToFilename := map[string]string{"0x55": "Token.sol:Token", "0x5500": "Library.sol:Library"}
+	steps := trace.Flatten(vmTrace, nil, bytecodeToFilename)
+	if len(steps) != 14 {
+		t.Fatalf("Flattened to %d steps", len(steps))
+	}
+
+	machine := trace.NewMachine()
+	storages := make(map[int]map[string]string)
+	for _, step := range steps {
+		if step.Index == 7 {
+			// Before the second instance has run.
+			storages[-1] = machine.State(step).Storage
+		}
+		machine.Apply(step)
+		storages[step.Index] = machine.State(step).Storage
+	}
+
+	expected := map[int]string{
+		-1: "map[]",
+		3:  "map[0x1:0x1]",
+		7:  "map[0x2:0x1]",
+		11: "map[0x3:0x1]",
+		13: "map[0x3:0x1]",
+	}
+	for index, storage := range expected {
+		if fmt.Sprint(storages[index]) != storage {
+			t.Errorf("Storage at step %d was %v instead of %s", index, storages[index], storage)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/tracecache"
+)
+
+func TestTraceCacheMergesTraceTypes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cache := tracecache.Open(dir, "1337")
+
+	if _, err := cache.Get("0xAB", []string{"vmTrace"}); err != tracecache.ErrNotCached {
+		t.Errorf("Getting an uncached trace gave %v", err)
+	}
+
+	vmTrace := `{"output": "0x", "vmTrace": {"code": "0x00", "ops": []}, "stateDiff": null}`
+	if err := cache.Put("0xAB", json.RawMessage(vmTrace)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("0xab", []string{"vmTrace", "stateDiff"}); err != tracecache.ErrNotCached {
+		t.Errorf("Getting a trace type that wasn't cached gave %v", err)
+	}
+
+	stateDiff := `{"output": "0x", "vmTrace": null, "stateDiff": {}}`
+	if err := cache.Put("0xab", json.RawMessage(stateDiff)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := cache.Get("0xab", []string{"vmTrace", "stateDiff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var traces struct {
+		VMTrace   struct{ Code string }
+		StateDiff map[string]interface{}
+	}
+	if err := json.Unmarshal(result, &traces); err != nil {
+		t.Fatal(err)
+	}
+	if traces.VMTrace.Code != "0x00" || traces.StateDiff == nil {
+		t.Errorf("Cached traces were %s", result)
+	}
+}
+
+func TestTraceCacheAbortedWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cache := tracecache.Open(dir, "1")
+
+	writer, err := cache.Writer("0xab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte(`{"result": {"vmTr`))
+	writer.Abort()
+
+	if _, err := cache.Reader("0xab"); err != tracecache.ErrNotCached {
+		t.Errorf("A partly written trace was cached: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/traceimport"
+)
+
+// PUSH1 0 CALLDATALOAD STOP, and PUSH1 1 PUSH1 0 SSTORE STOP.
+const (
+	loadingCode = "0x60003500"
+	storingCode = "0x600160005500"
+)
+
+const parityTraceFile = `{"output": "0x", "vmTrace": {"code": "0x60003500", "ops": [
+	{"cost": 3, "pc": 0, "ex": {"push": ["0x0"], "used": 97}},
+	{"cost": 3, "pc": 2, "ex": {"push": ["0xa9059cbb00000000000000000000000000000000000000000000000000000000"], "used": 94}},
+	{"cost": 0, "pc": 3, "ex": {"push": [], "used": 94}}
+]}, "trace": []}`
+
+const gethTraceFile = `{"jsonrpc": "2.0", "id": 1, "result": {"gas": 30, "failed": false, "returnValue": "", "structLogs": [
+	{"pc": 0, "op": "PUSH1", "gas": 100, "gasCost": 3, "depth": 1, "stack": []},
+	{"pc": 2, "op": "PUSH1", "gas": 97, "gasCost": 3, "depth": 1, "stack": ["0x1"]},
+	{"pc": 4, "op": "SSTORE", "gas": 94, "gasCost": 20, "depth": 1, "stack": ["0x1", "0x0"]},
+	{"pc": 5, "op": "STOP", "gas": 74, "gasCost": 0, "depth": 1, "stack": []}
+]}}
+{"code": "0x", "ops": []}
+[{"result": {"structLogs": []}}, {"result": {"structLogs": [{"pc": 0, "op": "PUSH1", "gas": 3, "gasCost": 3, "depth": 1}]}}]
+`
+
+func TestReadTraceFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(parityTraceFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dir, "b.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := gzip.NewWriter(file)
+	writer.Write([]byte(gethTraceFile))
+	writer.Close()
+	file.Close()
+	ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a trace"), 0644)
+
+	var traces []traceimport.Trace
+	err = traceimport.Read(dir, []string{loadingCode, storingCode}, func(trace traceimport.Trace) error {
+		traces = append(traces, trace)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last geth trace starts with PUSH1 at 0, like both candidates do, so
+	// its code can't be told.
+	if len(traces) != 2 {
+		t.Fatalf("Read %d traces: %+v", len(traces), traces)
+	}
+	if traces[0].Name != filepath.Join(dir, "a.json")+"#1" || traces[0].ExecTrace.Code != loadingCode {
+		t.Errorf("The Parity trace was read as %s %+v", traces[0].Name, traces[0].ExecTrace)
+	}
+	if calldata := traceimport.Calldata(traces[0].ExecTrace.VMTrace); len(calldata) != 32 || calldata[0] != 0xa9 {
+		t.Errorf("The calldata was %x", calldata)
+	}
+
+	gethTrace := traces[1].ExecTrace
+	if gethTrace.Code != storingCode || len(gethTrace.Ops) != 4 || gethTrace.GasUsed() != 26 {
+		t.Errorf("The geth trace was read as %+v", gethTrace)
+	}
+	if store := gethTrace.Ops[2].Ex.Store; !reflect.DeepEqual(store, &parity.StorageWrite{Key: "0x0", Val: "0x1"}) {
+		t.Errorf("The geth trace stored %+v", store)
+	}
+}
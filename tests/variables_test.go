@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/solc"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+	"github.com/reserve-protocol/solstice/variables"
+)
+
+func TestDecodeStackValues(t *testing.T) {
+	cases := []struct {
+		typeString string
+		stackWord  string
+		want       string
+	}{
+		{"uint256", "0x64", "100"},
+		{"int8", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "-1"},
+		{"bool", "0x1", "true"},
+		{"address", "0xabcd", "0x000000000000000000000000000000000000abcd"},
+		{"bytes4", "0xdeadbeef00000000000000000000000000000000000000000000000000000000", "0xdeadbeef"},
+		{"uint256[] storage ref", "0x3", "storage pointer 0x3"},
+	}
+
+	for _, c := range cases {
+		if got := variables.DecodeValue(c.typeString, c.stackWord, nil); got != c.want {
+			t.Errorf("Decoded %s %s as %s instead of %s", c.typeString, c.stackWord, got, c.want)
+		}
+	}
+}
+
+func TestDecodeMemoryValues(t *testing.T) {
+	memory := make([]byte, 0x100)
+	// A string "hi" at 0x00
+	memory[0x1f] = 2
+	copy(memory[0x20:], "hi")
+	// A uint256[] of [7, 8] at 0x40
+	memory[0x5f] = 2
+	memory[0x7f] = 7
+	memory[0x9f] = 8
+	// A string[] holding a pointer to the string at 0x00, at 0xa0
+	memory[0xbf] = 1
+
+	if got := variables.DecodeValue("string memory", "0x0", memory); got != `"hi"` {
+		t.Errorf("Decoded string as %s", got)
+	}
+	if got := variables.DecodeValue("uint256[] memory", "0x40", memory); got != "[7, 8]" {
+		t.Errorf("Decoded array as %s", got)
+	}
+	if got := variables.DecodeValue("string[] memory", "0xa0", memory); got != `["hi"]` {
+		t.Errorf("Decoded string array as %s", got)
+	}
+	if got := variables.DecodeValue("string memory", "0x1000", memory); got != "memory pointer 0x1000" {
+		t.Errorf("Decoded out of range string as %s", got)
+	}
+}
+
+func TestTrackFunctionVariables(t *testing.T) {
+	// JUMPDEST, JUMP into f, JUMPDEST, JUMPDEST, JUMP out of f, REVERT
+	code := "0x5b565b5b56fd"
+	functionLoc := srclocation.SourceLocation{ByteOffset: 50, ByteLength: 20, SourceFileName: "A.sol"}
+	declarationLoc := srclocation.SourceLocation{ByteOffset: 60, ByteLength: 5, SourceFileName: "A.sol"}
+	sourceMap := []srclocation.SourceLocation{
+		{ByteOffset: 0, ByteLength: 100, SourceFileName: "A.sol"},
+		{ByteOffset: 10, ByteLength: 5, SourceFileName: "A.sol", JumpType: 'i'},
+		functionLoc,
+		declarationLoc,
+		{ByteOffset: 66, ByteLength: 2, SourceFileName: "A.sol", JumpType: 'o'},
+		{ByteOffset: 20, ByteLength: 5, SourceFileName: "A.sol"},
+	}
+	vmTrace := parity.VMTrace{
+		Code: code,
+		Ops: []parity.Operation{
+			{PC: 0, Ex: parity.OperationEx{Push: []string{"0x5", "0x2"}}},
+			{PC: 1},
+			{PC: 2},
+			{PC: 3, Ex: parity.OperationEx{Push: []string{"0x7"}}},
+			{PC: 4},
+			{PC: 5},
+		},
+	}
+	steps := trace.Flatten(
+		vmTrace,
+		map[string][]srclocation.SourceLocation{"A.sol:A": sourceMap},
+		map[string]string{code: "A.sol:A"},
+	)
+
+	trees := map[string]ast.AST{
+		"A.sol": {
+			SrcLoc: srclocation.SourceLocation{ByteOffset: 0, ByteLength: 100, SourceFileName: "A.sol"},
+			Children: []*ast.AST{{
+				SrcLoc:     functionLoc,
+				NodeType:   "FunctionDefinition",
+				Attributes: solc.JSONASTAttributes{Name: "f"},
+				Children: []*ast.AST{
+					{NodeType: "ParameterList", Children: []*ast.AST{{
+						NodeType:   "VariableDeclaration",
+						Attributes: solc.JSONASTAttributes{Name: "amount", Type: "uint256"},
+					}}},
+					{
+						SrcLoc:     declarationLoc,
+						NodeType:   "VariableDeclaration",
+						Attributes: solc.JSONASTAttributes{Name: "ok", Type: "bool"},
+					},
+				},
+			}},
+		},
+	}
+
+	stackVariables := variables.AtStep(trees, steps, steps[4])
+	want := []variables.Variable{
+		{Name: "amount", Type: "uint256", Value: "5"},
+		{Name: "ok", Type: "bool", Value: "true"},
+	}
+	if len(stackVariables) != 2 || len(stackVariables[0]) != len(want) {
+		t.Fatalf("Variables were %v", stackVariables)
+	}
+	for i := range want {
+		if stackVariables[0][i] != want[i] {
+			t.Errorf("Variable %d was %v instead of %v", i, stackVariables[0][i], want[i])
+		}
+	}
+}
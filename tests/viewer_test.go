@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/viewer"
+)
+
+func TestTraceHTML(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	steps := jumpingDebugger(t, dir).Steps
+
+	page, err := viewer.TraceHTML("0xabc", steps, func(srclocation.SourceLocation) string { return "A.f" }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := strings.Count(string(page), `"function":"A.f"`); count != len(steps) {
+		t.Errorf("Page had %d steps instead of %d", count, len(steps))
+	}
+	// The stack before the jump into the internal function holds its target.
+	if !strings.Contains(string(page), `"op":"JUMP","gas":0,"function":"A.f","stack":["0x2"]`) {
+		t.Errorf("Page was missing the stack of the jump:\n%s", page)
+	}
+}
@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"math/big"
+	"strings"
+)
+
+// A log emitted by one of the LOG ops, with its topics and data read from the
+// stack and memory before the op.
+type Log struct {
+	Step   Step
+	Topics [][]byte
+	Data   []byte
+}
+
+// The logs emitted during the trace, in order. This includes logs emitted by
+// calls that later reverted, which don't make it into the receipt.
+func Logs(steps []Step) []Log {
+	var logs []Log
+	machine := NewMachine()
+	for _, step := range steps {
+		if topicCount, ok := logTopicCounts[step.OpCode]; ok {
+			state := machine.State(step)
+			if log, ok := readLog(step, state, topicCount); ok {
+				logs = append(logs, log)
+			}
+		}
+		machine.Apply(step)
+	}
+	return logs
+}
+
+var logTopicCounts = map[string]int{"a0": 0, "a1": 1, "a2": 2, "a3": 3, "a4": 4}
+
+func readLog(step Step, state State, topicCount int) (Log, bool) {
+	if len(state.Stack) < 2+topicCount {
+		return Log{}, false
+	}
+
+	var items []*big.Int
+	for i := 0; i < 2+topicCount; i++ {
+		item, ok := new(big.Int).SetString(strings.TrimPrefix(state.Stack[len(state.Stack)-1-i], "0x"), 16)
+		if !ok {
+			return Log{}, false
+		}
+		items = append(items, item)
+	}
+
+	offset, size := items[0], items[1]
+	if !offset.IsInt64() || !size.IsInt64() || size.Int64() > int64(len(state.Memory))+32 {
+		return Log{}, false
+	}
+	log := Log{Step: step, Data: make([]byte, size.Int64())}
+	if start := offset.Int64(); start < int64(len(state.Memory)) {
+		copy(log.Data, state.Memory[start:])
+	}
+	for _, topic := range items[2:] {
+		word := make([]byte, 32)
+		topicBytes := topic.Bytes()
+		copy(word[32-len(topicBytes):], topicBytes)
+		log.Topics = append(log.Topics, word)
+	}
+	return log, true
+}
@@ -0,0 +1,171 @@
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+)
+
+// The machine state of an external call. Storage holds only the slots
+// written so far during the transaction.
+type State struct {
+	Stack   []string
+	Memory  []byte
+	Storage map[string]string
+}
+
+// Rebuilds machine states from the effects recorded for each step, which are
+// applied in order. Storage is kept per account, by the address read off the
+// stack of the call into it. The transaction's own account isn't in the
+// trace, so its storage is under "".
+type Machine struct {
+	states   map[*Frame]*State
+	accounts map[*Frame]string
+	storage  map[string]map[string]string
+	// The account whose storage the next external call runs in.
+	callee string
+}
+
+func NewMachine() *Machine {
+	return &Machine{
+		states:   make(map[*Frame]*State),
+		accounts: make(map[*Frame]string),
+		storage:  make(map[string]map[string]string),
+	}
+}
+
+func externalFrame(frame *Frame) *Frame {
+	for !frame.External {
+		frame = frame.Parent
+	}
+	return frame
+}
+
+func (machine *Machine) Apply(step Step) {
+	frame := externalFrame(step.Frame)
+	state, ok := machine.states[frame]
+	if !ok {
+		state = &State{}
+		machine.states[frame] = state
+		machine.accounts[frame] = machine.callee
+	}
+
+	if step.Op.Sub != nil {
+		machine.callee = machine.calleeAccount(step, frame, state.Stack)
+	}
+
+	pops := evmbytecode.StackPops(step.OpCode)
+	if pops > len(state.Stack) {
+		pops = len(state.Stack)
+	}
+	state.Stack = append(state.Stack[:len(state.Stack)-pops], step.Op.Ex.Push...)
+
+	if write := step.Op.Ex.Mem; write != nil {
+		data, err := hex.DecodeString(strings.TrimPrefix(write.Data, "0x"))
+		if err == nil {
+			if len(state.Memory) < write.Off+len(data) {
+				state.Memory = append(state.Memory, make([]byte, write.Off+len(data)-len(state.Memory))...)
+			}
+			copy(state.Memory[write.Off:], data)
+		}
+	}
+
+	if write := step.Op.Ex.Store; write != nil {
+		account := machine.accounts[frame]
+		if machine.storage[account] == nil {
+			machine.storage[account] = make(map[string]string)
+		}
+		machine.storage[account][write.Key] = write.Val
+	}
+}
+
+// The account whose storage a call op's sub-call runs in: the called address,
+// the caller's own account for DELEGATECALL and CALLCODE, or the new contract
+// for creations, whose address is what the op pushes.
+func (machine *Machine) calleeAccount(step Step, frame *Frame, stack []string) string {
+	var word string
+	switch step.OpCode {
+	case "f1", "fa": // CALL, STATICCALL
+		if len(stack) >= 2 {
+			word = stack[len(stack)-2]
+		}
+	case "f2", "f4": // CALLCODE, DELEGATECALL
+		return machine.accounts[frame]
+	case "f0", "f5": // CREATE, CREATE2
+		if len(step.Op.Ex.Push) == 1 {
+			word = step.Op.Ex.Push[0]
+		}
+	}
+	address, ok := new(big.Int).SetString(strings.TrimPrefix(word, "0x"), 16)
+	if !ok {
+		return ""
+	}
+	// Addresses are the low 20 bytes of the word.
+	address.And(address, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1)))
+	return fmt.Sprintf("0x%040x", address)
+}
+
+// The state of the external call that the step is in. The stack and memory
+// are copies, so they won't change as more steps are applied.
+func (machine *Machine) State(step Step) State {
+	frame := externalFrame(step.Frame)
+	state := State{Storage: make(map[string]string)}
+	account, ok := machine.accounts[frame]
+	if !ok {
+		// A call that hasn't run any steps yet runs in the account called.
+		account = machine.callee
+	}
+	for key, value := range machine.storage[account] {
+		state.Storage[key] = value
+	}
+	if current, ok := machine.states[frame]; ok {
+		state.Stack = machine.Stack(step)
+		state.Memory = append([]byte(nil), current.Memory...)
+	}
+	return state
+}
+
+// A copy of just the stack of the external call that the step is in.
+func (machine *Machine) Stack(step Step) []string {
+	if current, ok := machine.states[externalFrame(step.Frame)]; ok {
+		return append([]string(nil), current.Stack...)
+	}
+	return nil
+}
+
+// The number of items on the stack of the external call that the step is in.
+func (machine *Machine) StackHeight(step Step) int {
+	if current, ok := machine.states[externalFrame(step.Frame)]; ok {
+		return len(current.Stack)
+	}
+	return 0
+}
+
+// The item at the given position from the top of the stack of the external
+// call that the step is in.
+func (machine *Machine) StackItem(step Step, fromTop int) (string, bool) {
+	current, ok := machine.states[externalFrame(step.Frame)]
+	if !ok || fromTop >= len(current.Stack) {
+		return "", false
+	}
+	return current.Stack[len(current.Stack)-1-fromTop], true
+}
+
+// A copy of size bytes of the memory of the external call that the step is
+// in, starting at offset. Memory past what has been written reads as zeros.
+func (machine *Machine) Memory(step Step, offset int, size int) []byte {
+	data := make([]byte, size)
+	if current, ok := machine.states[externalFrame(step.Frame)]; ok && offset < len(current.Memory) {
+		copy(data, current.Memory[offset:])
+	}
+	return data
+}
+
+// The state of an external call, by its frame or that of any internal call
+// within it.
+func (machine *Machine) FrameState(frame *Frame) State {
+	return machine.State(Step{Frame: frame})
+}
@@ -0,0 +1,172 @@
+package trace
+
+import (
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/parity"
+	"github.com/reserve-protocol/solstice/srclocation"
+)
+
+// A function call, either a jump into an internal function or an external
+// message call. CallSite is where the parent frame was when it made the call.
+type Frame struct {
+	Parent   *Frame
+	Contract string
+	CallSite srclocation.SourceLocation
+	External bool
+}
+
+// One executed op, out of a trace with its sub-calls flattened into execution
+// order. SrcLoc is the op's location in the source, or the last location
+// seen in the same frame if the op has none, as with compiler generated code.
+type Step struct {
+	Index  int
+	Op     parity.Operation
+	OpCode string
+	Depth  int
+	Frame  *Frame
+	SrcLoc srclocation.SourceLocation
+}
+
+// A frame of a stack trace, and where it was at a particular step.
+type Location struct {
+	Contract string
+	SrcLoc   srclocation.SourceLocation
+	Frame    *Frame
+}
+
+// Flattens the trace and its sub-calls into steps, tracking the internal
+// function calls using the jump types of the source maps.
+func Flatten(
+	vmTrace parity.VMTrace,
+	sourceMaps map[string][]srclocation.SourceLocation,
+	bytecodeToFilename map[string]string,
+) []Step {
+	var steps []Step
+	flatten(&steps, vmTrace, nil, srclocation.SourceLocation{}, 0, sourceMaps, bytecodeToFilename)
+	return steps
+}
+
+func flatten(
+	steps *[]Step,
+	vmTrace parity.VMTrace,
+	parent *Frame,
+	callSite srclocation.SourceLocation,
+	depth int,
+	sourceMaps map[string][]srclocation.SourceLocation,
+	bytecodeToFilename map[string]string,
+) {
+	contractName := bytecodeToFilename[evmbytecode.RemoveMetaData(vmTrace.Code)]
+	sourceMap := sourceMaps[contractName]
+	pcToOpIndex := evmbytecode.GetPcToOpIndex(vmTrace.Code)
+
+	frame := &Frame{
+		Parent:   parent,
+		Contract: contractName,
+		CallSite: callSite,
+		External: true,
+	}
+	// The last known location of each frame. Frames are only pushed and
+	// popped in order, so this is a stack alongside them.
+	locations := []srclocation.SourceLocation{{}}
+
+	for _, op := range vmTrace.Ops {
+		opIndex, ok := pcToOpIndex[op.PC]
+		if ok && opIndex < len(sourceMap) && sourceMap[opIndex].SourceFileName != "" {
+			locations[len(locations)-1] = sourceMap[opIndex]
+		}
+		location := locations[len(locations)-1]
+
+		*steps = append(*steps, Step{
+			Index:  len(*steps),
+			Op:     op,
+			OpCode: evmbytecode.OpCodeAt(vmTrace.Code, op.PC),
+			Depth:  depth,
+			Frame:  frame,
+			SrcLoc: location,
+		})
+
+		if op.Sub != nil {
+			flatten(steps, *op.Sub, frame, location, depth+1, sourceMaps, bytecodeToFilename)
+		}
+
+		if !ok || opIndex >= len(sourceMap) {
+			continue
+		}
+		switch sourceMap[opIndex].JumpType {
+		case 'i':
+			frame = &Frame{
+				Parent:   frame,
+				Contract: contractName,
+				CallSite: location,
+			}
+			locations = append(locations, srclocation.SourceLocation{})
+		case 'o':
+			// Unbalanced jumps out can't leave the contract's own frame.
+			if !frame.External {
+				frame = frame.Parent
+				locations = locations[:len(locations)-1]
+			}
+		}
+	}
+}
+
+// The call stack at the step, innermost frame first.
+func (step Step) Stack() []Location {
+	stack := []Location{{Contract: step.Frame.Contract, SrcLoc: step.SrcLoc, Frame: step.Frame}}
+	for frame := step.Frame; frame.Parent != nil; frame = frame.Parent {
+		stack = append(stack, Location{Contract: frame.Parent.Contract, SrcLoc: frame.CallSite, Frame: frame.Parent})
+	}
+	return stack
+}
+
+// Whether the step ends its call with a failure.
+func (step Step) Reverts() bool {
+	return step.OpCode == "fd" || step.OpCode == "fe"
+}
+
+// Finds the step where a failure, which ended the trace, started. If a call
+// reverts right after one of its sub-calls reverted, passing the sub-call's
+// return data up, the failure is assumed to have come from the sub-call. A
+// call that caught the sub-call's failure and then reverted on its own is
+// blamed itself.
+func Origin(steps []Step) Step {
+	origin := len(steps) - 1
+	for origin > 0 && steps[origin].Reverts() {
+		previous := origin - 1
+		for previous >= 0 && steps[previous].Depth == steps[origin].Depth && !steps[previous].Reverts() {
+			previous--
+		}
+		// The step before the frame's last stretch of ops is the end of its
+		// most recent sub-call, if it made one.
+		if previous < 0 || steps[previous].Depth <= steps[origin].Depth || !steps[previous].Reverts() {
+			break
+		}
+		if !forwardsFailure(steps[previous+1:origin], steps[origin]) {
+			break
+		}
+		origin = previous
+	}
+	return steps[origin]
+}
+
+// Solidity passes a failure up within a few ops of the call, checking the
+// call's result and copying its return data to revert with. Before byzantium
+// there was no return data, and it ended with INVALID instead.
+const maxForwardingOps = 32
+
+// Whether the ops between the end of a failed sub-call and the failure of its
+// caller just pass the sub-call's failure up.
+func forwardsFailure(between []Step, failure Step) bool {
+	if len(between) > maxForwardingOps {
+		return false
+	}
+	if len(between) == 0 || failure.OpCode == "fe" { // INVALID
+		return true
+	}
+	for _, step := range between {
+		if step.OpCode == "3d" || step.OpCode == "3e" { // RETURNDATASIZE, RETURNDATACOPY
+			return true
+		}
+	}
+	return false
+}
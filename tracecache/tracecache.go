@@ -0,0 +1,251 @@
+package tracecache
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Returned when a trace, or one of the kinds of trace asked for, isn't in the
+// cache.
+var ErrNotCached = errors.New("The trace isn't in the cache.")
+
+// A directory of the traces fetched from a chain, one gzipped JSON-RPC
+// response to trace_replayTransaction per transaction. Traces are only read
+// from the cache when working offline: development chains reuse transaction
+// hashes after they restart, so a cached trace may be of a different run.
+type Cache struct {
+	dir string
+}
+
+// The cache of the chain in dir with the given ID. Each chain has a
+// directory of its own in dir.
+func Open(dir string, chainID string) *Cache {
+	return &Cache{dir: filepath.Join(dir, chainID)}
+}
+
+// Where the traces of the chain at URL are cached. Dir defaults to
+// .solstice/traces. Online, the chain ID is asked of the chain if it isn't
+// given. Offline, it can be left out if only one chain has been cached.
+type Config struct {
+	Dir     string
+	ChainID string
+	URL     string
+	Offline bool
+}
+
+// Opens the cache that the config describes.
+func (config Config) Open(ctx context.Context) (*Cache, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = filepath.Join(".solstice", "traces")
+	}
+	if config.ChainID != "" {
+		return Open(dir, config.ChainID), nil
+	}
+
+	if config.Offline {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		var chainIDs []string
+		for _, entry := range entries {
+			if entry.IsDir() {
+				chainIDs = append(chainIDs, entry.Name())
+			}
+		}
+		if len(chainIDs) != 1 {
+			return nil, fmt.Errorf("%s has traces of %d chains; set chain_id to pick one.", dir, len(chainIDs))
+		}
+		return Open(dir, chainIDs[0]), nil
+	}
+
+	chainID, err := ChainID(ctx, config.URL)
+	if err != nil {
+		return nil, err
+	}
+	return Open(dir, chainID), nil
+}
+
+var chainIDs = struct {
+	sync.Mutex
+	byURL map[string]string
+}{byURL: make(map[string]string)}
+
+// The ID of the chain at the URL, in decimal. Nodes that don't support
+// eth_chainId are asked for their network ID instead.
+func ChainID(ctx context.Context, url string) (string, error) {
+	chainIDs.Lock()
+	defer chainIDs.Unlock()
+	if chainID, ok := chainIDs.byURL[url]; ok {
+		return chainID, nil
+	}
+
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	var chainID string
+	var hexChainID string
+	if err := client.CallContext(ctx, &hexChainID, "eth_chainId"); err == nil {
+		var number uint64
+		if _, err := fmt.Sscanf(hexChainID, "0x%x", &number); err != nil {
+			return "", err
+		}
+		chainID = fmt.Sprint(number)
+	} else if err := client.CallContext(ctx, &chainID, "net_version"); err != nil {
+		return "", err
+	}
+	chainIDs.byURL[url] = chainID
+	return chainID, nil
+}
+
+func (cache *Cache) Dir() string {
+	return cache.dir
+}
+
+func (cache *Cache) path(hash string) string {
+	return filepath.Join(cache.dir, strings.ToLower(hash)+".json.gz")
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// Opens the cached JSON-RPC response with the trace of a transaction.
+func (cache *Cache) Reader(hash string) (io.ReadCloser, error) {
+	file, err := os.Open(cache.path(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrNotCached
+	}
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return readCloser{reader, file}, nil
+}
+
+type readCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (reader readCloser) Close() error {
+	reader.Reader.Close()
+	return reader.file.Close()
+}
+
+// The result of trace_replayTransaction for a transaction, if it has every
+// kind of trace asked for, e.g. "vmTrace" and "stateDiff".
+func (cache *Cache) Get(hash string, traceTypes []string) (json.RawMessage, error) {
+	reader, err := cache.Reader(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var cached response
+	if err := json.NewDecoder(reader).Decode(&cached); err != nil {
+		return nil, err
+	}
+	var traces map[string]json.RawMessage
+	if err := json.Unmarshal(cached.Result, &traces); err != nil {
+		return nil, err
+	}
+	for _, traceType := range traceTypes {
+		if trace, ok := traces[traceType]; !ok || string(trace) == "null" {
+			return nil, ErrNotCached
+		}
+	}
+	return cached.Result, nil
+}
+
+// Caches the result of trace_replayTransaction for a transaction. Kinds of
+// trace that were cached before but aren't in the result are kept.
+func (cache *Cache) Put(hash string, result json.RawMessage) error {
+	var traces map[string]json.RawMessage
+	if err := json.Unmarshal(result, &traces); err != nil {
+		return err
+	}
+	if cached, err := cache.Get(hash, nil); err == nil {
+		var cachedTraces map[string]json.RawMessage
+		if json.Unmarshal(cached, &cachedTraces) == nil {
+			for traceType, trace := range cachedTraces {
+				if existing, ok := traces[traceType]; !ok || string(existing) == "null" {
+					traces[traceType] = trace
+				}
+			}
+		}
+	}
+
+	merged, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+	writer, err := cache.Writer(hash)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(writer).Encode(response{JSONRPC: "2.0", ID: 1, Result: merged}); err != nil {
+		writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
+
+// Writes a JSON-RPC response with the trace of a transaction to the cache
+// as it's read, for traces too large to hold in memory. It replaces what was
+// cached before once it's closed.
+type Writer struct {
+	*gzip.Writer
+	file *os.File
+	path string
+}
+
+func (cache *Cache) Writer(hash string) (*Writer, error) {
+	if err := os.MkdirAll(cache.dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(cache.dir, ".partial-")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{gzip.NewWriter(file), file, cache.path(hash)}, nil
+}
+
+// Gives up on the write, leaving the cache as it was.
+func (writer *Writer) Abort() {
+	writer.file.Close()
+	os.Remove(writer.file.Name())
+}
+
+func (writer *Writer) Close() error {
+	if err := writer.Writer.Close(); err != nil {
+		writer.Abort()
+		return err
+	}
+	if err := writer.file.Close(); err != nil {
+		os.Remove(writer.file.Name())
+		return err
+	}
+	return os.Rename(writer.file.Name(), writer.path)
+}
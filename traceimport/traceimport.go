@@ -0,0 +1,182 @@
+package traceimport
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/geth"
+	"github.com/reserve-protocol/solstice/parity"
+)
+
+// A trace read from a file. Name says where it was read from, e.g.
+// "traces/run.jsonl#3", since there's no transaction hash to go by.
+type Trace struct {
+	Name      string
+	ExecTrace parity.ExecTrace
+}
+
+// Reads the traces in the .json and .jsonl files in dir and its
+// subdirectories, which can also be gzipped. Each file holds any number of
+// JSON values, each of which is one of
+//   - the result of Parity's trace_replayTransaction, or just its vmTrace,
+//   - the result of geth's debug_traceTransaction with the struct logger,
+//   - a JSON-RPC response with one of those as its result,
+//   - an array of any of these, as debug_traceBlockByNumber and
+//     trace_replayBlockTransactions give.
+//
+// Geth's struct logs don't include the code that ran, so it's found among
+// candidates, the code of the contracts the traces might have called, by
+// matching the ops in the logs. Traces that ran no code are skipped.
+func Read(dir string, candidates []string, handle func(Trace) error) error {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(info.Name(), ".gz")
+		if !info.IsDir() && (strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".jsonl")) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	reader := reader{candidates: candidates, handle: handle}
+	for _, file := range files {
+		if err := reader.readFile(file); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+type reader struct {
+	candidates []string
+	handle     func(Trace) error
+	file       string
+	count      int
+}
+
+func (reader *reader) readFile(file string) error {
+	opened, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer opened.Close()
+
+	var input io.Reader = opened
+	if strings.HasSuffix(file, ".gz") {
+		gzipReader, err := gzip.NewReader(opened)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+
+	reader.file = file
+	reader.count = 0
+	decoder := json.NewDecoder(input)
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := reader.readValue(value); err != nil {
+			return err
+		}
+	}
+}
+
+func (reader *reader) readValue(value json.RawMessage) error {
+	trimmed := strings.TrimSpace(string(value))
+	if trimmed == "null" {
+		return nil
+	}
+	if strings.HasPrefix(trimmed, "[") {
+		var values []json.RawMessage
+		if err := json.Unmarshal(value, &values); err != nil {
+			return err
+		}
+		for _, value := range values {
+			if err := reader.readValue(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return err
+	}
+	var execTrace parity.ExecTrace
+	switch {
+	case fields["result"] != nil:
+		return reader.readValue(fields["result"])
+	case fields["vmTrace"] != nil:
+		if err := json.Unmarshal(value, &execTrace); err != nil {
+			return err
+		}
+	case fields["ops"] != nil:
+		if err := json.Unmarshal(value, &execTrace.VMTrace); err != nil {
+			return err
+		}
+		execTrace.Output = "0x"
+	case fields["structLogs"] != nil:
+		var result geth.Result
+		if err := json.Unmarshal(value, &result); err != nil {
+			return err
+		}
+		if len(result.StructLogs) == 0 {
+			return nil
+		}
+		var err error
+		execTrace, err = result.MatchingExecTrace(reader.candidates)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Value %d isn't a trace in any format solstice knows.", reader.count)
+	}
+
+	reader.count++
+	if execTrace.Code == "" || execTrace.Code == "0x" || len(execTrace.Ops) == 0 {
+		return nil
+	}
+	return reader.handle(Trace{Name: fmt.Sprintf("%s#%d", reader.file, reader.count), ExecTrace: execTrace})
+}
+
+// The calldata the trace's contract read first, which is where Solidity
+// reads the function selector from. Traces don't include the calldata
+// itself, so this is the closest there is to it.
+func Calldata(vmTrace parity.VMTrace) []byte {
+	for _, op := range vmTrace.Ops {
+		if evmbytecode.OpCodeAt(vmTrace.Code, op.PC) != "35" || len(op.Ex.Push) != 1 { // CALLDATALOAD
+			continue
+		}
+		digits := strings.TrimPrefix(op.Ex.Push[0], "0x")
+		if len(digits) > 64 {
+			return nil
+		}
+		word, err := hex.DecodeString(strings.Repeat("0", 64-len(digits)) + digits)
+		if err != nil {
+			return nil
+		}
+		return word
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package variables
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Arrays are cut off after this many elements.
+const maxElements = 32
+
+var dataLocations = []string{" memory", " storage ref", " storage pointer", " storage", " calldata"}
+
+// Decodes a stack word according to the Solidity type of the variable, as
+// given in the AST, e.g. "uint256" or "string memory". Values in memory are
+// read from the given memory; other reference types are shown as pointers.
+func DecodeValue(typeString string, stackWord string, memory []byte) string {
+	word, ok := new(big.Int).SetString(strings.TrimPrefix(stackWord, "0x"), 16)
+	if !ok {
+		return stackWord
+	}
+
+	baseType := typeString
+	location := ""
+	for _, dataLocation := range dataLocations {
+		if strings.HasSuffix(typeString, dataLocation) {
+			baseType = strings.TrimSuffix(typeString, dataLocation)
+			location = strings.Fields(dataLocation)[0]
+			break
+		}
+	}
+
+	switch location {
+	case "":
+		return decodeValueType(baseType, word)
+	case "memory":
+		return decodeMemory(baseType, word, memory, 0)
+	default:
+		return fmt.Sprintf("%s pointer 0x%x", location, word)
+	}
+}
+
+func decodeValueType(baseType string, word *big.Int) string {
+	switch {
+	case baseType == "bool":
+		return strconv.FormatBool(word.Sign() != 0)
+	case baseType == "address" || baseType == "address payable" || strings.HasPrefix(baseType, "contract "):
+		return fmt.Sprintf("0x%040x", word)
+	case strings.HasPrefix(baseType, "uint") || strings.HasPrefix(baseType, "enum "):
+		return word.String()
+	case strings.HasPrefix(baseType, "int"):
+		signed := new(big.Int).Set(word)
+		if word.Bit(255) == 1 {
+			signed.Sub(signed, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return signed.String()
+	case strings.HasPrefix(baseType, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(baseType, "bytes"))
+		if err == nil && 0 < size && size <= 32 {
+			// Fixed size byte arrays are left aligned in their word.
+			return fmt.Sprintf("0x%064x", word)[:2+2*size]
+		}
+	}
+	return fmt.Sprintf("0x%x", word)
+}
+
+func memoryWord(memory []byte, offset *big.Int) (*big.Int, bool) {
+	if !offset.IsInt64() || offset.Int64()+32 > int64(len(memory)) {
+		return nil, false
+	}
+	start := int(offset.Int64())
+	return new(big.Int).SetBytes(memory[start : start+32]), true
+}
+
+// Decodes the value that the pointer points to in memory.
+func decodeMemory(baseType string, pointer *big.Int, memory []byte, depth int) string {
+	unreadable := fmt.Sprintf("memory pointer 0x%x", pointer)
+	if depth > 4 {
+		return unreadable
+	}
+
+	if baseType == "string" || baseType == "bytes" {
+		length, ok := memoryWord(memory, pointer)
+		if !ok || !length.IsInt64() || length.Int64() > int64(len(memory)) ||
+			pointer.Int64()+32+length.Int64() > int64(len(memory)) {
+			return unreadable
+		}
+		start := int(pointer.Int64()) + 32
+		contents := memory[start : start+int(length.Int64())]
+		if baseType == "string" {
+			return strconv.Quote(string(contents))
+		}
+		return fmt.Sprintf("0x%x", contents)
+	}
+
+	if strings.HasSuffix(baseType, "]") {
+		openIndex := strings.LastIndex(baseType, "[")
+		elementType := baseType[:openIndex]
+		lengthString := baseType[openIndex+1 : len(baseType)-1]
+
+		elementsStart := new(big.Int).Set(pointer)
+		var length int64
+		if lengthString == "" {
+			lengthWord, ok := memoryWord(memory, pointer)
+			if !ok || !lengthWord.IsInt64() {
+				return unreadable
+			}
+			length = lengthWord.Int64()
+			elementsStart.Add(elementsStart, big.NewInt(32))
+		} else {
+			var err error
+			length, err = strconv.ParseInt(lengthString, 10, 64)
+			if err != nil {
+				return unreadable
+			}
+		}
+
+		var elements []string
+		for i := int64(0); i < length && i < maxElements; i++ {
+			elementOffset := new(big.Int).Add(elementsStart, big.NewInt(32*i))
+			element, ok := memoryWord(memory, elementOffset)
+			if !ok {
+				return unreadable
+			}
+			if isReferenceType(elementType) {
+				// Arrays of reference types hold pointers to their elements.
+				elements = append(elements, decodeMemory(elementType, element, memory, depth+1))
+			} else {
+				elements = append(elements, decodeValueType(elementType, element))
+			}
+		}
+		if length > maxElements {
+			elements = append(elements, fmt.Sprintf("... %d more", length-maxElements))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+
+	return unreadable
+}
+
+func isReferenceType(baseType string) bool {
+	return baseType == "string" ||
+		baseType == "bytes" ||
+		strings.HasSuffix(baseType, "]") ||
+		strings.HasPrefix(baseType, "struct ")
+}
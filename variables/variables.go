@@ -0,0 +1,162 @@
+package variables
+
+import (
+	"github.com/reserve-protocol/solstice/ast"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+// A function parameter or local variable, with its value decoded by type.
+type Variable struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+type slot struct {
+	declaration *ast.AST
+	index       int
+}
+
+// The stack slots of the variables of one internal function call.
+type frameVariables struct {
+	slots []slot
+}
+
+// Works out where the variables of each function call live on the stack, by
+// following a trace step by step.
+//
+// Solidity passes arguments to internal functions on the stack, on top of the
+// return address, so they are the top items when the function is entered.
+// Each local variable, including named return variables, gets a new slot at
+// the top of the stack at the op that has its declaration as the location.
+type Tracker struct {
+	trees        map[string]ast.AST
+	declarations map[srclocation.SourceLocation]*ast.AST
+	frames       map[*trace.Frame]*frameVariables
+	machine      *trace.Machine
+	prevFrame    *trace.Frame
+}
+
+func NewTracker(trees map[string]ast.AST) *Tracker {
+	tracker := &Tracker{
+		trees:        trees,
+		declarations: make(map[srclocation.SourceLocation]*ast.AST),
+		frames:       make(map[*trace.Frame]*frameVariables),
+		machine:      trace.NewMachine(),
+	}
+	for _, tree := range trees {
+		tracker.addDeclarations(tree.Children)
+	}
+	return tracker
+}
+
+func (tracker *Tracker) addDeclarations(nodes []*ast.AST) {
+	for _, node := range nodes {
+		if node.NodeType == "VariableDeclaration" && !node.Attributes.StateVariable {
+			tracker.declarations[node.SrcLoc] = node
+		}
+		tracker.addDeclarations(node.Children)
+	}
+}
+
+// The parameters of the function containing the location.
+func (tracker *Tracker) parameters(location srclocation.SourceLocation) []*ast.AST {
+	tree, ok := tracker.trees[location.SourceFileName]
+	if !ok {
+		return nil
+	}
+	functions := tree.Enclosing(location, "FunctionDefinition")
+	if len(functions) == 0 {
+		return nil
+	}
+	function := functions[len(functions)-1]
+
+	for _, child := range function.Children {
+		if child.NodeType == "ParameterList" {
+			var parameters []*ast.AST
+			for _, parameter := range child.Children {
+				if parameter.NodeType == "VariableDeclaration" {
+					parameters = append(parameters, parameter)
+				}
+			}
+			return parameters
+		}
+	}
+	return nil
+}
+
+// Steps must be applied in order, starting from the beginning of the trace.
+func (tracker *Tracker) Apply(step trace.Step) {
+	frame := step.Frame
+	variables, ok := tracker.frames[frame]
+	if !ok {
+		variables = &frameVariables{}
+		tracker.frames[frame] = variables
+
+		// The first step of an internal call comes right after the jump
+		// into it, with the arguments on top of the stack.
+		if !frame.External && tracker.prevFrame == frame.Parent {
+			parameters := tracker.parameters(step.SrcLoc)
+			height := tracker.machine.StackHeight(step)
+			for i, parameter := range parameters {
+				variables.slots = append(variables.slots, slot{parameter, height - len(parameters) + i})
+			}
+		}
+	}
+	tracker.prevFrame = frame
+
+	tracker.machine.Apply(step)
+
+	if declaration, ok := tracker.declarations[withoutJumpType(step.SrcLoc)]; ok {
+		for _, existing := range variables.slots {
+			if existing.declaration == declaration {
+				return
+			}
+		}
+		variables.slots = append(variables.slots, slot{declaration, tracker.machine.StackHeight(step) - 1})
+	}
+}
+
+func withoutJumpType(location srclocation.SourceLocation) srclocation.SourceLocation {
+	location.JumpType = rune(0)
+	return location
+}
+
+// The variables of the frame that are still on the stack, given the steps
+// applied so far.
+func (tracker *Tracker) Variables(frame *trace.Frame) []Variable {
+	variables, ok := tracker.frames[frame]
+	if !ok {
+		return nil
+	}
+
+	state := tracker.machine.FrameState(frame)
+	var decoded []Variable
+	for _, variable := range variables.slots {
+		if variable.index < 0 || variable.index >= len(state.Stack) {
+			continue
+		}
+		decoded = append(decoded, Variable{
+			Name:  variable.declaration.Attributes.Name,
+			Type:  variable.declaration.Attributes.Type,
+			Value: DecodeValue(variable.declaration.Attributes.Type, state.Stack[variable.index], state.Memory),
+		})
+	}
+	return decoded
+}
+
+// Replays the steps before the given one, and returns the variables of each
+// frame on its stack, innermost first.
+func AtStep(trees map[string]ast.AST, steps []trace.Step, step trace.Step) [][]Variable {
+	tracker := NewTracker(trees)
+	for _, previous := range steps[:step.Index] {
+		tracker.Apply(previous)
+	}
+
+	var stackVariables [][]Variable
+	for _, location := range step.Stack() {
+		stackVariables = append(stackVariables, tracker.Variables(location.Frame))
+	}
+	return stackVariables
+}
@@ -0,0 +1,289 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"unicode/utf8"
+
+	"github.com/reserve-protocol/solstice/evmbytecode"
+	"github.com/reserve-protocol/solstice/srclocation"
+	"github.com/reserve-protocol/solstice/trace"
+)
+
+type sourceFile struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// Offsets are in UTF-16 code units rather than bytes, to match strings in
+// the browser.
+type viewerStep struct {
+	Index     int      `json:"index"`
+	File      int      `json:"file"`
+	Offset    int      `json:"offset"`
+	Length    int      `json:"length"`
+	CallDepth int      `json:"callDepth"`
+	Frames    int      `json:"frames"`
+	Op        string   `json:"op"`
+	Gas       int      `json:"gas"`
+	Function  string   `json:"function"`
+	Stack     []string `json:"stack"`
+	Events    []string `json:"events,omitempty"`
+}
+
+type viewerTrace struct {
+	Title string       `json:"title"`
+	Files []sourceFile `json:"files"`
+	Steps []viewerStep `json:"steps"`
+}
+
+// Converts byte offsets in a file to UTF-16 offsets.
+type offsets []int
+
+func newOffsets(source []byte) offsets {
+	converted := make(offsets, len(source)+1)
+	index := 0
+	for byteIndex := 0; byteIndex < len(source); {
+		r, size := utf8.DecodeRune(source[byteIndex:])
+		for i := 0; i < size; i++ {
+			converted[byteIndex+i] = index
+		}
+		byteIndex += size
+		if r >= 0x10000 {
+			index += 2
+		} else {
+			index += 1
+		}
+	}
+	converted[len(source)] = index
+	return converted
+}
+
+func (converted offsets) get(byteOffset int) int {
+	if byteOffset < 0 {
+		return 0
+	}
+	if byteOffset >= len(converted) {
+		return converted[len(converted)-1]
+	}
+	return converted[byteOffset]
+}
+
+// Builds a self-contained HTML page for stepping through the trace. As with
+// the rest of display, consecutive steps at the same location are collapsed
+// and steps without a location are left out. functionName names the function
+// a location is in. events maps the index of each step that emitted a log to
+// its decoded event; events emitted by steps that aren't shown are moved to
+// the nearest step that is.
+func TraceHTML(
+	title string,
+	steps []trace.Step,
+	functionName func(srclocation.SourceLocation) string,
+	events map[int]string,
+) ([]byte, error) {
+	data := viewerTrace{Title: title}
+	fileIndexes := make(map[string]int)
+	fileOffsets := make(map[string]offsets)
+
+	machine := trace.NewMachine()
+	var prevStep trace.Step
+	var pendingEvents []string
+	for i, step := range steps {
+		location := step.SrcLoc
+		duplicate := i != 0 &&
+			location == prevStep.SrcLoc &&
+			step.Frame == prevStep.Frame
+		prevStep = step
+
+		if event, ok := events[step.Index]; ok {
+			if duplicate && len(data.Steps) != 0 {
+				shown := &data.Steps[len(data.Steps)-1]
+				shown.Events = append(shown.Events, event)
+			} else {
+				pendingEvents = append(pendingEvents, event)
+			}
+		}
+
+		if location.SourceFileName == "" || duplicate {
+			machine.Apply(step)
+			continue
+		}
+
+		if _, ok := fileIndexes[location.SourceFileName]; !ok {
+			source, err := ioutil.ReadFile(location.SourceFileName)
+			if err != nil {
+				return nil, err
+			}
+			fileIndexes[location.SourceFileName] = len(data.Files)
+			fileOffsets[location.SourceFileName] = newOffsets(source)
+			data.Files = append(data.Files, sourceFile{
+				Name:   location.SourceFileName,
+				Source: string(source),
+			})
+		}
+
+		converted := fileOffsets[location.SourceFileName]
+		start := converted.get(location.ByteOffset)
+		data.Steps = append(data.Steps, viewerStep{
+			Index:     step.Index,
+			File:      fileIndexes[location.SourceFileName],
+			Offset:    start,
+			Length:    converted.get(location.ByteOffset+location.ByteLength) - start,
+			CallDepth: step.Depth,
+			Frames:    len(step.Stack()),
+			Op:        evmbytecode.OpCodeName(step.OpCode),
+			Gas:       step.Op.Ex.Used + step.Op.Cost,
+			Function:  functionName(location),
+			Stack:     machine.Stack(step),
+			Events:    pendingEvents,
+		})
+		pendingEvents = nil
+		machine.Apply(step)
+	}
+	if len(pendingEvents) != 0 && len(data.Steps) != 0 {
+		shown := &data.Steps[len(data.Steps)-1]
+		shown.Events = append(shown.Events, pendingEvents...)
+	}
+
+	traceJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var page bytes.Buffer
+	err = pageTemplate.Execute(&page, struct {
+		Title string
+		Trace template.JS
+	}{title, template.JS(traceJSON)})
+	return page.Bytes(), err
+}
+
+var pageTemplate = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: sans-serif; margin: 0; }
+  #controls { position: sticky; top: 0; background: #fafbfc; border-bottom: 1px solid #e1e4e8; padding: 8px 16px; }
+  #slider { width: 100%; }
+  #details { display: flex; gap: 24px; font-size: 14px; }
+  #events { font-family: monospace; font-size: 12px; max-height: 6em; overflow-y: auto; margin: 4px 0 0 0; }
+  #events .new { font-weight: bold; }
+  #stack { font-family: monospace; font-size: 12px; max-height: 8em; overflow-y: auto; margin: 4px 0 0 0; }
+  .file { margin: 16px; }
+  .file h3 { font-size: 14px; margin: 0 0 4px 0; }
+  .file pre { margin: 0; padding: 8px; border: 1px solid #e1e4e8; }
+  .current { background-color: #e6ffed; }
+  .inactive { opacity: 0.6; }
+</style>
+</head>
+<body>
+<div id="controls">
+  <div><button id="prev">&larr;</button> <button id="next">&rarr;</button>
+  <span id="position"></span> (use the arrow keys or the slider)</div>
+  <input id="slider" type="range" min="0" value="0">
+  <div id="details">
+    <span>Function: <b id="function"></b></span>
+    <span>Op: <b id="op"></b></span>
+    <span>Gas remaining: <b id="gas"></b></span>
+    <span>Call depth: <b id="callDepth"></b></span>
+    <span>Stack frames: <b id="frames"></b></span>
+  </div>
+  <pre id="stack"></pre>
+  <div>Events emitted so far:</div>
+  <pre id="events"></pre>
+</div>
+<div id="files"></div>
+<script>
+var trace = {{.Trace}};
+var files = trace.files.map(function(file) {
+  var container = document.createElement("div");
+  container.className = "file inactive";
+  var heading = document.createElement("h3");
+  heading.textContent = file.name;
+  var pre = document.createElement("pre");
+  var before = document.createElement("span");
+  var current = document.createElement("span");
+  var after = document.createElement("span");
+  current.className = "current";
+  before.textContent = file.source;
+  pre.appendChild(before);
+  pre.appendChild(current);
+  pre.appendChild(after);
+  container.appendChild(heading);
+  container.appendChild(pre);
+  document.getElementById("files").appendChild(container);
+  return {source: file.source, container: container, before: before, current: current, after: after};
+});
+
+var slider = document.getElementById("slider");
+slider.max = Math.max(trace.steps.length - 1, 0);
+var shown = -1;
+
+function show(index) {
+  if (trace.steps.length === 0) {
+    document.getElementById("position").textContent = "No steps with source locations.";
+    return;
+  }
+  index = Math.max(0, Math.min(index, trace.steps.length - 1));
+  var step = trace.steps[index];
+
+  if (shown !== -1) {
+    var old = files[trace.steps[shown].file];
+    old.before.textContent = old.source;
+    old.current.textContent = "";
+    old.after.textContent = "";
+    old.container.className = "file inactive";
+  }
+  var file = files[step.file];
+  file.before.textContent = file.source.slice(0, step.offset);
+  file.current.textContent = file.source.slice(step.offset, step.offset + step.length);
+  file.after.textContent = file.source.slice(step.offset + step.length);
+  file.container.className = "file";
+  file.current.scrollIntoView({block: "center"});
+  shown = index;
+
+  slider.value = index;
+  document.getElementById("position").textContent =
+    "Step " + (index + 1) + " of " + trace.steps.length + " (trace op " + step.index + ")";
+  document.getElementById("function").textContent = step.function;
+  document.getElementById("op").textContent = step.op;
+  document.getElementById("gas").textContent = step.gas;
+  document.getElementById("callDepth").textContent = step.callDepth;
+  document.getElementById("frames").textContent = step.frames;
+  document.getElementById("stack").textContent = (step.stack || []).slice().reverse().join("\n");
+  showEvents(index);
+}
+
+function showEvents(index) {
+  var list = document.getElementById("events");
+  list.textContent = "";
+  for (var i = 0; i <= index; i++) {
+    (trace.steps[i].events || []).forEach(function(event) {
+      var line = document.createElement("div");
+      line.textContent = event;
+      if (i === index) {
+        line.className = "new";
+      }
+      list.appendChild(line);
+    });
+  }
+}
+
+slider.addEventListener("input", function() { show(parseInt(slider.value, 10)); });
+document.getElementById("prev").addEventListener("click", function() { show(shown - 1); });
+document.getElementById("next").addEventListener("click", function() { show(shown + 1); });
+document.addEventListener("keydown", function(event) {
+  if (event.key === "ArrowLeft" || event.key === "k") { show(shown - 1); event.preventDefault(); }
+  if (event.key === "ArrowRight" || event.key === "j") { show(shown + 1); event.preventDefault(); }
+  if (event.key === "Home") { show(0); event.preventDefault(); }
+  if (event.key === "End") { show(trace.steps.length - 1); event.preventDefault(); }
+});
+show(0);
+</script>
+</body>
+</html>
+`))